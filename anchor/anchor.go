@@ -0,0 +1,170 @@
+// Package anchor puts digests of merkle accumulator on external ledgers, so that the history of accumulator can't be
+// rewritten without being noticed by the ledger.
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/frankonly/upchain/storage"
+)
+
+// Names of supported ledgers
+const (
+	FileLedgerName     = "file"
+	EthereumLedgerName = "ethereum"
+)
+
+const (
+	fileScheme = "file://"
+	// submitTimeout is the longest time to wait for a digest to be accepted by ledger
+	submitTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrTxNotFound indicates that the transaction is not on ledger
+	ErrTxNotFound = fmt.Errorf("transaction not found")
+	// ErrTxMismatch indicates that the transaction does not carry the digest
+	ErrTxMismatch = fmt.Errorf("transaction mismatch")
+)
+
+// Receipt is returned by ledger once a digest is accepted
+type Receipt struct {
+	TxID  string
+	Block uint64
+	Time  time.Time
+}
+
+// Anchorer submits digests to an external ledger and checks them later
+type Anchorer interface {
+	// Ledger returns the name of ledger
+	Ledger() string
+	// Submit puts the digest on ledger and waits until it is accepted
+	Submit(ctx context.Context, digest []byte) (*Receipt, error)
+	// Verify checks that the transaction of certain id is on ledger and carries the digest
+	Verify(ctx context.Context, txID string, digest []byte) error
+}
+
+// Open returns the anchorer of a ledger URL, which is file://PATH for a file ledger, or the JSON-RPC endpoint of an
+// Ethereum node. Account is the unlocked Ethereum account sending transactions, which is only required to submit.
+func Open(url, account string) (Anchorer, error) {
+	switch {
+	case strings.HasPrefix(url, fileScheme):
+		return NewFileLedger(strings.TrimPrefix(url, fileScheme))
+	case strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"):
+		return NewEthereum(url, account), nil
+	default:
+		return nil, fmt.Errorf("unknown ledger %s", url)
+	}
+}
+
+// Service anchors the latest digest of accumulator at regular intervals, and records each receipt as an anchor of
+// the indexed digest
+type Service struct {
+	accumulator storage.MerkleAccumulator
+	anchorer    Anchorer
+	interval    time.Duration
+	logger      *zap.SugaredLogger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService returns an anchoring service, which runs after Start
+func NewService(accumulator storage.MerkleAccumulator, anchorer Anchorer, interval time.Duration, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		accumulator: accumulator,
+		anchorer:    anchorer,
+		interval:    interval,
+		logger:      logger,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start runs service in background until Stop
+func (s *Service) Start() {
+	go s.run()
+}
+
+// Stop stops a started service and waits for the running submission to finish or be canceled
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *Service) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.Anchor(); err != nil && !errors.Is(err, storage.ErrEmpty) {
+			s.logger.Errorw("failed to anchor", "ledger", s.anchorer.Ledger(), "err", err)
+		}
+	}
+}
+
+// Anchor submits the latest digest to ledger and records the anchor. The latest anchor is returned without
+// submission if the digest is not changed since then.
+func (s *Service) Anchor() (*storage.Anchor, error) {
+	digest, err := s.accumulator.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := s.accumulator.LatestAnchor()
+	if err == nil && bytes.Equal(latest.Digest, digest) {
+		return latest, nil
+	} else if err != nil && !errors.Is(err, storage.ErrEmpty) {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), submitTimeout)
+	defer cancel()
+
+	// submission is canceled when the service stops
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	receipt, err := s.anchorer.Submit(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	anchor := &storage.Anchor{
+		Digest: digest,
+		Ledger: s.anchorer.Ledger(),
+		TxID:   receipt.TxID,
+		Block:  receipt.Block,
+		Time:   receipt.Time,
+	}
+	if err := s.accumulator.AddAnchor(anchor); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("anchored", "Digest", hex.EncodeToString(digest), "Leaves", anchor.Leaves,
+		"Ledger", anchor.Ledger, "TxID", anchor.TxID, "Block", anchor.Block)
+	return anchor, nil
+}
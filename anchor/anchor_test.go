@@ -0,0 +1,252 @@
+package anchor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/frankonly/upchain/storage"
+)
+
+func TestFileLedger(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	path := filepath.Join(os.TempDir(), "upchain_ledger.jsonl")
+	r.NoError(os.RemoveAll(path))
+
+	anchorer, err := Open(fileScheme+path, "")
+	r.NoError(err)
+	r.Equal(FileLedgerName, anchorer.Ledger())
+
+	digests := make([][]byte, 5)
+	receipts := make([]*Receipt, 0, len(digests))
+	for i := range digests {
+		digests[i] = make([]byte, 32)
+		rand.Read(digests[i])
+
+		receipt, err := anchorer.Submit(context.Background(), digests[i])
+		r.NoError(err)
+		r.EqualValues(i, receipt.Block)
+		receipts = append(receipts, receipt)
+	}
+
+	for i, receipt := range receipts {
+		r.NoError(anchorer.Verify(context.Background(), receipt.TxID, digests[i]))
+
+		err := anchorer.Verify(context.Background(), receipt.TxID, digests[(i+1)%len(digests)])
+		r.True(errors.Is(err, ErrTxMismatch))
+	}
+
+	err = anchorer.Verify(context.Background(), "unknown", digests[0])
+	r.True(errors.Is(err, ErrTxNotFound))
+
+	// a modified block breaks the chain of transactions
+	content, err := ioutil.ReadFile(path)
+	r.NoError(err)
+	lines := strings.Split(string(content), "\n")
+	var block fileBlock
+	r.NoError(json.Unmarshal([]byte(lines[1]), &block))
+	block.Time++
+	line, err := json.Marshal(block)
+	r.NoError(err)
+	lines[1] = string(line)
+	r.NoError(ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644))
+
+	r.NoError(anchorer.Verify(context.Background(), receipts[0].TxID, digests[0]))
+	err = anchorer.Verify(context.Background(), receipts[3].TxID, digests[3])
+	r.True(errors.Is(err, ErrTxMismatch))
+
+	r.NoError(os.RemoveAll(path))
+}
+
+// devNode is a stand-in of an Ethereum dev node, which mines a block for each transaction after it is polled once
+type devNode struct {
+	mutex   sync.Mutex
+	account string
+	txs     map[string]*devTx
+	blocks  uint64
+}
+
+type devTx struct {
+	input string
+	block uint64
+	mined bool
+}
+
+func newDevNode(account string) *httptest.Server {
+	node := &devNode{account: account, txs: make(map[string]*devTx)}
+	return httptest.NewServer(http.HandlerFunc(node.serve))
+}
+
+func (n *devNode) serve(w http.ResponseWriter, req *http.Request) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var msg struct {
+		ID     uint64            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	var rpcErr interface{}
+	switch msg.Method {
+	case "eth_sendTransaction":
+		var tx map[string]string
+		_ = json.Unmarshal(msg.Params[0], &tx)
+		if tx["from"] != n.account {
+			rpcErr = map[string]interface{}{"code": -32000, "message": "unknown account"}
+			break
+		}
+
+		id := fmt.Sprintf("0x%064x", len(n.txs)+1)
+		n.txs[id] = &devTx{input: tx["data"]}
+		result = id
+	case "eth_getTransactionReceipt":
+		var id string
+		_ = json.Unmarshal(msg.Params[0], &id)
+		if tx, ok := n.txs[id]; ok {
+			if !tx.mined {
+				// pending at the first poll
+				tx.mined = true
+				n.blocks++
+				tx.block = n.blocks
+			} else {
+				result = map[string]string{"blockNumber": fmt.Sprintf("0x%x", tx.block), "status": "0x1"}
+			}
+		}
+	case "eth_getBlockByNumber":
+		result = map[string]string{"timestamp": fmt.Sprintf("0x%x", time.Now().Unix())}
+	case "eth_getTransactionByHash":
+		var id string
+		_ = json.Unmarshal(msg.Params[0], &id)
+		if tx, ok := n.txs[id]; ok && tx.mined {
+			result = map[string]string{"blockNumber": fmt.Sprintf("0x%x", tx.block), "input": tx.input}
+		}
+	default:
+		rpcErr = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result}
+	if rpcErr != nil {
+		resp = map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "error": rpcErr}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func TestEthereum(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	account := "0x00000000000000000000000000000000000000aa"
+	node := newDevNode(account)
+	defer node.Close()
+
+	anchorer, err := Open(node.URL, account)
+	r.NoError(err)
+	r.Equal(EthereumLedgerName, anchorer.Ledger())
+	anchorer.(*Ethereum).pollInterval = time.Millisecond
+
+	digest := make([]byte, 32)
+	rand.Read(digest)
+
+	receipt, err := anchorer.Submit(context.Background(), digest)
+	r.NoError(err)
+	r.EqualValues(1, receipt.Block)
+	r.NoError(anchorer.Verify(context.Background(), receipt.TxID, digest))
+
+	other := make([]byte, 32)
+	rand.Read(other)
+	err = anchorer.Verify(context.Background(), receipt.TxID, other)
+	r.True(errors.Is(err, ErrTxMismatch))
+
+	err = anchorer.Verify(context.Background(), "0x01", digest)
+	r.True(errors.Is(err, ErrTxNotFound))
+
+	// transactions can't be sent from an account unknown to the node
+	_, err = NewEthereum(node.URL, "0x00000000000000000000000000000000000000bb").Submit(context.Background(), digest)
+	r.Error(err)
+
+	_, err = NewEthereum(node.URL, "").Submit(context.Background(), digest)
+	r.Error(err)
+}
+
+func TestService(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	path := filepath.Join(os.TempDir(), "upchain_ledger.jsonl")
+	r.NoError(os.RemoveAll(path))
+
+	ledger, err := NewFileLedger(path)
+	r.NoError(err)
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+
+	service := NewService(merkle, ledger, time.Hour, zap.NewNop().Sugar())
+
+	_, err = service.Anchor()
+	r.True(errors.Is(err, storage.ErrEmpty))
+
+	for i := 0; i < 3; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err = merkle.Append(hash)
+		r.NoError(err)
+	}
+
+	anchor, err := service.Anchor()
+	r.NoError(err)
+	r.EqualValues(3, anchor.Leaves)
+	r.NoError(ledger.Verify(context.Background(), anchor.TxID, anchor.Digest))
+
+	// an unchanged digest is not anchored again
+	again, err := service.Anchor()
+	r.NoError(err)
+	r.Equal(anchor.TxID, again.TxID)
+
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	_, err = merkle.Append(hash)
+	r.NoError(err)
+
+	service = NewService(merkle, ledger, 10*time.Millisecond, zap.NewNop().Sugar())
+	service.Start()
+	r.Eventually(func() bool {
+		latest, err := merkle.LatestAnchor()
+		return err == nil && latest.Leaves == 4
+	}, time.Second, 10*time.Millisecond)
+	service.Stop()
+
+	found, err := merkle.GetAnchor(2)
+	r.NoError(err)
+	r.Equal(anchor.TxID, found.TxID)
+
+	found, err = merkle.GetAnchor(3)
+	r.NoError(err)
+	r.EqualValues(1, found.Block)
+
+	r.NoError(merkle.Close())
+	r.NoError(os.RemoveAll(path))
+}
@@ -0,0 +1,180 @@
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// receiptPollInterval is the interval to poll the receipt of a pending transaction
+const receiptPollInterval = time.Second
+
+// Ethereum anchors digests by the JSON-RPC API of an Ethereum node. A digest is the data of a transaction with no
+// value from the account to itself, which is signed by the node, so the account should be unlocked in the node.
+type Ethereum struct {
+	url          string
+	account      string
+	client       *http.Client
+	pollInterval time.Duration
+	requestID    uint64
+}
+
+// NewEthereum returns an anchorer of the Ethereum node at url, which sends transactions from account
+func NewEthereum(url, account string) *Ethereum {
+	return &Ethereum{url: url, account: account, client: &http.Client{}, pollInterval: receiptPollInterval}
+}
+
+// Ledger returns the name of Ethereum ledger
+func (e *Ethereum) Ledger() string {
+	return EthereumLedgerName
+}
+
+// Submit sends the transaction of digest and waits until it is mined
+func (e *Ethereum) Submit(ctx context.Context, digest []byte) (*Receipt, error) {
+	if e.account == "" {
+		return nil, fmt.Errorf("no ethereum account to send transactions")
+	}
+
+	tx := map[string]string{
+		"from":  e.account,
+		"to":    e.account,
+		"value": "0x0",
+		"data":  "0x" + hex.EncodeToString(digest),
+	}
+
+	var txID string
+	if err := e.call(ctx, "eth_sendTransaction", []interface{}{tx}, &txID); err != nil {
+		return nil, err
+	}
+
+	var receipt *struct {
+		BlockNumber string `json:"blockNumber"`
+		Status      string `json:"status"`
+	}
+	for {
+		if err := e.call(ctx, "eth_getTransactionReceipt", []interface{}{txID}, &receipt); err != nil {
+			return nil, err
+		}
+
+		if receipt != nil && receipt.BlockNumber != "" {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("transaction %s is not mined: %w", txID, ctx.Err())
+		case <-time.After(e.pollInterval):
+		}
+	}
+
+	// status is only missing before Byzantium
+	if receipt.Status == "0x0" {
+		return nil, fmt.Errorf("transaction %s failed", txID)
+	}
+
+	number, err := parseQuantity(receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := e.call(ctx, "eth_getBlockByNumber", []interface{}{receipt.BlockNumber, false}, &block); err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("block %d of transaction %s not found", number, txID)
+	}
+
+	timestamp, err := parseQuantity(block.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receipt{TxID: txID, Block: number, Time: time.Unix(int64(timestamp), 0)}, nil
+}
+
+// Verify checks that the transaction of certain id is mined with the digest as data
+func (e *Ethereum) Verify(ctx context.Context, txID string, digest []byte) error {
+	var tx *struct {
+		BlockNumber *string `json:"blockNumber"`
+		Input       string  `json:"input"`
+	}
+	if err := e.call(ctx, "eth_getTransactionByHash", []interface{}{txID}, &tx); err != nil {
+		return err
+	}
+
+	if tx == nil || tx.BlockNumber == nil {
+		return fmt.Errorf("%w: %s", ErrTxNotFound, txID)
+	}
+
+	if !strings.EqualFold(tx.Input, "0x"+hex.EncodeToString(digest)) {
+		return fmt.Errorf("%w: transaction %s carries data %s", ErrTxMismatch, txID, tx.Input)
+	}
+
+	return nil
+}
+
+// call invokes a JSON-RPC method and decodes the result
+func (e *Ethereum) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      atomic.AddUint64(&e.requestID, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: http status %s", method, resp.Status)
+	}
+
+	var msg struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	if msg.Error != nil {
+		return fmt.Errorf("%s: %s (%d)", method, msg.Error.Message, msg.Error.Code)
+	}
+
+	return json.Unmarshal(msg.Result, result)
+}
+
+// parseQuantity parses a quantity of JSON-RPC API in hex with 0x prefix
+func parseQuantity(quantity string) (uint64, error) {
+	if !strings.HasPrefix(quantity, "0x") {
+		return 0, fmt.Errorf("invalid quantity %s", quantity)
+	}
+
+	return strconv.ParseUint(quantity[2:], 16, 64)
+}
@@ -0,0 +1,171 @@
+package anchor
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileLedger simulates a ledger by a local file, where each line is a block of one transaction in JSON. Transactions
+// are chained by hashes, so that a modified block breaks the ids of all later transactions.
+type FileLedger struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// fileBlock is a line of file ledger
+type fileBlock struct {
+	Block  uint64 `json:"block"`
+	TxID   string `json:"tx"`
+	Digest string `json:"digest"`
+	Time   int64  `json:"time"`
+}
+
+// NewFileLedger returns a file ledger, and the file is created if it does not exist
+func NewFileLedger(path string) (*FileLedger, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileLedger{path: path}, file.Close()
+}
+
+// Ledger returns the name of file ledger
+func (l *FileLedger) Ledger() string {
+	return FileLedgerName
+}
+
+// Submit appends the digest in a new block, which is accepted once the file is synced
+func (l *FileLedger) Submit(ctx context.Context, digest []byte) (*Receipt, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	blocks, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var prev []byte
+	if len(blocks) > 0 {
+		prev, _ = hex.DecodeString(blocks[len(blocks)-1].TxID)
+	}
+
+	now := time.Now()
+	block := fileBlock{
+		Block:  uint64(len(blocks)),
+		TxID:   hex.EncodeToString(fileTxID(prev, digest, now.UnixNano())),
+		Digest: hex.EncodeToString(digest),
+		Time:   now.UnixNano(),
+	}
+
+	line, err := json.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	return &Receipt{TxID: block.TxID, Block: block.Block, Time: time.Unix(0, block.Time)}, nil
+}
+
+// Verify checks the chain of transactions up to the one of certain id, and that it carries the digest
+func (l *FileLedger) Verify(ctx context.Context, txID string, digest []byte) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	blocks, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	var prev []byte
+	for _, block := range blocks {
+		blockDigest, err := hex.DecodeString(block.Digest)
+		if err != nil {
+			return fmt.Errorf("invalid digest of block %d: %w", block.Block, err)
+		}
+
+		id := hex.EncodeToString(fileTxID(prev, blockDigest, block.Time))
+		if id != block.TxID {
+			return fmt.Errorf("%w: broken chain at block %d", ErrTxMismatch, block.Block)
+		}
+
+		if id == txID {
+			if block.Digest != hex.EncodeToString(digest) {
+				return fmt.Errorf("%w: transaction %s carries digest %s", ErrTxMismatch, txID, block.Digest)
+			}
+
+			return nil
+		}
+
+		prev, _ = hex.DecodeString(id)
+	}
+
+	return fmt.Errorf("%w: %s", ErrTxNotFound, txID)
+}
+
+// read reads all blocks of file ledger.
+// mutex should be used when a function calls read()
+func (l *FileLedger) read() ([]fileBlock, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var blocks []fileBlock
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var block fileBlock
+		if err := json.Unmarshal(scanner.Bytes(), &block); err != nil {
+			return nil, fmt.Errorf("invalid block %d: %w", len(blocks), err)
+		}
+
+		if block.Block != uint64(len(blocks)) {
+			return nil, fmt.Errorf("%w: block %d at height %d", ErrTxMismatch, block.Block, len(blocks))
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks, scanner.Err()
+}
+
+// fileTxID hashes the previous transaction id, the digest and the time in nanoseconds as transaction id
+func fileTxID(prev, digest []byte, nanos int64) []byte {
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, uint64(nanos))
+
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(digest)
+	h.Write(timestamp)
+	return h.Sum(nil)
+}
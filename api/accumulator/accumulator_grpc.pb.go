@@ -20,13 +20,58 @@ const _ = grpc.SupportPackageIsVersion7
 type AccumulatorClient interface {
 	// Append a new hash
 	Append(ctx context.Context, in *Hash, opts ...grpc.CallOption) (*ID, error)
+	// Append a new hash and prove it to the digest right after appending, which is indexed as the latest digest
+	AppendWithReceipt(ctx context.Context, in *Hash, opts ...grpc.CallOption) (*Receipt, error)
+	// Append hashes in one batch and return the range of their ids
+	AppendBatch(ctx context.Context, in *Hashes, opts ...grpc.CallOption) (*IDRange, error)
+	// Append hashes streamed by the client in batches, and stream their ids back in the order of hashes. The namespace
+	// is read from the first hash. A failed hash ends the stream with its error after ids of all appended hashes.
+	AppendStream(ctx context.Context, opts ...grpc.CallOption) (Accumulator_AppendStreamClient, error)
+	// Append the hash of content streamed in chunks, which is hashed by the server with the hash algorithm of
+	// accumulator. Namespace and metadata are only read from the first chunk.
+	AppendData(ctx context.Context, opts ...grpc.CallOption) (Accumulator_AppendDataClient, error)
 	Get(ctx context.Context, in *ID, opts ...grpc.CallOption) (*Hash, error)
+	// Search the oldest leaf of a hash
 	Search(ctx context.Context, in *Hash, opts ...grpc.CallOption) (*ID, error)
-	GetDigest(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Hash, error)
+	// Search all leaves of a hash page by page in the order of appending
+	SearchAll(ctx context.Context, in *SearchAllRequest, opts ...grpc.CallOption) (*SearchAllResponse, error)
+	GetDigest(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Hash, error)
+	// Get the digest when the tree had certain size, which is indexed for later requests by digest
+	GetDigestAt(ctx context.Context, in *TreeSize, opts ...grpc.CallOption) (*Hash, error)
+	// List checkpoints of indexed digests page by page in the order of indexing
+	ListDigests(ctx context.Context, in *ListDigestsRequest, opts ...grpc.CallOption) (*ListDigestsResponse, error)
+	// Get the last recorded checkpoint, which is cheap and made regularly by a server with a checkpoint policy
+	GetLatestCheckpoint(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Checkpoint, error)
+	// Stream leaves from the start id, and then every new leaf once it is appended until the client cancels
+	WatchLeaves(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Accumulator_WatchLeavesClient, error)
+	// Stream checkpoints from the start index, and then every new checkpoint once it is recorded until the client cancels
+	WatchDigests(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Accumulator_WatchDigestsClient, error)
+	// Get the earliest anchor on external ledger whose digest includes the leaf of id
+	GetAnchor(ctx context.Context, in *ID, opts ...grpc.CallOption) (*Anchor, error)
 	GetProofByID(ctx context.Context, in *ID, opts ...grpc.CallOption) (*HashProof, error)
 	GetProofByHash(ctx context.Context, in *Hash, opts ...grpc.CallOption) (*HashProof, error)
 	GetOldProofByID(ctx context.Context, in *GetOldProofByIDRequest, opts ...grpc.CallOption) (*HashProof, error)
 	GetOldProofByHash(ctx context.Context, in *GetOldProofByHashRequest, opts ...grpc.CallOption) (*HashProof, error)
+	// Prove a node to the digest when the tree had certain size
+	GetProofAt(ctx context.Context, in *GetProofAtRequest, opts ...grpc.CallOption) (*HashProof, error)
+	// Prove that the tree of old digest is a prefix of the tree of new digest
+	GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*ConsistencyProof, error)
+	// Prove several leaves to one digest with shared siblings, the latest digest is used if digest is empty
+	GetMultiProof(ctx context.Context, in *GetMultiProofRequest, opts ...grpc.CallOption) (*MultiProof, error)
+	// Prove all leaves in [start, end) to one digest, the latest digest is used if digest is empty.
+	// The proof is streamed in chunks of leaves, which should be merged in order. A range of more than 65536 leaves is
+	// rejected, so that a longer range should be proved piece by piece.
+	GetRangeProof(ctx context.Context, in *GetRangeProofRequest, opts ...grpc.CallOption) (Accumulator_GetRangeProofClient, error)
+	// Get how the merkle tree is hashed, so that clients verify proofs with the same functions
+	GetInfo(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Info, error)
+	// Get the published public keys of the server, which verify signed tree heads including those by retired keys
+	GetKeys(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*KeySet, error)
+	// Create a namespace with a new accumulator, the default tree mode and hash algorithm are used if empty
+	CreateNamespace(ctx context.Context, in *CreateNamespaceRequest, opts ...grpc.CallOption) (*Info, error)
+	// List namespaces without the default one
+	ListNamespaces(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Namespaces, error)
+	// Delete a namespace with all data of its accumulator
+	DeleteNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Empty, error)
 }
 
 type accumulatorClient struct {
@@ -46,6 +91,89 @@ func (c *accumulatorClient) Append(ctx context.Context, in *Hash, opts ...grpc.C
 	return out, nil
 }
 
+func (c *accumulatorClient) AppendWithReceipt(ctx context.Context, in *Hash, opts ...grpc.CallOption) (*Receipt, error) {
+	out := new(Receipt)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/AppendWithReceipt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) AppendBatch(ctx context.Context, in *Hashes, opts ...grpc.CallOption) (*IDRange, error) {
+	out := new(IDRange)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/AppendBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) AppendStream(ctx context.Context, opts ...grpc.CallOption) (Accumulator_AppendStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Accumulator_ServiceDesc.Streams[0], "/accumulator.Accumulator/AppendStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &accumulatorAppendStreamClient{stream}
+	return x, nil
+}
+
+type Accumulator_AppendStreamClient interface {
+	Send(*Hash) error
+	Recv() (*ID, error)
+	grpc.ClientStream
+}
+
+type accumulatorAppendStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *accumulatorAppendStreamClient) Send(m *Hash) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *accumulatorAppendStreamClient) Recv() (*ID, error) {
+	m := new(ID)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *accumulatorClient) AppendData(ctx context.Context, opts ...grpc.CallOption) (Accumulator_AppendDataClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Accumulator_ServiceDesc.Streams[1], "/accumulator.Accumulator/AppendData", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &accumulatorAppendDataClient{stream}
+	return x, nil
+}
+
+type Accumulator_AppendDataClient interface {
+	Send(*Data) error
+	CloseAndRecv() (*AppendDataResponse, error)
+	grpc.ClientStream
+}
+
+type accumulatorAppendDataClient struct {
+	grpc.ClientStream
+}
+
+func (x *accumulatorAppendDataClient) Send(m *Data) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *accumulatorAppendDataClient) CloseAndRecv() (*AppendDataResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(AppendDataResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *accumulatorClient) Get(ctx context.Context, in *ID, opts ...grpc.CallOption) (*Hash, error) {
 	out := new(Hash)
 	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/Get", in, out, opts...)
@@ -64,7 +192,16 @@ func (c *accumulatorClient) Search(ctx context.Context, in *Hash, opts ...grpc.C
 	return out, nil
 }
 
-func (c *accumulatorClient) GetDigest(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Hash, error) {
+func (c *accumulatorClient) SearchAll(ctx context.Context, in *SearchAllRequest, opts ...grpc.CallOption) (*SearchAllResponse, error) {
+	out := new(SearchAllResponse)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/SearchAll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) GetDigest(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Hash, error) {
 	out := new(Hash)
 	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetDigest", in, out, opts...)
 	if err != nil {
@@ -73,6 +210,106 @@ func (c *accumulatorClient) GetDigest(ctx context.Context, in *Empty, opts ...gr
 	return out, nil
 }
 
+func (c *accumulatorClient) GetDigestAt(ctx context.Context, in *TreeSize, opts ...grpc.CallOption) (*Hash, error) {
+	out := new(Hash)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetDigestAt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) ListDigests(ctx context.Context, in *ListDigestsRequest, opts ...grpc.CallOption) (*ListDigestsResponse, error) {
+	out := new(ListDigestsResponse)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/ListDigests", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) GetLatestCheckpoint(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Checkpoint, error) {
+	out := new(Checkpoint)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetLatestCheckpoint", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) WatchLeaves(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Accumulator_WatchLeavesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Accumulator_ServiceDesc.Streams[2], "/accumulator.Accumulator/WatchLeaves", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &accumulatorWatchLeavesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Accumulator_WatchLeavesClient interface {
+	Recv() (*Leaf, error)
+	grpc.ClientStream
+}
+
+type accumulatorWatchLeavesClient struct {
+	grpc.ClientStream
+}
+
+func (x *accumulatorWatchLeavesClient) Recv() (*Leaf, error) {
+	m := new(Leaf)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *accumulatorClient) WatchDigests(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Accumulator_WatchDigestsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Accumulator_ServiceDesc.Streams[3], "/accumulator.Accumulator/WatchDigests", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &accumulatorWatchDigestsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Accumulator_WatchDigestsClient interface {
+	Recv() (*Checkpoint, error)
+	grpc.ClientStream
+}
+
+type accumulatorWatchDigestsClient struct {
+	grpc.ClientStream
+}
+
+func (x *accumulatorWatchDigestsClient) Recv() (*Checkpoint, error) {
+	m := new(Checkpoint)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *accumulatorClient) GetAnchor(ctx context.Context, in *ID, opts ...grpc.CallOption) (*Anchor, error) {
+	out := new(Anchor)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetAnchor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *accumulatorClient) GetProofByID(ctx context.Context, in *ID, opts ...grpc.CallOption) (*HashProof, error) {
 	out := new(HashProof)
 	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetProofByID", in, out, opts...)
@@ -109,19 +346,168 @@ func (c *accumulatorClient) GetOldProofByHash(ctx context.Context, in *GetOldPro
 	return out, nil
 }
 
+func (c *accumulatorClient) GetProofAt(ctx context.Context, in *GetProofAtRequest, opts ...grpc.CallOption) (*HashProof, error) {
+	out := new(HashProof)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetProofAt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*ConsistencyProof, error) {
+	out := new(ConsistencyProof)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetConsistencyProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) GetMultiProof(ctx context.Context, in *GetMultiProofRequest, opts ...grpc.CallOption) (*MultiProof, error) {
+	out := new(MultiProof)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetMultiProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) GetRangeProof(ctx context.Context, in *GetRangeProofRequest, opts ...grpc.CallOption) (Accumulator_GetRangeProofClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Accumulator_ServiceDesc.Streams[4], "/accumulator.Accumulator/GetRangeProof", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &accumulatorGetRangeProofClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Accumulator_GetRangeProofClient interface {
+	Recv() (*RangeProof, error)
+	grpc.ClientStream
+}
+
+type accumulatorGetRangeProofClient struct {
+	grpc.ClientStream
+}
+
+func (x *accumulatorGetRangeProofClient) Recv() (*RangeProof, error) {
+	m := new(RangeProof)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *accumulatorClient) GetInfo(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Info, error) {
+	out := new(Info)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) GetKeys(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*KeySet, error) {
+	out := new(KeySet)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/GetKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) CreateNamespace(ctx context.Context, in *CreateNamespaceRequest, opts ...grpc.CallOption) (*Info, error) {
+	out := new(Info)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/CreateNamespace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) ListNamespaces(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Namespaces, error) {
+	out := new(Namespaces)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/ListNamespaces", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accumulatorClient) DeleteNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/accumulator.Accumulator/DeleteNamespace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AccumulatorServer is the server API for Accumulator service.
 // All implementations must embed UnimplementedAccumulatorServer
 // for forward compatibility
 type AccumulatorServer interface {
 	// Append a new hash
 	Append(context.Context, *Hash) (*ID, error)
+	// Append a new hash and prove it to the digest right after appending, which is indexed as the latest digest
+	AppendWithReceipt(context.Context, *Hash) (*Receipt, error)
+	// Append hashes in one batch and return the range of their ids
+	AppendBatch(context.Context, *Hashes) (*IDRange, error)
+	// Append hashes streamed by the client in batches, and stream their ids back in the order of hashes. The namespace
+	// is read from the first hash. A failed hash ends the stream with its error after ids of all appended hashes.
+	AppendStream(Accumulator_AppendStreamServer) error
+	// Append the hash of content streamed in chunks, which is hashed by the server with the hash algorithm of
+	// accumulator. Namespace and metadata are only read from the first chunk.
+	AppendData(Accumulator_AppendDataServer) error
 	Get(context.Context, *ID) (*Hash, error)
+	// Search the oldest leaf of a hash
 	Search(context.Context, *Hash) (*ID, error)
-	GetDigest(context.Context, *Empty) (*Hash, error)
+	// Search all leaves of a hash page by page in the order of appending
+	SearchAll(context.Context, *SearchAllRequest) (*SearchAllResponse, error)
+	GetDigest(context.Context, *Namespace) (*Hash, error)
+	// Get the digest when the tree had certain size, which is indexed for later requests by digest
+	GetDigestAt(context.Context, *TreeSize) (*Hash, error)
+	// List checkpoints of indexed digests page by page in the order of indexing
+	ListDigests(context.Context, *ListDigestsRequest) (*ListDigestsResponse, error)
+	// Get the last recorded checkpoint, which is cheap and made regularly by a server with a checkpoint policy
+	GetLatestCheckpoint(context.Context, *Namespace) (*Checkpoint, error)
+	// Stream leaves from the start id, and then every new leaf once it is appended until the client cancels
+	WatchLeaves(*WatchRequest, Accumulator_WatchLeavesServer) error
+	// Stream checkpoints from the start index, and then every new checkpoint once it is recorded until the client cancels
+	WatchDigests(*WatchRequest, Accumulator_WatchDigestsServer) error
+	// Get the earliest anchor on external ledger whose digest includes the leaf of id
+	GetAnchor(context.Context, *ID) (*Anchor, error)
 	GetProofByID(context.Context, *ID) (*HashProof, error)
 	GetProofByHash(context.Context, *Hash) (*HashProof, error)
 	GetOldProofByID(context.Context, *GetOldProofByIDRequest) (*HashProof, error)
 	GetOldProofByHash(context.Context, *GetOldProofByHashRequest) (*HashProof, error)
+	// Prove a node to the digest when the tree had certain size
+	GetProofAt(context.Context, *GetProofAtRequest) (*HashProof, error)
+	// Prove that the tree of old digest is a prefix of the tree of new digest
+	GetConsistencyProof(context.Context, *GetConsistencyProofRequest) (*ConsistencyProof, error)
+	// Prove several leaves to one digest with shared siblings, the latest digest is used if digest is empty
+	GetMultiProof(context.Context, *GetMultiProofRequest) (*MultiProof, error)
+	// Prove all leaves in [start, end) to one digest, the latest digest is used if digest is empty.
+	// The proof is streamed in chunks of leaves, which should be merged in order. A range of more than 65536 leaves is
+	// rejected, so that a longer range should be proved piece by piece.
+	GetRangeProof(*GetRangeProofRequest, Accumulator_GetRangeProofServer) error
+	// Get how the merkle tree is hashed, so that clients verify proofs with the same functions
+	GetInfo(context.Context, *Namespace) (*Info, error)
+	// Get the published public keys of the server, which verify signed tree heads including those by retired keys
+	GetKeys(context.Context, *Empty) (*KeySet, error)
+	// Create a namespace with a new accumulator, the default tree mode and hash algorithm are used if empty
+	CreateNamespace(context.Context, *CreateNamespaceRequest) (*Info, error)
+	// List namespaces without the default one
+	ListNamespaces(context.Context, *Empty) (*Namespaces, error)
+	// Delete a namespace with all data of its accumulator
+	DeleteNamespace(context.Context, *Namespace) (*Empty, error)
 	mustEmbedUnimplementedAccumulatorServer()
 }
 
@@ -132,15 +518,48 @@ type UnimplementedAccumulatorServer struct {
 func (UnimplementedAccumulatorServer) Append(context.Context, *Hash) (*ID, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Append not implemented")
 }
+func (UnimplementedAccumulatorServer) AppendWithReceipt(context.Context, *Hash) (*Receipt, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendWithReceipt not implemented")
+}
+func (UnimplementedAccumulatorServer) AppendBatch(context.Context, *Hashes) (*IDRange, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendBatch not implemented")
+}
+func (UnimplementedAccumulatorServer) AppendStream(Accumulator_AppendStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method AppendStream not implemented")
+}
+func (UnimplementedAccumulatorServer) AppendData(Accumulator_AppendDataServer) error {
+	return status.Errorf(codes.Unimplemented, "method AppendData not implemented")
+}
 func (UnimplementedAccumulatorServer) Get(context.Context, *ID) (*Hash, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
 func (UnimplementedAccumulatorServer) Search(context.Context, *Hash) (*ID, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
 }
-func (UnimplementedAccumulatorServer) GetDigest(context.Context, *Empty) (*Hash, error) {
+func (UnimplementedAccumulatorServer) SearchAll(context.Context, *SearchAllRequest) (*SearchAllResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchAll not implemented")
+}
+func (UnimplementedAccumulatorServer) GetDigest(context.Context, *Namespace) (*Hash, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetDigest not implemented")
 }
+func (UnimplementedAccumulatorServer) GetDigestAt(context.Context, *TreeSize) (*Hash, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDigestAt not implemented")
+}
+func (UnimplementedAccumulatorServer) ListDigests(context.Context, *ListDigestsRequest) (*ListDigestsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDigests not implemented")
+}
+func (UnimplementedAccumulatorServer) GetLatestCheckpoint(context.Context, *Namespace) (*Checkpoint, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatestCheckpoint not implemented")
+}
+func (UnimplementedAccumulatorServer) WatchLeaves(*WatchRequest, Accumulator_WatchLeavesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchLeaves not implemented")
+}
+func (UnimplementedAccumulatorServer) WatchDigests(*WatchRequest, Accumulator_WatchDigestsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDigests not implemented")
+}
+func (UnimplementedAccumulatorServer) GetAnchor(context.Context, *ID) (*Anchor, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAnchor not implemented")
+}
 func (UnimplementedAccumulatorServer) GetProofByID(context.Context, *ID) (*HashProof, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetProofByID not implemented")
 }
@@ -153,6 +572,33 @@ func (UnimplementedAccumulatorServer) GetOldProofByID(context.Context, *GetOldPr
 func (UnimplementedAccumulatorServer) GetOldProofByHash(context.Context, *GetOldProofByHashRequest) (*HashProof, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetOldProofByHash not implemented")
 }
+func (UnimplementedAccumulatorServer) GetProofAt(context.Context, *GetProofAtRequest) (*HashProof, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProofAt not implemented")
+}
+func (UnimplementedAccumulatorServer) GetConsistencyProof(context.Context, *GetConsistencyProofRequest) (*ConsistencyProof, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConsistencyProof not implemented")
+}
+func (UnimplementedAccumulatorServer) GetMultiProof(context.Context, *GetMultiProofRequest) (*MultiProof, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMultiProof not implemented")
+}
+func (UnimplementedAccumulatorServer) GetRangeProof(*GetRangeProofRequest, Accumulator_GetRangeProofServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetRangeProof not implemented")
+}
+func (UnimplementedAccumulatorServer) GetInfo(context.Context, *Namespace) (*Info, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
+}
+func (UnimplementedAccumulatorServer) GetKeys(context.Context, *Empty) (*KeySet, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetKeys not implemented")
+}
+func (UnimplementedAccumulatorServer) CreateNamespace(context.Context, *CreateNamespaceRequest) (*Info, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateNamespace not implemented")
+}
+func (UnimplementedAccumulatorServer) ListNamespaces(context.Context, *Empty) (*Namespaces, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNamespaces not implemented")
+}
+func (UnimplementedAccumulatorServer) DeleteNamespace(context.Context, *Namespace) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteNamespace not implemented")
+}
 func (UnimplementedAccumulatorServer) mustEmbedUnimplementedAccumulatorServer() {}
 
 // UnsafeAccumulatorServer may be embedded to opt out of forward compatibility for this service.
@@ -184,6 +630,94 @@ func _Accumulator_Append_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Accumulator_AppendWithReceipt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Hash)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).AppendWithReceipt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/AppendWithReceipt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).AppendWithReceipt(ctx, req.(*Hash))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_AppendBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Hashes)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).AppendBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/AppendBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).AppendBatch(ctx, req.(*Hashes))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_AppendStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AccumulatorServer).AppendStream(&accumulatorAppendStreamServer{stream})
+}
+
+type Accumulator_AppendStreamServer interface {
+	Send(*ID) error
+	Recv() (*Hash, error)
+	grpc.ServerStream
+}
+
+type accumulatorAppendStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *accumulatorAppendStreamServer) Send(m *ID) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *accumulatorAppendStreamServer) Recv() (*Hash, error) {
+	m := new(Hash)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Accumulator_AppendData_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AccumulatorServer).AppendData(&accumulatorAppendDataServer{stream})
+}
+
+type Accumulator_AppendDataServer interface {
+	SendAndClose(*AppendDataResponse) error
+	Recv() (*Data, error)
+	grpc.ServerStream
+}
+
+type accumulatorAppendDataServer struct {
+	grpc.ServerStream
+}
+
+func (x *accumulatorAppendDataServer) SendAndClose(m *AppendDataResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *accumulatorAppendDataServer) Recv() (*Data, error) {
+	m := new(Data)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _Accumulator_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ID)
 	if err := dec(in); err != nil {
@@ -220,8 +754,26 @@ func _Accumulator_Search_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Accumulator_SearchAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).SearchAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/SearchAll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).SearchAll(ctx, req.(*SearchAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Accumulator_GetDigest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Empty)
+	in := new(Namespace)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -233,7 +785,121 @@ func _Accumulator_GetDigest_Handler(srv interface{}, ctx context.Context, dec fu
 		FullMethod: "/accumulator.Accumulator/GetDigest",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AccumulatorServer).GetDigest(ctx, req.(*Empty))
+		return srv.(AccumulatorServer).GetDigest(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_GetDigestAt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TreeSize)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetDigestAt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetDigestAt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetDigestAt(ctx, req.(*TreeSize))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_ListDigests_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDigestsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).ListDigests(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/ListDigests",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).ListDigests(ctx, req.(*ListDigestsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_GetLatestCheckpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Namespace)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetLatestCheckpoint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetLatestCheckpoint",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetLatestCheckpoint(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_WatchLeaves_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AccumulatorServer).WatchLeaves(m, &accumulatorWatchLeavesServer{stream})
+}
+
+type Accumulator_WatchLeavesServer interface {
+	Send(*Leaf) error
+	grpc.ServerStream
+}
+
+type accumulatorWatchLeavesServer struct {
+	grpc.ServerStream
+}
+
+func (x *accumulatorWatchLeavesServer) Send(m *Leaf) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Accumulator_WatchDigests_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AccumulatorServer).WatchDigests(m, &accumulatorWatchDigestsServer{stream})
+}
+
+type Accumulator_WatchDigestsServer interface {
+	Send(*Checkpoint) error
+	grpc.ServerStream
+}
+
+type accumulatorWatchDigestsServer struct {
+	grpc.ServerStream
+}
+
+func (x *accumulatorWatchDigestsServer) Send(m *Checkpoint) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Accumulator_GetAnchor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetAnchor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetAnchor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetAnchor(ctx, req.(*ID))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -310,6 +976,171 @@ func _Accumulator_GetOldProofByHash_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Accumulator_GetProofAt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProofAtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetProofAt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetProofAt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetProofAt(ctx, req.(*GetProofAtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_GetConsistencyProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConsistencyProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetConsistencyProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetConsistencyProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetConsistencyProof(ctx, req.(*GetConsistencyProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_GetMultiProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMultiProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetMultiProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetMultiProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetMultiProof(ctx, req.(*GetMultiProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_GetRangeProof_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetRangeProofRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AccumulatorServer).GetRangeProof(m, &accumulatorGetRangeProofServer{stream})
+}
+
+type Accumulator_GetRangeProofServer interface {
+	Send(*RangeProof) error
+	grpc.ServerStream
+}
+
+type accumulatorGetRangeProofServer struct {
+	grpc.ServerStream
+}
+
+func (x *accumulatorGetRangeProofServer) Send(m *RangeProof) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Accumulator_GetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Namespace)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetInfo(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_GetKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).GetKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/GetKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).GetKeys(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_CreateNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateNamespaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).CreateNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/CreateNamespace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).CreateNamespace(ctx, req.(*CreateNamespaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_ListNamespaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).ListNamespaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/ListNamespaces",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).ListNamespaces(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Accumulator_DeleteNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Namespace)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccumulatorServer).DeleteNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/accumulator.Accumulator/DeleteNamespace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccumulatorServer).DeleteNamespace(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Accumulator_ServiceDesc is the grpc.ServiceDesc for Accumulator service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -321,6 +1152,14 @@ var Accumulator_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Append",
 			Handler:    _Accumulator_Append_Handler,
 		},
+		{
+			MethodName: "AppendWithReceipt",
+			Handler:    _Accumulator_AppendWithReceipt_Handler,
+		},
+		{
+			MethodName: "AppendBatch",
+			Handler:    _Accumulator_AppendBatch_Handler,
+		},
 		{
 			MethodName: "Get",
 			Handler:    _Accumulator_Get_Handler,
@@ -329,10 +1168,30 @@ var Accumulator_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Search",
 			Handler:    _Accumulator_Search_Handler,
 		},
+		{
+			MethodName: "SearchAll",
+			Handler:    _Accumulator_SearchAll_Handler,
+		},
 		{
 			MethodName: "GetDigest",
 			Handler:    _Accumulator_GetDigest_Handler,
 		},
+		{
+			MethodName: "GetDigestAt",
+			Handler:    _Accumulator_GetDigestAt_Handler,
+		},
+		{
+			MethodName: "ListDigests",
+			Handler:    _Accumulator_ListDigests_Handler,
+		},
+		{
+			MethodName: "GetLatestCheckpoint",
+			Handler:    _Accumulator_GetLatestCheckpoint_Handler,
+		},
+		{
+			MethodName: "GetAnchor",
+			Handler:    _Accumulator_GetAnchor_Handler,
+		},
 		{
 			MethodName: "GetProofByID",
 			Handler:    _Accumulator_GetProofByID_Handler,
@@ -349,7 +1208,66 @@ var Accumulator_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetOldProofByHash",
 			Handler:    _Accumulator_GetOldProofByHash_Handler,
 		},
+		{
+			MethodName: "GetProofAt",
+			Handler:    _Accumulator_GetProofAt_Handler,
+		},
+		{
+			MethodName: "GetConsistencyProof",
+			Handler:    _Accumulator_GetConsistencyProof_Handler,
+		},
+		{
+			MethodName: "GetMultiProof",
+			Handler:    _Accumulator_GetMultiProof_Handler,
+		},
+		{
+			MethodName: "GetInfo",
+			Handler:    _Accumulator_GetInfo_Handler,
+		},
+		{
+			MethodName: "GetKeys",
+			Handler:    _Accumulator_GetKeys_Handler,
+		},
+		{
+			MethodName: "CreateNamespace",
+			Handler:    _Accumulator_CreateNamespace_Handler,
+		},
+		{
+			MethodName: "ListNamespaces",
+			Handler:    _Accumulator_ListNamespaces_Handler,
+		},
+		{
+			MethodName: "DeleteNamespace",
+			Handler:    _Accumulator_DeleteNamespace_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AppendStream",
+			Handler:       _Accumulator_AppendStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "AppendData",
+			Handler:       _Accumulator_AppendData_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchLeaves",
+			Handler:       _Accumulator_WatchLeaves_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchDigests",
+			Handler:       _Accumulator_WatchDigests_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetRangeProof",
+			Handler:       _Accumulator_GetRangeProof_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "accumulator.proto",
 }
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/frankonly/upchain/storage"
+)
+
+// CheckpointPolicy decides when the latest digest is checkpointed. Both policies may be used together, and a policy
+// without any of them never checkpoints.
+type CheckpointPolicy struct {
+	// Appends is the number of appended leaves between two checkpoints, disabled if 0
+	Appends uint64
+	// Interval is the time between two checkpoints, disabled if 0
+	Interval time.Duration
+}
+
+// Enabled returns whether the policy checkpoints at all
+func (p CheckpointPolicy) Enabled() bool {
+	return p.Appends > 0 || p.Interval > 0
+}
+
+// Checkpointer indexes the latest digest of accumulator in background by policy, so that the accumulator is
+// checkpointed at a regular cadence even if no client asks for digests
+type Checkpointer struct {
+	accumulator storage.MerkleAccumulator
+	policy      CheckpointPolicy
+	logger      *zap.SugaredLogger
+
+	// appended is the number of leaves appended since the last checkpoint, which is accessed atomically
+	appended uint64
+	trigger  chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCheckpointer returns a checkpointer of accumulator, which runs after Start
+func NewCheckpointer(accumulator storage.MerkleAccumulator, policy CheckpointPolicy, logger *zap.SugaredLogger) *Checkpointer {
+	return &Checkpointer{
+		accumulator: accumulator,
+		policy:      policy,
+		logger:      logger,
+		trigger:     make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start runs checkpointer in background until Stop
+func (c *Checkpointer) Start() {
+	go c.run()
+}
+
+// Stop stops a started checkpointer and waits for the running checkpoint to finish
+func (c *Checkpointer) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+// Appended counts appended leaves, and triggers a checkpoint once there are enough leaves by policy.
+// Appended never blocks.
+func (c *Checkpointer) Appended(count int) {
+	if c.policy.Appends == 0 {
+		return
+	}
+
+	if atomic.AddUint64(&c.appended, uint64(count)) >= c.policy.Appends {
+		select {
+		case c.trigger <- struct{}{}:
+		default:
+			// a checkpoint is already triggered
+		}
+	}
+}
+
+func (c *Checkpointer) run() {
+	defer close(c.done)
+
+	var tick <-chan time.Time
+	if c.policy.Interval > 0 {
+		ticker := time.NewTicker(c.policy.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-tick:
+		case <-c.trigger:
+		}
+
+		c.checkpoint()
+	}
+}
+
+// checkpoint indexes the latest digest, which records a checkpoint of it unless it is already indexed
+func (c *Checkpointer) checkpoint() {
+	atomic.StoreUint64(&c.appended, 0)
+
+	digest, err := c.accumulator.Digest()
+	if errors.Is(err, storage.ErrEmpty) {
+		return
+	} else if err != nil {
+		c.logger.Errorw("failed to checkpoint", "err", err)
+		return
+	}
+
+	c.logger.Debugw("checkpoint", "Digest", hex.EncodeToString(digest))
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/frankonly/upchain/storage"
+)
+
+func TestCheckpointerAppends(t *testing.T) {
+	r := require.New(t)
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+
+	checkpointer := NewCheckpointer(merkle, CheckpointPolicy{Appends: 4}, zap.NewNop().Sugar())
+	checkpointer.Start()
+
+	for i := 0; i < 3; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err := merkle.Append(hash)
+		r.NoError(err)
+		checkpointer.Appended(1)
+	}
+
+	// not enough leaves to checkpoint
+	time.Sleep(50 * time.Millisecond)
+	_, err = merkle.LatestCheckpoint()
+	r.True(errors.Is(err, storage.ErrEmpty))
+
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	_, err = merkle.Append(hash)
+	r.NoError(err)
+	checkpointer.Appended(1)
+
+	r.Eventually(func() bool {
+		latest, err := merkle.LatestCheckpoint()
+		return err == nil && latest.Leaves == 4
+	}, time.Second, 10*time.Millisecond)
+
+	checkpointer.Stop()
+	checkpointer.Stop()
+	r.NoError(merkle.Close())
+}
+
+func TestCheckpointerInterval(t *testing.T) {
+	r := require.New(t)
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+
+	checkpointer := NewCheckpointer(merkle, CheckpointPolicy{Interval: 10 * time.Millisecond}, zap.NewNop().Sugar())
+	checkpointer.Start()
+
+	// an empty accumulator is not checkpointed
+	time.Sleep(50 * time.Millisecond)
+	_, err = merkle.LatestCheckpoint()
+	r.True(errors.Is(err, storage.ErrEmpty))
+
+	hashes := make([][]byte, 5)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendBatch(hashes)
+	r.NoError(err)
+
+	r.Eventually(func() bool {
+		latest, err := merkle.LatestCheckpoint()
+		return err == nil && latest.Leaves == uint64(len(hashes))
+	}, time.Second, 10*time.Millisecond)
+
+	// an unchanged digest is only checkpointed once
+	time.Sleep(50 * time.Millisecond)
+	_, total, err := merkle.ListDigests(0, -1)
+	r.NoError(err)
+	r.EqualValues(1, total)
+
+	checkpointer.Stop()
+	r.NoError(merkle.Close())
+}
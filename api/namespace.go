@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/frankonly/upchain/anchor"
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/storage"
+)
+
+// adminTokenScheme is the authorization scheme of the admin token in metadata
+const adminTokenScheme = "Bearer "
+
+// CreateNamespace creates a namespace with a new accumulator, which uses the default tree mode, hash algorithm and
+// duplicate policy if they are not specified. Only clients with the admin token can create namespaces.
+func (s Server) CreateNamespace(ctx context.Context, in *pb.CreateNamespaceRequest) (*pb.Info, error) {
+	s.infoRequest(apiCreateNamespace, "Namespace", in.Namespace, "TreeMode", in.TreeMode, "HashAlgorithm", in.HashAlgorithm,
+		"DuplicatePolicy", in.DuplicatePolicy)
+
+	if err := s.checkAdmin(ctx); err != nil {
+		s.infoError(apiCreateNamespace, "namespace", in.Namespace, "Error", err)
+		return nil, err
+	}
+
+	var opts []storage.Option
+	if in.TreeMode != "" {
+		mode, err := crypto.ParseTreeMode(in.TreeMode)
+		if err != nil {
+			err = status.Error(codes.InvalidArgument, err.Error())
+			s.infoError(apiCreateNamespace, "namespace", in.Namespace, "Error", err)
+			return nil, err
+		}
+		opts = append(opts, storage.WithTreeMode(mode))
+	}
+
+	if in.HashAlgorithm != "" {
+		hasher, err := crypto.NewHasher(in.HashAlgorithm)
+		if err != nil {
+			err = status.Error(codes.InvalidArgument, err.Error())
+			s.infoError(apiCreateNamespace, "namespace", in.Namespace, "Error", err)
+			return nil, err
+		}
+		opts = append(opts, storage.WithHasher(hasher))
+	}
+
+	if in.DuplicatePolicy != "" {
+		policy, err := storage.ParseDuplicatePolicy(in.DuplicatePolicy)
+		if err != nil {
+			err = status.Error(codes.InvalidArgument, err.Error())
+			s.infoError(apiCreateNamespace, "namespace", in.Namespace, "Error", err)
+			return nil, err
+		}
+		opts = append(opts, storage.WithDuplicatePolicy(policy))
+	}
+
+	accumulator, err := s.namespaces.Create(in.Namespace, opts...)
+	switch {
+	case errors.Is(err, storage.ErrInvalidName):
+		err = status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrAlreadyExists):
+		err = status.Error(codes.AlreadyExists, err.Error())
+	case err != nil:
+		err = status.Error(codes.Internal, err.Error())
+	}
+	if err != nil {
+		s.infoError(apiCreateNamespace, "namespace", in.Namespace, "Error", err)
+		return nil, err
+	}
+
+	s.checkpointers.start(in.Namespace, accumulator)
+	s.anchors.start(in.Namespace, accumulator)
+
+	info := newInfo(accumulator)
+
+	s.infoResponse(apiCreateNamespace, "namespace", in.Namespace, "HashAlgorithm", info.HashAlgorithm, "TreeMode", info.TreeMode)
+	return info, nil
+}
+
+// ListNamespaces returns the names of namespaces without the default one
+func (s Server) ListNamespaces(context.Context, *pb.Empty) (*pb.Namespaces, error) {
+	s.infoRequest(apiListNamespaces)
+
+	names := s.namespaces.List()
+
+	s.infoResponse(apiListNamespaces, "Count", len(names))
+	return &pb.Namespaces{Namespaces: names}, nil
+}
+
+// DeleteNamespace deletes a namespace with all of its leaves, and the default namespace can't be deleted. Only clients
+// with the admin token can delete namespaces.
+func (s Server) DeleteNamespace(ctx context.Context, in *pb.Namespace) (*pb.Empty, error) {
+	s.infoRequest(apiDeleteNamespace, "Namespace", in.Namespace)
+
+	if err := s.checkAdmin(ctx); err != nil {
+		s.infoError(apiDeleteNamespace, "namespace", in.Namespace, "Error", err)
+		return nil, err
+	}
+
+	if in.Namespace == storage.DefaultNamespace {
+		err := status.Error(codes.InvalidArgument, "default namespace can't be deleted")
+		s.infoError(apiDeleteNamespace, "namespace", in.Namespace, "Error", err)
+		return nil, err
+	}
+
+	if _, err := s.accumulatorOf(in.Namespace); err != nil {
+		s.infoError(apiDeleteNamespace, "namespace", in.Namespace, "Error", err)
+		return nil, err
+	}
+
+	// stop checkpointing and anchoring before the accumulator is closed
+	s.checkpointers.stop(in.Namespace)
+	s.anchors.stop(in.Namespace)
+
+	err := s.namespaces.Delete(in.Namespace)
+	if err != nil {
+		// the namespace is kept if it is not deleted, whose services run again
+		if accumulator, getErr := s.namespaces.Get(in.Namespace); getErr == nil {
+			s.checkpointers.start(in.Namespace, accumulator)
+			s.anchors.start(in.Namespace, accumulator)
+		}
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrInvalidName):
+		err = status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		err = status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		err = status.Error(codes.Internal, err.Error())
+	}
+	if err != nil {
+		s.infoError(apiDeleteNamespace, "namespace", in.Namespace, "Error", err)
+		return nil, err
+	}
+
+	s.infoResponse(apiDeleteNamespace, "namespace", in.Namespace)
+	return &pb.Empty{}, nil
+}
+
+// checkAdmin checks that the client presents the admin token in the authorization metadata, and administration is
+// denied to all clients without an admin token
+func (s Server) checkAdmin(ctx context.Context) error {
+	if s.adminToken == "" {
+		return status.Error(codes.PermissionDenied, "namespace administration is disabled")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimPrefix(value, adminTokenScheme)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid admin token")
+}
+
+// checkpointers runs a checkpointer for each namespace by the same policy
+type checkpointers struct {
+	mutex        sync.Mutex
+	policy       CheckpointPolicy
+	logger       *zap.SugaredLogger
+	checkpointer map[string]*Checkpointer
+}
+
+func newCheckpointers(logger *zap.SugaredLogger) *checkpointers {
+	return &checkpointers{logger: logger, checkpointer: make(map[string]*Checkpointer)}
+}
+
+// start starts a checkpointer of the accumulator of a namespace if policy is enabled
+func (c *checkpointers) start(namespace string, accumulator storage.MerkleAccumulator) {
+	if !c.policy.Enabled() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.checkpointer[namespace]; ok {
+		return
+	}
+
+	checkpointer := NewCheckpointer(accumulator, c.policy, c.logger.With("Namespace", namespace))
+	checkpointer.Start()
+	c.checkpointer[namespace] = checkpointer
+}
+
+// stop stops the checkpointer of a namespace if it is running
+func (c *checkpointers) stop(namespace string) {
+	c.mutex.Lock()
+	checkpointer, ok := c.checkpointer[namespace]
+	delete(c.checkpointer, namespace)
+	c.mutex.Unlock()
+
+	if ok {
+		checkpointer.Stop()
+	}
+}
+
+// stopAll stops checkpointers of all namespaces
+func (c *checkpointers) stopAll() {
+	c.mutex.Lock()
+	running := c.checkpointer
+	c.checkpointer = make(map[string]*Checkpointer)
+	c.mutex.Unlock()
+
+	for _, checkpointer := range running {
+		checkpointer.Stop()
+	}
+}
+
+// appended notifies the checkpointer of a namespace of appended leaves
+func (c *checkpointers) appended(namespace string, count int) {
+	c.mutex.Lock()
+	checkpointer, ok := c.checkpointer[namespace]
+	c.mutex.Unlock()
+
+	if ok {
+		checkpointer.Appended(count)
+	}
+}
+
+// anchorServices runs an anchoring service for each namespace on the same ledger
+type anchorServices struct {
+	mutex    sync.Mutex
+	anchorer anchor.Anchorer
+	interval time.Duration
+	logger   *zap.SugaredLogger
+	service  map[string]*anchor.Service
+}
+
+func newAnchorServices(logger *zap.SugaredLogger) *anchorServices {
+	return &anchorServices{logger: logger, service: make(map[string]*anchor.Service)}
+}
+
+// start starts an anchoring service of the accumulator of a namespace if there is an anchorer
+func (a *anchorServices) start(namespace string, accumulator storage.MerkleAccumulator) {
+	if a.anchorer == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.service[namespace]; ok {
+		return
+	}
+
+	service := anchor.NewService(accumulator, a.anchorer, a.interval, a.logger.With("Namespace", namespace))
+	service.Start()
+	a.service[namespace] = service
+}
+
+// stop stops the anchoring service of a namespace if it is running
+func (a *anchorServices) stop(namespace string) {
+	a.mutex.Lock()
+	service, ok := a.service[namespace]
+	delete(a.service, namespace)
+	a.mutex.Unlock()
+
+	if ok {
+		service.Stop()
+	}
+}
+
+// stopAll stops anchoring services of all namespaces
+func (a *anchorServices) stopAll() {
+	a.mutex.Lock()
+	running := a.service
+	a.service = make(map[string]*anchor.Service)
+	a.mutex.Unlock()
+
+	for _, service := range running {
+		service.Stop()
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/frankonly/upchain/anchor"
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/storage"
+)
+
+func TestAnchorNamespaces(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	path := filepath.Join(os.TempDir(), "upchain_test_ledger")
+	r.NoError(os.RemoveAll(path))
+	defer os.Remove(path)
+
+	ledger, err := anchor.NewFileLedger(path)
+	r.NoError(err)
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces, WithAnchorer(ledger, 10*time.Millisecond))
+	defer stop()
+
+	// namespaces created after the server starts are anchored as well as the default one
+	_, err = client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.NoError(err)
+
+	for _, namespace := range []string{storage.DefaultNamespace, "team"} {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+		_, err = client.Append(context.Background(), &pb.Hash{Hash: hash, Namespace: namespace})
+		r.NoError(err)
+	}
+
+	for _, namespace := range []string{storage.DefaultNamespace, "team"} {
+		r.Eventually(func() bool {
+			a, err := client.GetAnchor(context.Background(), &pb.ID{Id: 0, Namespace: namespace})
+			return err == nil && a.Ledger == anchor.FileLedgerName
+		}, 5*time.Second, 10*time.Millisecond, "namespace %q is not anchored", namespace)
+	}
+
+	// the anchoring service of a deleted namespace is stopped before its accumulator is closed
+	_, err = client.DeleteNamespace(adminContext(), &pb.Namespace{Namespace: "team"})
+	r.NoError(err)
+}
+
+func TestNamespaceAdmin(t *testing.T) {
+	r := require.New(t)
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	// namespaces can't be administrated without an admin token
+	disabled := NewServer(namespaces, zap.NewNop().Sugar())
+	_, err = disabled.CreateNamespace(context.Background(), &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.Equal(codes.PermissionDenied, status.Code(err))
+
+	policy := CheckpointPolicy{Interval: time.Hour}
+	s := NewServer(namespaces, zap.NewNop().Sugar(), WithAdminToken(testAdminToken), WithCheckpointPolicy(policy))
+	defer s.Stop()
+
+	admin := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", adminTokenScheme+testAdminToken))
+	wrong := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", adminTokenScheme+"wrong"))
+
+	_, err = s.CreateNamespace(context.Background(), &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = s.CreateNamespace(wrong, &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = s.CreateNamespace(admin, &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.NoError(err)
+
+	_, err = s.DeleteNamespace(wrong, &pb.Namespace{Namespace: "team"})
+	r.Equal(codes.Unauthenticated, status.Code(err))
+
+	// failed deletions keep checkpointing namespaces
+	_, err = s.DeleteNamespace(admin, &pb.Namespace{Namespace: storage.DefaultNamespace})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+	_, err = s.DeleteNamespace(admin, &pb.Namespace{Namespace: "missing"})
+	r.Equal(codes.NotFound, status.Code(err))
+	r.Contains(s.checkpointers.checkpointer, storage.DefaultNamespace)
+	r.Contains(s.checkpointers.checkpointer, "team")
+
+	_, err = s.DeleteNamespace(admin, &pb.Namespace{Namespace: "team"})
+	r.NoError(err)
+	r.NotContains(s.checkpointers.checkpointer, "team")
+	r.Contains(s.checkpointers.checkpointer, storage.DefaultNamespace)
+}
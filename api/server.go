@@ -3,13 +3,20 @@ package api
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"io"
+	"time"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/frankonly/upchain/anchor"
 	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/crypto/sign"
+	"github.com/frankonly/upchain/crypto/verify"
 	"github.com/frankonly/upchain/log"
 	"github.com/frankonly/upchain/storage"
 )
@@ -17,47 +24,311 @@ import (
 // API names
 const (
 	apiAppend            = "Append"
+	apiAppendBatch       = "AppendBatch"
+	apiAppendData        = "AppendData"
+	apiAppendStream      = "AppendStream"
+	apiAppendWithReceipt = "AppendWithReceipt"
 	apiGet               = "Get"
 	apiSearch            = "Search"
+	apiSearchAll         = "SearchAll"
 	apiGetDigest         = "GetDigest"
+	apiGetDigestAt       = "GetDigestAt"
+	apiListDigests       = "ListDigests"
 	apiGetProofByID      = "GetProofByID"
 	apiGetProofByHash    = "GetProofByHash"
 	apiGetOldProofByID   = "GetOldProofByID"
 	apiGetOldProofByHash = "GetOldProofByHash"
+	apiGetProofAt        = "GetProofAt"
+
+	apiGetConsistencyProof = "GetConsistencyProof"
+	apiGetMultiProof       = "GetMultiProof"
+	apiGetRangeProof       = "GetRangeProof"
+	apiGetInfo             = "GetInfo"
+	apiGetKeys             = "GetKeys"
+	apiGetLatestCheckpoint = "GetLatestCheckpoint"
+	apiWatchLeaves         = "WatchLeaves"
+	apiWatchDigests        = "WatchDigests"
+	apiGetAnchor           = "GetAnchor"
+	apiCreateNamespace     = "CreateNamespace"
+	apiListNamespaces      = "ListNamespaces"
+	apiDeleteNamespace     = "DeleteNamespace"
+
+	// rangeProofChunkSize is the max number of leaves in one message of a streamed range proof
+	rangeProofChunkSize = 1024
+	// maxRangeProofLeaves is the max number of leaves of a range proof, which are all read before it is streamed
+	maxRangeProofLeaves = 64 * rangeProofChunkSize
+	// listDigestsPageSize is the default and max number of checkpoints in one page
+	listDigestsPageSize = 1000
+	// searchAllPageSize is the default and max number of ids in one page
+	searchAllPageSize = 1000
+	// maxMetadataSize is the max number of bytes of metadata of a leaf
+	maxMetadataSize = 64 * 1024
+	// maxIdempotencyKeySize is the max number of bytes of an idempotency key
+	maxIdempotencyKeySize = 256
+	// defaultIdempotencyTTL is how long an idempotency key is kept by default
+	defaultIdempotencyTTL = 24 * time.Hour
+	// defaultMaxDataSize is the max number of bytes of content streamed by AppendData by default
+	defaultMaxDataSize = 1 << 30
 )
 
 // Server implements API server
 type Server struct {
 	pb.UnimplementedAccumulatorServer
-	accumulator storage.MerkleAccumulator
-	logger      *zap.SugaredLogger
+	namespaces *storage.Namespaces
+	logger     *zap.SugaredLogger
+
+	// signer signs tree heads if it is not nil, and keys are the published keys including the one of signer
+	signer *sign.Signer
+	keys   *sign.KeySet
+
+	// checkpointers checkpoint each namespace by policy
+	checkpointers *checkpointers
+	// anchors anchor each namespace on a ledger
+	anchors *anchorServices
+
+	// idempotencyTTL is how long a retried Append with the same idempotency key returns the original id
+	idempotencyTTL time.Duration
+	// maxDataSize is the max number of bytes of content streamed by AppendData
+	maxDataSize uint64
+
+	// adminToken authorizes clients to create and delete namespaces, which is denied to all clients if it is empty
+	adminToken string
+}
+
+// Option configures a Server when it is created
+type Option func(*Server)
+
+// WithSigner signs digests, proofs and checkpoints by signer, and publishes its key with retired keys, so that tree
+// heads signed before key rotation are still verifiable
+func WithSigner(signer *sign.Signer, retired ...*sign.PublicKey) Option {
+	return func(s *Server) {
+		s.signer = signer
+		s.keys = sign.NewKeySet(append([]*sign.PublicKey{signer.PublicKey()}, retired...)...)
+	}
+}
+
+// WithCheckpointPolicy checkpoints the accumulator of each namespace in background by policy
+func WithCheckpointPolicy(policy CheckpointPolicy) Option {
+	return func(s *Server) {
+		s.checkpointers.policy = policy
+	}
+}
+
+// WithAnchorer anchors the latest digest of each namespace on the ledger of anchorer every interval
+func WithAnchorer(anchorer anchor.Anchorer, interval time.Duration) Option {
+	return func(s *Server) {
+		s.anchors.anchorer = anchorer
+		s.anchors.interval = interval
+	}
+}
+
+// WithAdminToken allows clients presenting token as a bearer token in authorization metadata to create and delete
+// namespaces
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithIdempotencyTTL keeps idempotency keys of Append for ttl instead of defaultIdempotencyTTL
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.idempotencyTTL = ttl
+	}
+}
+
+// WithMaxDataSize limits content streamed by AppendData to size bytes instead of defaultMaxDataSize
+func WithMaxDataSize(size uint64) Option {
+	return func(s *Server) {
+		s.maxDataSize = size
+	}
+}
+
+// NewServer returns a new API server of accumulators in namespaces. Checkpointers of namespaces are started if a
+// checkpoint policy is enabled, and anchoring services are started if there is an anchorer. They run until Stop.
+func NewServer(namespaces *storage.Namespaces, logger *zap.SugaredLogger, opts ...Option) *Server {
+	s := &Server{
+		namespaces:     namespaces,
+		logger:         logger,
+		checkpointers:  newCheckpointers(logger),
+		anchors:        newAnchorServices(logger),
+		idempotencyTTL: defaultIdempotencyTTL,
+		maxDataSize:    defaultMaxDataSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, name := range append([]string{storage.DefaultNamespace}, namespaces.List()...) {
+		if accumulator, err := namespaces.Get(name); err == nil {
+			s.checkpointers.start(name, accumulator)
+			s.anchors.start(name, accumulator)
+		}
+	}
+
+	return s
 }
 
-// NewServer returns a new API server
-func NewServer(accumulator storage.MerkleAccumulator, logger *zap.SugaredLogger) *Server {
-	return &Server{accumulator: accumulator, logger: logger}
+// Stop stops checkpointers and anchoring services of all namespaces
+func (s Server) Stop() {
+	s.checkpointers.stopAll()
+	s.anchors.stopAll()
 }
 
 // Append appends new hash to accumulator
 func (s Server) Append(_ context.Context, hash *pb.Hash) (*pb.ID, error) {
 	hashLog := hex.EncodeToString(hash.Hash)
-	s.infoRequest(apiAppend, "Hash", hashLog)
+	s.infoRequest(apiAppend, "Hash", hashLog, "Namespace", hash.Namespace)
+
+	accumulator, err := s.accumulatorOf(hash.Namespace)
+	if err != nil {
+		s.infoError(apiAppend, "hash", hashLog, "Error", err)
+		return nil, err
+	}
 
-	// TODO: check length of hash
-	id, err := s.accumulator.Append(hash.Hash)
+	id, err := s.appendHash(accumulator, hash)
 	if err != nil {
-		s.infoError(apiAppend, "hash", hashLog, "Error", "failed to append new hash")
-		return nil, status.Error(codes.Internal, "failed to append new hash")
+		s.infoError(apiAppend, "hash", hashLog, "Error", err)
+		return nil, err
 	}
+
 	s.infoResponse(apiAppend, "hash", hashLog, "ID", id)
 	return &pb.ID{Id: id}, nil
 }
 
+// AppendWithReceipt appends new hash to accumulator and proves it to the digest right after appending
+func (s Server) AppendWithReceipt(_ context.Context, hash *pb.Hash) (*pb.Receipt, error) {
+	hashLog := hex.EncodeToString(hash.Hash)
+	s.infoRequest(apiAppendWithReceipt, "Hash", hashLog, "Namespace", hash.Namespace)
+
+	accumulator, err := s.accumulatorOf(hash.Namespace)
+	if err != nil {
+		s.infoError(apiAppendWithReceipt, "hash", hashLog, "Error", err)
+		return nil, err
+	}
+
+	receipt, err := s.appendWithReceipt(accumulator, hash)
+	if err != nil {
+		s.infoError(apiAppendWithReceipt, "hash", hashLog, "Error", err)
+		return nil, err
+	}
+
+	s.infoResponse(apiAppendWithReceipt, "hash", hashLog, "ID", receipt.Id, "TreeSize", receipt.TreeSize,
+		"HashProof", log.HashProofLog(receipt.Proof))
+	return receipt, nil
+}
+
+// AppendBatch appends new hashes to accumulator in one batch
+func (s Server) AppendBatch(_ context.Context, hashes *pb.Hashes) (*pb.IDRange, error) {
+	s.infoRequest(apiAppendBatch, "Count", len(hashes.Hashes), "Namespace", hashes.Namespace)
+
+	accumulator, err := s.accumulatorOf(hashes.Namespace)
+	if err != nil {
+		s.infoError(apiAppendBatch, "count", len(hashes.Hashes), "Error", err)
+		return nil, err
+	}
+
+	if len(hashes.Hashes) == 0 {
+		err := status.Error(codes.InvalidArgument, "no hash to append")
+		s.infoError(apiAppendBatch, "count", 0, "Error", err)
+		return nil, err
+	}
+
+	for i, hash := range hashes.Hashes {
+		if err := checkHash(accumulator, hash); err != nil {
+			err = status.Errorf(codes.InvalidArgument, "hash %d: %s", i, status.Convert(err).Message())
+			s.infoError(apiAppendBatch, "count", len(hashes.Hashes), "Error", err)
+			return nil, err
+		}
+	}
+
+	var first uint64
+	if hashes.Precondition == nil {
+		first, err = accumulator.AppendBatch(hashes.Hashes)
+	} else {
+		first, err = accumulator.AppendIf(hashes.Hashes, nil, newPrecondition(hashes.Precondition))
+	}
+	if err != nil {
+		err = appendError(err, "failed to append new hashes")
+		s.infoError(apiAppendBatch, "count", len(hashes.Hashes), "Error", err)
+		return nil, err
+	}
+	s.appended(hashes.Namespace, len(hashes.Hashes))
+
+	last := first + uint64(len(hashes.Hashes)) - 1
+	s.infoResponse(apiAppendBatch, "count", len(hashes.Hashes), "First", first, "Last", last)
+	return &pb.IDRange{First: first, Last: last}, nil
+}
+
+// AppendData hashes content streamed by client, and appends the hash as Append. Content of more than the max data size
+// is rejected before the whole stream is received.
+func (s Server) AppendData(stream pb.Accumulator_AppendDataServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		err = status.Error(codes.InvalidArgument, "no data to append")
+	}
+	if err != nil {
+		s.infoError(apiAppendData, "Error", err)
+		return err
+	}
+
+	s.infoRequest(apiAppendData, "Namespace", first.Namespace)
+
+	accumulator, err := s.accumulatorOf(first.Namespace)
+	if err != nil {
+		s.infoError(apiAppendData, "Error", err)
+		return err
+	}
+
+	digest := accumulator.TreeHasher().Hasher().New()
+	var size uint64
+	for data := first; ; {
+		size += uint64(len(data.Chunk))
+		if size > s.maxDataSize {
+			err := status.Errorf(codes.InvalidArgument, "data exceeds %d bytes", s.maxDataSize)
+			s.infoError(apiAppendData, "size", size, "Error", err)
+			return err
+		}
+		digest.Write(data.Chunk)
+
+		data, err = stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			s.infoError(apiAppendData, "size", size, "Error", err)
+			return err
+		}
+	}
+
+	hash := &pb.Hash{
+		Hash:           digest.Sum(nil),
+		Namespace:      first.Namespace,
+		Metadata:       first.Metadata,
+		CommitMetadata: first.CommitMetadata,
+	}
+	hashLog := hex.EncodeToString(hash.Hash)
+
+	id, err := s.appendHash(accumulator, hash)
+	if err != nil {
+		s.infoError(apiAppendData, "size", size, "hash", hashLog, "Error", err)
+		return err
+	}
+
+	s.infoResponse(apiAppendData, "size", size, "hash", hashLog, "ID", id)
+	return stream.SendAndClose(&pb.AppendDataResponse{Id: id, Hash: hash.Hash, Size: size})
+}
+
 // Get gets certain hash by id from accumulator
 func (s Server) Get(_ context.Context, id *pb.ID) (*pb.Hash, error) {
-	s.infoRequest(apiGet, "ID", id.Id)
+	s.infoRequest(apiGet, "ID", id.Id, "Namespace", id.Namespace)
+
+	accumulator, err := s.accumulatorOf(id.Namespace)
+	if err != nil {
+		s.infoError(apiGet, "id", id.Id, "Error", err)
+		return nil, err
+	}
 
-	hash, err := s.accumulator.Get(id.Id)
+	hash, err := accumulator.Get(id.Id)
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrOutOfRange):
@@ -72,16 +343,33 @@ func (s Server) Get(_ context.Context, id *pb.ID) (*pb.Hash, error) {
 		return nil, err
 	}
 
+	metadata, err := metadataOf(accumulator, id.Id)
+	if err != nil {
+		s.infoError(apiGet, "id", id.Id, "Error", err)
+		return nil, err
+	}
+
+	resp := &pb.Hash{Hash: hash}
+	if metadata != nil {
+		resp.Metadata, resp.CommittedHash = metadata.Value, metadata.Committed
+	}
+
 	s.infoResponse(apiGet, "id", id.Id, "Hash", hex.EncodeToString(hash))
-	return &pb.Hash{Hash: hash}, nil
+	return resp, nil
 }
 
 // Search searches accumulator and returns id of oldest node related to input hash
 func (s Server) Search(_ context.Context, hash *pb.Hash) (*pb.ID, error) {
 	hashLog := hex.EncodeToString(hash.Hash)
-	s.infoRequest(apiSearch, "Hash", hashLog)
+	s.infoRequest(apiSearch, "Hash", hashLog, "Namespace", hash.Namespace)
+
+	accumulator, err := s.accumulatorOf(hash.Namespace)
+	if err != nil {
+		s.infoError(apiSearch, "hash", hashLog, "Error", err)
+		return nil, err
+	}
 
-	id, err := s.accumulator.Search(hash.Hash)
+	id, err := accumulator.Search(hash.Hash)
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrNotFound):
@@ -94,15 +382,67 @@ func (s Server) Search(_ context.Context, hash *pb.Hash) (*pb.ID, error) {
 		return nil, err
 	}
 
+	metadata, err := metadataOf(accumulator, id)
+	if err != nil {
+		s.infoError(apiSearch, "hash", hashLog, "Error", err)
+		return nil, err
+	}
+
+	resp := &pb.ID{Id: id}
+	if metadata != nil {
+		resp.Metadata = metadata.Value
+	}
+
 	s.infoResponse(apiSearch, "hash", hashLog, "ID", id)
-	return &pb.ID{Id: id}, nil
+	return resp, nil
+}
+
+// SearchAll searches all leaves of a hash, and returns a page of their ids in the order of appending
+func (s Server) SearchAll(_ context.Context, in *pb.SearchAllRequest) (*pb.SearchAllResponse, error) {
+	hashLog := hex.EncodeToString(in.Hash)
+	s.infoRequest(apiSearchAll, "Hash", hashLog, "Offset", in.Offset, "Limit", in.Limit, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiSearchAll, "hash", hashLog, "Error", err)
+		return nil, err
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 || limit > searchAllPageSize {
+		limit = searchAllPageSize
+	}
+
+	ids, total, err := accumulator.SearchAll(in.Hash, in.Offset, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			err = status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, storage.ErrOutOfRange):
+			err = status.Error(codes.OutOfRange, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiSearchAll, "hash", hashLog, "Error", err)
+		return nil, err
+	}
+
+	s.infoResponse(apiSearchAll, "hash", hashLog, "Count", len(ids), "Total", total)
+	return &pb.SearchAllResponse{Ids: ids, Total: total, NextOffset: in.Offset + uint64(len(ids))}, nil
 }
 
 // GetDigest requests latest digest from accumulator
-func (s Server) GetDigest(context.Context, *pb.Empty) (*pb.Hash, error) {
-	s.infoRequest(apiGetDigest)
+func (s Server) GetDigest(_ context.Context, in *pb.Namespace) (*pb.Hash, error) {
+	s.infoRequest(apiGetDigest, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetDigest, "Error", err)
+		return nil, err
+	}
 
-	digest, err := s.accumulator.Digest()
+	digest, err := accumulator.Digest()
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrEmpty):
@@ -115,15 +455,177 @@ func (s Server) GetDigest(context.Context, *pb.Empty) (*pb.Hash, error) {
 		return nil, err
 	}
 
+	sth, err := s.signDigest(in.Namespace, accumulator, digest)
+	if err != nil {
+		s.infoError(apiGetDigest, "Error", err)
+		return nil, err
+	}
+
 	s.infoResponse(apiGetDigest, "Digest", hex.EncodeToString(digest))
-	return &pb.Hash{Hash: digest}, nil
+	return &pb.Hash{Hash: digest, SignedTreeHead: sth}, nil
+}
+
+// GetDigestAt requests the digest when accumulator had certain number of leaves
+func (s Server) GetDigestAt(_ context.Context, size *pb.TreeSize) (*pb.Hash, error) {
+	s.infoRequest(apiGetDigestAt, "Size", size.Size, "Namespace", size.Namespace)
+
+	accumulator, err := s.accumulatorOf(size.Namespace)
+	if err != nil {
+		s.infoError(apiGetDigestAt, "size", size.Size, "Error", err)
+		return nil, err
+	}
+
+	digest, err := accumulator.DigestAt(size.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOutOfRange):
+			err = status.Error(codes.OutOfRange, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiGetDigestAt, "size", size.Size, "Error", err)
+		return nil, err
+	}
+
+	sth, err := s.signTreeHead(size.Namespace, accumulator, digest, size.Size, time.Now())
+	if err != nil {
+		s.infoError(apiGetDigestAt, "size", size.Size, "Error", err)
+		return nil, err
+	}
+
+	s.infoResponse(apiGetDigestAt, "size", size.Size, "Digest", hex.EncodeToString(digest))
+	return &pb.Hash{Hash: digest, SignedTreeHead: sth}, nil
+}
+
+// ListDigests requests a page of checkpoints of indexed digests
+func (s Server) ListDigests(_ context.Context, in *pb.ListDigestsRequest) (*pb.ListDigestsResponse, error) {
+	s.infoRequest(apiListDigests, "Offset", in.Offset, "Limit", in.Limit, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiListDigests, "offset", in.Offset, "limit", in.Limit, "Error", err)
+		return nil, err
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 || limit > listDigestsPageSize {
+		limit = listDigestsPageSize
+	}
+
+	checkpoints, total, err := accumulator.ListDigests(in.Offset, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOutOfRange):
+			err = status.Error(codes.OutOfRange, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiListDigests, "offset", in.Offset, "limit", in.Limit, "Error", err)
+		return nil, err
+	}
+
+	resp := &pb.ListDigestsResponse{
+		Checkpoints: make([]*pb.Checkpoint, 0, len(checkpoints)),
+		Total:       total,
+		NextOffset:  in.Offset + uint64(len(checkpoints)),
+	}
+	for _, checkpoint := range checkpoints {
+		p, err := s.newCheckpoint(in.Namespace, accumulator, checkpoint)
+		if err != nil {
+			s.infoError(apiListDigests, "offset", in.Offset, "limit", in.Limit, "Error", err)
+			return nil, err
+		}
+
+		resp.Checkpoints = append(resp.Checkpoints, p)
+	}
+
+	s.infoResponse(apiListDigests, "offset", in.Offset, "limit", in.Limit, "Count", len(checkpoints), "Total", total)
+	return resp, nil
+}
+
+// GetLatestCheckpoint requests the last recorded checkpoint
+func (s Server) GetLatestCheckpoint(_ context.Context, in *pb.Namespace) (*pb.Checkpoint, error) {
+	s.infoRequest(apiGetLatestCheckpoint, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetLatestCheckpoint, "Error", err)
+		return nil, err
+	}
+
+	checkpoint, err := accumulator.LatestCheckpoint()
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrEmpty):
+			err = status.Error(codes.Unavailable, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiGetLatestCheckpoint, "Error", err)
+		return nil, err
+	}
+
+	p, err := s.newCheckpoint(in.Namespace, accumulator, checkpoint)
+	if err != nil {
+		s.infoError(apiGetLatestCheckpoint, "Error", err)
+		return nil, err
+	}
+
+	s.infoResponse(apiGetLatestCheckpoint, "Index", p.Index, "Digest", hex.EncodeToString(p.Digest))
+	return p, nil
+}
+
+// GetAnchor requests the earliest anchor including certain node by id
+func (s Server) GetAnchor(_ context.Context, id *pb.ID) (*pb.Anchor, error) {
+	s.infoRequest(apiGetAnchor, "ID", id.Id, "Namespace", id.Namespace)
+
+	accumulator, err := s.accumulatorOf(id.Namespace)
+	if err != nil {
+		s.infoError(apiGetAnchor, "id", id.Id, "Error", err)
+		return nil, err
+	}
+
+	anchor, err := accumulator.GetAnchor(id.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			err = status.Error(codes.NotFound, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiGetAnchor, "id", id.Id, "Error", err)
+		return nil, err
+	}
+
+	p := &pb.Anchor{
+		Index:  anchor.Index,
+		Digest: anchor.Digest,
+		Leaves: anchor.Leaves,
+		Ledger: anchor.Ledger,
+		TxId:   anchor.TxID,
+		Block:  anchor.Block,
+		Time:   anchor.Time.UnixNano(),
+	}
+
+	s.infoResponse(apiGetAnchor, "id", id.Id, "Ledger", p.Ledger, "TxID", p.TxId, "Digest", hex.EncodeToString(p.Digest))
+	return p, nil
 }
 
 // GetProofByID requests hash proof of certain node to latest digest by id
 func (s Server) GetProofByID(_ context.Context, id *pb.ID) (*pb.HashProof, error) {
-	s.infoRequest(apiGetProofByID, "ID", id.Id)
+	s.infoRequest(apiGetProofByID, "ID", id.Id, "Namespace", id.Namespace)
+
+	accumulator, err := s.accumulatorOf(id.Namespace)
+	if err != nil {
+		s.infoError(apiGetProofByID, "id", id.Id, "Error", err)
+		return nil, err
+	}
 
-	p, err := s.getProofByID(id.Id, nil)
+	p, err := s.getProofByID(id.Namespace, accumulator, id.Id, nil)
 	if err != nil {
 		s.infoError(apiGetProofByID, "id", id.Id, "Error", err)
 		return nil, err
@@ -136,9 +638,15 @@ func (s Server) GetProofByID(_ context.Context, id *pb.ID) (*pb.HashProof, error
 // GetProofByHash requests hash proof of certain node to latest digest by hash
 func (s Server) GetProofByHash(_ context.Context, hash *pb.Hash) (*pb.HashProof, error) {
 	hashLog := hex.EncodeToString(hash.Hash)
-	s.infoRequest(apiGetProofByHash, "Hash", hashLog)
+	s.infoRequest(apiGetProofByHash, "Hash", hashLog, "Namespace", hash.Namespace)
+
+	accumulator, err := s.accumulatorOf(hash.Namespace)
+	if err != nil {
+		s.infoError(apiGetProofByHash, "hash", hashLog, "Error", err)
+		return nil, err
+	}
 
-	id, err := s.accumulator.Search(hash.Hash)
+	id, err := accumulator.Search(hash.Hash)
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrNotFound):
@@ -151,7 +659,7 @@ func (s Server) GetProofByHash(_ context.Context, hash *pb.Hash) (*pb.HashProof,
 		return nil, err
 	}
 
-	p, err := s.getProofByID(id, nil)
+	p, err := s.getProofByID(hash.Namespace, accumulator, id, nil)
 	if err != nil {
 		s.infoError(apiGetProofByHash, "hash", hashLog, "Error", err)
 		return nil, err
@@ -164,9 +672,15 @@ func (s Server) GetProofByHash(_ context.Context, hash *pb.Hash) (*pb.HashProof,
 // GetOldProofByID requests hash proof of certain node to a past digest by id
 func (s Server) GetOldProofByID(_ context.Context, in *pb.GetOldProofByIDRequest) (*pb.HashProof, error) {
 	digestLog := hex.EncodeToString(in.Digest)
-	s.infoRequest(apiGetOldProofByID, "ID", in.Id, "Digest", digestLog)
+	s.infoRequest(apiGetOldProofByID, "ID", in.Id, "Digest", digestLog, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetOldProofByID, "id", in.Id, "digest", digestLog, "Error", err)
+		return nil, err
+	}
 
-	p, err := s.getProofByID(in.Id, in.Digest)
+	p, err := s.getProofByID(in.Namespace, accumulator, in.Id, in.Digest)
 	if err != nil {
 		s.infoError(apiGetOldProofByID, "id", in.Id, "digest", digestLog, "Error", err)
 		return nil, err
@@ -180,12 +694,18 @@ func (s Server) GetOldProofByID(_ context.Context, in *pb.GetOldProofByIDRequest
 func (s Server) GetOldProofByHash(_ context.Context, in *pb.GetOldProofByHashRequest) (*pb.HashProof, error) {
 	hashLog := hex.EncodeToString(in.Hash)
 	digestLog := hex.EncodeToString(in.Digest)
-	s.infoRequest(apiGetOldProofByHash, "Hash", hashLog, "Digest", digestLog)
+	s.infoRequest(apiGetOldProofByHash, "Hash", hashLog, "Digest", digestLog, "Namespace", in.Namespace)
 
-	id, err := s.accumulator.Search(in.Hash)
+	accumulator, err := s.accumulatorOf(in.Namespace)
 	if err != nil {
-		switch {
-		case errors.Is(err, storage.ErrNotFound):
+		s.infoError(apiGetOldProofByHash, "hash", hashLog, "digest", digestLog, "Error", err)
+		return nil, err
+	}
+
+	id, err := accumulator.Search(in.Hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
 			err = status.Error(codes.NotFound, err.Error())
 		default:
 			err = status.Error(codes.Internal, err.Error())
@@ -195,7 +715,7 @@ func (s Server) GetOldProofByHash(_ context.Context, in *pb.GetOldProofByHashReq
 		return nil, err
 	}
 
-	p, err := s.getProofByID(id, in.Digest)
+	p, err := s.getProofByID(in.Namespace, accumulator, id, in.Digest)
 	if err != nil {
 		s.infoError(apiGetOldProofByHash, "hash", hashLog, "digest", digestLog, "Error", err)
 		return nil, err
@@ -205,8 +725,492 @@ func (s Server) GetOldProofByHash(_ context.Context, in *pb.GetOldProofByHashReq
 	return p, nil
 }
 
-func (s Server) getProofByID(id uint64, digest []byte) (*pb.HashProof, error) {
-	path, err := s.accumulator.GetProof(id, digest)
+// GetProofAt requests hash proof of certain node to the digest when accumulator had certain number of leaves
+func (s Server) GetProofAt(_ context.Context, in *pb.GetProofAtRequest) (*pb.HashProof, error) {
+	s.infoRequest(apiGetProofAt, "ID", in.Id, "Size", in.Size, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetProofAt, "id", in.Id, "size", in.Size, "Error", err)
+		return nil, err
+	}
+
+	p, err := newHashProof(accumulator.GetProofAt(in.Id, in.Size))
+	if err != nil {
+		s.infoError(apiGetProofAt, "id", in.Id, "size", in.Size, "Error", err)
+		return nil, err
+	}
+
+	if err := positionHashProof(accumulator, p, in.Id, in.Size); err != nil {
+		s.infoError(apiGetProofAt, "id", in.Id, "size", in.Size, "Error", err)
+		return nil, err
+	}
+
+	p.SignedTreeHead, err = s.signTreeHead(in.Namespace, accumulator, p.Digest, in.Size, time.Now())
+	if err != nil {
+		s.infoError(apiGetProofAt, "id", in.Id, "size", in.Size, "Error", err)
+		return nil, err
+	}
+
+	s.infoResponse(apiGetProofAt, "id", in.Id, "size", in.Size, "HashProof", log.HashProofLog(p))
+	return p, nil
+}
+
+// GetConsistencyProof requests consistency proof from an old digest to a new digest, or the latest digest if new digest is empty
+func (s Server) GetConsistencyProof(_ context.Context, in *pb.GetConsistencyProofRequest) (*pb.ConsistencyProof, error) {
+	oldLog := hex.EncodeToString(in.OldDigest)
+	newLog := hex.EncodeToString(in.NewDigest)
+	s.infoRequest(apiGetConsistencyProof, "OldDigest", oldLog, "NewDigest", newLog, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetConsistencyProof, "oldDigest", oldLog, "newDigest", newLog, "Error", err)
+		return nil, err
+	}
+
+	newDigest := in.NewDigest
+	if len(newDigest) == 0 {
+		newDigest = nil
+	}
+
+	proof, err := accumulator.GetConsistencyProof(in.OldDigest, newDigest)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidDigest):
+			err = status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, storage.ErrEmpty):
+			err = status.Error(codes.Unavailable, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiGetConsistencyProof, "oldDigest", oldLog, "newDigest", newLog, "Error", err)
+		return nil, err
+	}
+
+	p := &pb.ConsistencyProof{
+		OldDigest: proof.OldDigest,
+		NewDigest: proof.NewDigest,
+		OldSize:   proof.OldSize,
+		NewSize:   proof.NewSize,
+		Path:      proof.Path,
+	}
+
+	s.infoResponse(apiGetConsistencyProof, "oldDigest", oldLog, "newDigest", newLog, "ConsistencyProof", log.ConsistencyProofLog(p))
+	return p, nil
+}
+
+// GetMultiProof requests a proof of several nodes to a past digest by ids, or the latest digest if digest is empty
+func (s Server) GetMultiProof(_ context.Context, in *pb.GetMultiProofRequest) (*pb.MultiProof, error) {
+	digestLog := hex.EncodeToString(in.Digest)
+	s.infoRequest(apiGetMultiProof, "IDs", in.Ids, "Digest", digestLog, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetMultiProof, "ids", in.Ids, "digest", digestLog, "Error", err)
+		return nil, err
+	}
+
+	if len(in.Ids) == 0 {
+		err := status.Error(codes.InvalidArgument, "no id to prove")
+		s.infoError(apiGetMultiProof, "ids", in.Ids, "digest", digestLog, "Error", err)
+		return nil, err
+	}
+
+	digest := in.Digest
+	if len(digest) == 0 {
+		digest = nil
+	}
+
+	proof, err := accumulator.GetMultiProof(in.Ids, digest)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOutOfRange):
+			err = status.Error(codes.OutOfRange, err.Error())
+		case errors.Is(err, storage.ErrNotFound):
+			err = status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, storage.ErrInvalidDigest):
+			err = status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, storage.ErrEmpty):
+			err = status.Error(codes.Unavailable, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiGetMultiProof, "ids", in.Ids, "digest", digestLog, "Error", err)
+		return nil, err
+	}
+
+	p := &pb.MultiProof{
+		Digest: proof.Digest,
+		Size:   proof.Size,
+		Ids:    proof.IDs,
+		Leaves: proof.Leaves,
+		Hashes: proof.Hashes,
+	}
+
+	s.infoResponse(apiGetMultiProof, "ids", in.Ids, "digest", digestLog, "MultiProof", log.MultiProofLog(p))
+	return p, nil
+}
+
+// GetRangeProof streams a proof of all nodes in [start, end) to a past digest, or the latest digest if digest is empty
+func (s Server) GetRangeProof(in *pb.GetRangeProofRequest, stream pb.Accumulator_GetRangeProofServer) error {
+	digestLog := hex.EncodeToString(in.Digest)
+	s.infoRequest(apiGetRangeProof, "Start", in.Start, "End", in.End, "Digest", digestLog, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetRangeProof, "start", in.Start, "end", in.End, "digest", digestLog, "Error", err)
+		return err
+	}
+
+	if in.End > in.Start && in.End-in.Start > maxRangeProofLeaves {
+		err := status.Errorf(codes.InvalidArgument, "range of %d leaves exceeds %d leaves", in.End-in.Start, maxRangeProofLeaves)
+		s.infoError(apiGetRangeProof, "start", in.Start, "end", in.End, "digest", digestLog, "Error", err)
+		return err
+	}
+
+	digest := in.Digest
+	if len(digest) == 0 {
+		digest = nil
+	}
+
+	proof, err := accumulator.GetRangeProof(in.Start, in.End, digest)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOutOfRange):
+			err = status.Error(codes.OutOfRange, err.Error())
+		case errors.Is(err, storage.ErrNotFound):
+			err = status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, storage.ErrInvalidDigest):
+			err = status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, storage.ErrEmpty):
+			err = status.Error(codes.Unavailable, err.Error())
+		default:
+			err = status.Error(codes.Internal, err.Error())
+		}
+
+		s.infoError(apiGetRangeProof, "start", in.Start, "end", in.End, "digest", digestLog, "Error", err)
+		return err
+	}
+
+	p := &pb.RangeProof{
+		Digest: proof.Digest,
+		Size:   proof.Size,
+		Start:  proof.Start,
+		Leaves: proof.Leaves,
+		Left:   proof.Left,
+		Right:  proof.Right,
+	}
+	proofLog := log.RangeProofLog(p)
+
+	// the first chunk carries the boundaries, and the rest only carry leaves
+	leaves := proof.Leaves
+	for len(leaves) > 0 {
+		n := len(leaves)
+		if n > rangeProofChunkSize {
+			n = rangeProofChunkSize
+		}
+
+		p.Leaves, leaves = leaves[:n], leaves[n:]
+		if err := stream.Send(p); err != nil {
+			s.infoError(apiGetRangeProof, "start", in.Start, "end", in.End, "digest", digestLog, "Error", err)
+			return err
+		}
+
+		p = &pb.RangeProof{}
+	}
+
+	s.infoResponse(apiGetRangeProof, "start", in.Start, "end", in.End, "digest", digestLog, "RangeProof", proofLog)
+	return nil
+}
+
+// GetInfo returns the hash algorithm and tree mode of accumulator
+func (s Server) GetInfo(_ context.Context, in *pb.Namespace) (*pb.Info, error) {
+	s.infoRequest(apiGetInfo, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiGetInfo, "Error", err)
+		return nil, err
+	}
+
+	info := newInfo(accumulator)
+
+	s.infoResponse(apiGetInfo, "HashAlgorithm", info.HashAlgorithm, "TreeMode", info.TreeMode)
+	return info, nil
+}
+
+// GetKeys returns the published public keys and the key id of current signing key
+func (s Server) GetKeys(context.Context, *pb.Empty) (*pb.KeySet, error) {
+	s.infoRequest(apiGetKeys)
+
+	if s.signer == nil {
+		err := status.Error(codes.FailedPrecondition, "no signing key")
+		s.infoError(apiGetKeys, "Error", err)
+		return nil, err
+	}
+
+	keys := s.keys.Proto(s.signer.KeyID())
+
+	s.infoResponse(apiGetKeys, "Current", keys.Current, "Count", len(keys.Keys))
+	return keys, nil
+}
+
+func (s Server) getProofByID(namespace string, accumulator storage.MerkleAccumulator, id uint64, digest []byte) (*pb.HashProof, error) {
+	p, err := newHashProof(accumulator.GetProof(id, digest))
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := accumulator.TreeSizeOf(p.Digest)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if err := positionHashProof(accumulator, p, id, size); err != nil {
+		return nil, err
+	}
+
+	p.SignedTreeHead, err = s.signTreeHead(namespace, accumulator, p.Digest, size, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// accumulatorOf returns the accumulator of a namespace, or a NotFound status if the namespace does not exist
+func (s Server) accumulatorOf(namespace string) (storage.MerkleAccumulator, error) {
+	accumulator, err := s.namespaces.Get(namespace)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	default:
+		return accumulator, nil
+	}
+}
+
+// appended notifies the checkpointer of a namespace of appended leaves
+func (s Server) appended(namespace string, count int) {
+	s.checkpointers.appended(namespace, count)
+}
+
+// appendHash appends a hash with its metadata to the accumulator of its namespace, and returns a status error on
+// failure
+func (s Server) appendHash(accumulator storage.MerkleAccumulator, hash *pb.Hash) (uint64, error) {
+	if err := checkHash(accumulator, hash.Hash); err != nil {
+		return 0, err
+	}
+
+	leaf, metadata, err := newMetadata(accumulator, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(hash.IdempotencyKey) > maxIdempotencyKeySize {
+		return 0, status.Errorf(codes.InvalidArgument, "idempotency key of %d bytes exceeds %d bytes", len(hash.IdempotencyKey), maxIdempotencyKeySize)
+	}
+
+	var id uint64
+	switch {
+	case hash.IdempotencyKey != "":
+		id, err = accumulator.AppendOnce([]byte(hash.IdempotencyKey), s.idempotencyTTL, leaf, metadata, newPrecondition(hash.Precondition))
+	case hash.Precondition != nil:
+		id, err = accumulator.AppendIf([][]byte{leaf}, []*storage.Metadata{metadata}, newPrecondition(hash.Precondition))
+	case metadata == nil:
+		id, err = accumulator.Append(leaf)
+	default:
+		id, err = accumulator.AppendWithMetadata(leaf, metadata)
+	}
+	if err != nil {
+		return 0, appendError(err, "failed to append new hash")
+	}
+
+	s.appended(hash.Namespace, 1)
+	return id, nil
+}
+
+// appendWithReceipt appends a hash with its metadata like appendHash, and returns the receipt of the leaf with the
+// signed tree head of its digest
+func (s Server) appendWithReceipt(accumulator storage.MerkleAccumulator, hash *pb.Hash) (*pb.Receipt, error) {
+	if err := checkHash(accumulator, hash.Hash); err != nil {
+		return nil, err
+	}
+
+	if hash.IdempotencyKey != "" {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key is only supported by Append")
+	}
+
+	leaf, metadata, err := newMetadata(accumulator, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := accumulator.AppendWithReceipt(leaf, metadata, newPrecondition(hash.Precondition))
+	if err != nil {
+		return nil, appendError(err, "failed to append new hash")
+	}
+
+	s.appended(hash.Namespace, 1)
+
+	p, err := newHashProof(receipt.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := positionHashProof(accumulator, p, receipt.ID, receipt.Leaves); err != nil {
+		return nil, err
+	}
+
+	// the tree size of digest is known, so it is not looked up again like signDigest
+	p.SignedTreeHead, err = s.signTreeHead(hash.Namespace, accumulator, p.Digest, receipt.Leaves, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Receipt{Id: receipt.ID, TreeSize: receipt.Leaves, Proof: p}, nil
+}
+
+// newPrecondition converts the precondition of appending, which is nil if there is no precondition
+func newPrecondition(p *pb.Precondition) *storage.Precondition {
+	if p == nil {
+		return nil
+	}
+
+	return &storage.Precondition{Leaves: p.Size, Digest: p.Digest}
+}
+
+// appendError converts an error of appending to a status error, where message describes unexpected errors
+func appendError(err error, message string) error {
+	switch {
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, message)
+	}
+}
+
+// checkHash checks that a hash to append is of the size of the hash algorithm of accumulator
+func checkHash(accumulator storage.MerkleAccumulator, hash []byte) error {
+	hasher := accumulator.TreeHasher().Hasher()
+	if len(hash) != hasher.Size() {
+		return status.Errorf(codes.InvalidArgument, "hash of %d bytes, expected %d bytes of %s", len(hash), hasher.Size(), hasher.Name())
+	}
+
+	return nil
+}
+
+// newInfo returns how the merkle tree of accumulator is hashed and how duplicates are handled
+func newInfo(accumulator storage.MerkleAccumulator) *pb.Info {
+	hasher := accumulator.TreeHasher()
+	return &pb.Info{
+		HashAlgorithm:   hasher.Hasher().Name(),
+		HashSize:        uint32(hasher.Hasher().Size()),
+		TreeMode:        hasher.Mode().String(),
+		DuplicatePolicy: accumulator.DuplicatePolicy().String(),
+	}
+}
+
+// newMetadata validates the metadata of a hash to append, and returns the leaf to append with metadata to store, which
+// is nil if there is no metadata
+func newMetadata(accumulator storage.MerkleAccumulator, hash *pb.Hash) ([]byte, *storage.Metadata, error) {
+	if len(hash.Metadata) == 0 {
+		if hash.CommitMetadata {
+			return nil, nil, status.Error(codes.InvalidArgument, "no metadata to commit")
+		}
+
+		return hash.Hash, nil, nil
+	}
+
+	if len(hash.Metadata) > maxMetadataSize {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "metadata exceeds %d bytes", maxMetadataSize)
+	}
+
+	if !json.Valid(hash.Metadata) {
+		return nil, nil, status.Error(codes.InvalidArgument, "metadata is not valid JSON")
+	}
+
+	if !hash.CommitMetadata {
+		return hash.Hash, &storage.Metadata{Value: hash.Metadata}, nil
+	}
+
+	leaf := crypto.CommitMetadata(accumulator.TreeHasher().Hasher(), hash.Hash, hash.Metadata)
+	return leaf, &storage.Metadata{Value: hash.Metadata, Committed: hash.Hash}, nil
+}
+
+// metadataOf returns the metadata of a leaf, or nil if the leaf has no metadata
+func metadataOf(accumulator storage.MerkleAccumulator, id uint64) (*storage.Metadata, error) {
+	metadata, err := accumulator.GetMetadata(id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	default:
+		return metadata, nil
+	}
+}
+
+// newCheckpoint converts a checkpoint from accumulator of namespace, which is signed at the time of indexing
+func (s Server) newCheckpoint(namespace string, accumulator storage.MerkleAccumulator, checkpoint *storage.Checkpoint) (*pb.Checkpoint, error) {
+	sth, err := s.signTreeHead(namespace, accumulator, checkpoint.Digest, checkpoint.Leaves, checkpoint.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Checkpoint{
+		Index:          checkpoint.Index,
+		Digest:         checkpoint.Digest,
+		Size:           checkpoint.Size,
+		Leaves:         checkpoint.Leaves,
+		Time:           checkpoint.Time.UnixNano(),
+		SignedTreeHead: sth,
+	}, nil
+}
+
+// signDigest signs an indexed digest of accumulator in namespace with the tree size of it at the current time
+func (s Server) signDigest(namespace string, accumulator storage.MerkleAccumulator, digest []byte) (*pb.SignedTreeHead, error) {
+	if s.signer == nil {
+		return nil, nil
+	}
+
+	size, err := accumulator.TreeSizeOf(digest)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return s.signTreeHead(namespace, accumulator, digest, size, time.Now())
+}
+
+// signTreeHead signs the digest of a tree of accumulator in namespace with certain number of leaves, and returns nil
+// without signer
+func (s Server) signTreeHead(namespace string, accumulator storage.MerkleAccumulator, digest []byte, size uint64, timestamp time.Time) (*pb.SignedTreeHead, error) {
+	if s.signer == nil {
+		return nil, nil
+	}
+
+	hasher := accumulator.TreeHasher()
+	info := sign.Accumulator{
+		Namespace:     namespace,
+		HashAlgorithm: hasher.Hasher().Name(),
+		TreeMode:      hasher.Mode().String(),
+	}
+
+	sth, err := s.signer.Sign(info, digest, size, timestamp)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to sign tree head")
+	}
+
+	return sth, nil
+}
+
+// newHashProof converts a hash path from accumulator to hash proof
+func newHashProof(path [][]byte, err error) (*pb.HashProof, error) {
 	switch {
 	case errors.Is(err, storage.ErrOutOfRange):
 		return nil, status.Error(codes.OutOfRange, err.Error())
@@ -228,6 +1232,24 @@ func (s Server) getProofByID(id uint64, digest []byte) (*pb.HashProof, error) {
 	}
 }
 
+// positionHashProof makes a hash proof of version 2 by the id of leaf, the number of leaves of the tree of digest and
+// how the tree of accumulator is hashed
+func positionHashProof(accumulator storage.MerkleAccumulator, p *pb.HashProof, id, size uint64) error {
+	hasher := accumulator.TreeHasher()
+	sides, err := verify.New(hasher).Sides(id, size)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	p.Version = verify.HashProofV2
+	p.Id = id
+	p.TreeSize = size
+	p.HashAlgorithm = hasher.Hasher().Name()
+	p.TreeMode = hasher.Mode().String()
+	p.Sides = sides
+	return nil
+}
+
 func (s Server) infoRequest(keysAndValues ...interface{}) {
 	keysAndValues = append([]interface{}{"API"}, keysAndValues...)
 	s.logger.Infow("grpc request", keysAndValues...)
@@ -0,0 +1,565 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/crypto/sign"
+	"github.com/frankonly/upchain/crypto/verify"
+	"github.com/frankonly/upchain/storage"
+)
+
+func TestHashProofV2(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+	_, err = namespaces.Create("rfc6962", storage.WithTreeMode(crypto.RFC6962Mode))
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx := context.Background()
+	for _, namespace := range []string{storage.DefaultNamespace, "rfc6962"} {
+		accumulator, err := namespaces.Get(namespace)
+		r.NoError(err)
+		verifier := verify.New(accumulator.TreeHasher())
+
+		hashes := make([][]byte, 11)
+		for i := range hashes {
+			hashes[i] = make([]byte, 32)
+			rand.Read(hashes[i])
+		}
+
+		_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: hashes[:7], Namespace: namespace})
+		r.NoError(err)
+
+		old, err := client.GetDigestAt(ctx, &pb.TreeSize{Size: 5, Namespace: namespace})
+		r.NoError(err)
+
+		_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: hashes[7:10], Namespace: namespace})
+		r.NoError(err)
+
+		receipt, err := client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[10], Namespace: namespace})
+		r.NoError(err)
+
+		byID, err := client.GetProofByID(ctx, &pb.ID{Id: 3, Namespace: namespace})
+		r.NoError(err)
+		byHash, err := client.GetProofByHash(ctx, &pb.Hash{Hash: hashes[6], Namespace: namespace})
+		r.NoError(err)
+		oldByID, err := client.GetOldProofByID(ctx, &pb.GetOldProofByIDRequest{Id: 4, Digest: old.Hash, Namespace: namespace})
+		r.NoError(err)
+		at, err := client.GetProofAt(ctx, &pb.GetProofAtRequest{Id: 1, Size: 2, Namespace: namespace})
+		r.NoError(err)
+
+		// every proof tells its leaf and tree, so that it is verified without knowing the tree size
+		for _, c := range []struct {
+			proof *pb.HashProof
+			id    uint64
+			size  uint64
+		}{
+			{receipt.Proof, 10, 11},
+			{byID, 3, 11},
+			{byHash, 6, 11},
+			{oldByID, 4, 5},
+			{at, 1, 2},
+		} {
+			r.EqualValues(verify.HashProofV2, c.proof.Version)
+			r.Equal(c.id, c.proof.Id)
+			r.Equal(c.size, c.proof.TreeSize)
+			r.Equal(crypto.SHA256, c.proof.HashAlgorithm)
+			r.Equal(accumulator.TreeHasher().Mode().String(), c.proof.TreeMode)
+			r.Len(c.proof.Sides, len(c.proof.Path))
+			r.Equal(hashes[c.id], c.proof.Hash)
+			r.NoError(verifier.HashProof(c.proof, c.id, 0, c.proof.Digest))
+		}
+	}
+
+	r.NoError(namespaces.Close())
+}
+
+func TestCheckHash(t *testing.T) {
+	r := require.New(t)
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx := context.Background()
+	for _, size := range []int{0, 16, 33, 64} {
+		hash := make([]byte, size)
+		_, err = client.Append(ctx, &pb.Hash{Hash: hash})
+		r.Equal(codes.InvalidArgument, status.Code(err), "hash of %d bytes", size)
+		_, err = client.AppendWithReceipt(ctx, &pb.Hash{Hash: hash})
+		r.Equal(codes.InvalidArgument, status.Code(err), "hash of %d bytes", size)
+		_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: [][]byte{make([]byte, 32), hash}})
+		r.Equal(codes.InvalidArgument, status.Code(err), "hash of %d bytes", size)
+	}
+
+	// nothing is appended by rejected hashes
+	_, err = client.Get(ctx, &pb.ID{Id: 0})
+	r.Equal(codes.OutOfRange, status.Code(err))
+
+	_, err = client.Append(ctx, &pb.Hash{Hash: make([]byte, 32)})
+	r.NoError(err)
+}
+
+func TestAppendData(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	hasher, err := crypto.NewHasher(crypto.BLAKE2b256)
+	r.NoError(err)
+	_, err = namespaces.Create("blake2b", storage.WithHasher(hasher))
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces, WithMaxDataSize(1024))
+	defer stop()
+
+	ctx := context.Background()
+
+	// content is hashed by the hasher of namespace, and the hash is appended
+	content := make([]byte, 1000)
+	rand.Read(content)
+	for i, namespace := range []string{storage.DefaultNamespace, "blake2b"} {
+		accumulator, err := namespaces.Get(namespace)
+		r.NoError(err)
+		hasher := accumulator.TreeHasher().Hasher()
+
+		_, err = client.Append(ctx, &pb.Hash{Hash: make([]byte, hasher.Size()), Namespace: namespace})
+		r.NoError(err)
+
+		stream, err := client.AppendData(ctx)
+		r.NoError(err)
+		for offset := 0; offset < len(content); offset += 300 {
+			end := offset + 300
+			if end > len(content) {
+				end = len(content)
+			}
+			r.NoError(stream.Send(&pb.Data{Chunk: content[offset:end], Namespace: namespace}))
+		}
+
+		resp, err := stream.CloseAndRecv()
+		r.NoError(err)
+		r.EqualValues(1, resp.Id, "namespace %d", i)
+		r.EqualValues(len(content), resp.Size)
+		r.Equal(hasher.Hash(content), resp.Hash)
+
+		hash, err := client.Get(ctx, &pb.ID{Id: resp.Id, Namespace: namespace})
+		r.NoError(err)
+		r.Equal(hasher.Hash(content), hash.Hash)
+	}
+
+	// an empty stream is rejected
+	stream, err := client.AppendData(ctx)
+	r.NoError(err)
+	_, err = stream.CloseAndRecv()
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	// content of more than the max data size is rejected, and nothing is appended
+	stream, err = client.AppendData(ctx)
+	r.NoError(err)
+	r.NoError(stream.Send(&pb.Data{Chunk: content}))
+	_ = stream.Send(&pb.Data{Chunk: content[:100]})
+	_, err = stream.CloseAndRecv()
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Get(ctx, &pb.ID{Id: 2})
+	r.Equal(codes.OutOfRange, status.Code(err))
+}
+
+func TestGetRangeProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx := context.Background()
+	hashes := make([][]byte, 2*rangeProofChunkSize+10)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+	_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: hashes})
+	r.NoError(err)
+
+	digest, err := client.GetDigest(ctx, &pb.Namespace{})
+	r.NoError(err)
+
+	// the proof is streamed in chunks, which are merged in order
+	stream, err := client.GetRangeProof(ctx, &pb.GetRangeProofRequest{Start: 3, End: uint64(len(hashes))})
+	r.NoError(err)
+
+	proof := &pb.RangeProof{}
+	var chunks int
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		r.NoError(err)
+		r.LessOrEqual(len(chunk.Leaves), rangeProofChunkSize)
+		proto.Merge(proof, chunk)
+		chunks++
+	}
+	r.Equal(3, chunks)
+	r.Equal(hashes[3:], proof.Leaves)
+	r.NoError(verify.RangeProof(proof, digest.Hash))
+
+	// a range of too many leaves is rejected before any leaf is read
+	stream, err = client.GetRangeProof(ctx, &pb.GetRangeProofRequest{Start: 1, End: maxRangeProofLeaves + 2})
+	r.NoError(err)
+	_, err = stream.Recv()
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	stream, err = client.GetRangeProof(ctx, &pb.GetRangeProofRequest{Start: 1, End: maxRangeProofLeaves + 1})
+	r.NoError(err)
+	_, err = stream.Recv()
+	r.Equal(codes.OutOfRange, status.Code(err))
+}
+
+func TestMetadata(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx := context.Background()
+	hashes := make([][]byte, 3)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	metadata := []byte(`{"name":"a.txt","size":3}`)
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0]})
+	r.NoError(err)
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[1], Metadata: metadata})
+	r.NoError(err)
+
+	// metadata is returned by Get and Search
+	hash, err := client.Get(ctx, &pb.ID{Id: 0})
+	r.NoError(err)
+	r.Empty(hash.Metadata)
+	r.Empty(hash.CommittedHash)
+
+	hash, err = client.Get(ctx, &pb.ID{Id: 1})
+	r.NoError(err)
+	r.Equal(hashes[1], hash.Hash)
+	r.Equal(metadata, hash.Metadata)
+	r.Empty(hash.CommittedHash)
+
+	id, err := client.Search(ctx, &pb.Hash{Hash: hashes[1]})
+	r.NoError(err)
+	r.EqualValues(1, id.Id)
+	r.Equal(metadata, id.Metadata)
+
+	// committed metadata is proved with the leaf, which commits to the hash and metadata
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[2], Metadata: metadata, CommitMetadata: true})
+	r.NoError(err)
+
+	hash, err = client.Get(ctx, &pb.ID{Id: 2})
+	r.NoError(err)
+	r.Equal(crypto.CommitMetadata(crypto.DefaultHasher(), hashes[2], metadata), hash.Hash)
+	r.Equal(hashes[2], hash.CommittedHash)
+	r.Equal(metadata, hash.Metadata)
+
+	// invalid metadata is rejected, and nothing is appended
+	for _, c := range []*pb.Hash{
+		{Hash: hashes[0], Metadata: []byte(`{"name":`)},
+		{Hash: hashes[0], Metadata: append(append([]byte(`"`), bytes.Repeat([]byte("a"), maxMetadataSize)...), '"')},
+		{Hash: hashes[0], CommitMetadata: true},
+	} {
+		_, err = client.Append(ctx, c)
+		r.Equal(codes.InvalidArgument, status.Code(err))
+		_, err = client.AppendWithReceipt(ctx, c)
+		r.Equal(codes.InvalidArgument, status.Code(err))
+	}
+
+	_, err = client.Get(ctx, &pb.ID{Id: 3})
+	r.Equal(codes.OutOfRange, status.Code(err))
+}
+
+func TestSearchAll(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx := context.Background()
+	hashes := make([][]byte, 3)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	// duplicates are allowed by default, and all their leaves are listed in order
+	_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: [][]byte{hashes[0], hashes[1], hashes[0], hashes[1], hashes[0]}})
+	r.NoError(err)
+
+	resp, err := client.SearchAll(ctx, &pb.SearchAllRequest{Hash: hashes[0], Limit: 2})
+	r.NoError(err)
+	r.Equal([]uint64{0, 2}, resp.Ids)
+	r.EqualValues(3, resp.Total)
+	r.EqualValues(2, resp.NextOffset)
+
+	resp, err = client.SearchAll(ctx, &pb.SearchAllRequest{Hash: hashes[0], Offset: resp.NextOffset})
+	r.NoError(err)
+	r.Equal([]uint64{4}, resp.Ids)
+	r.EqualValues(3, resp.NextOffset)
+
+	_, err = client.SearchAll(ctx, &pb.SearchAllRequest{Hash: hashes[0], Offset: 4})
+	r.Equal(codes.OutOfRange, status.Code(err))
+	_, err = client.SearchAll(ctx, &pb.SearchAllRequest{Hash: hashes[2]})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	// the duplicate policy of a namespace decides how a hash appended again is handled
+	_, err = client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: "team", DuplicatePolicy: "unknown"})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	for _, policy := range []storage.DuplicatePolicy{storage.RejectDuplicates, storage.ReturnExisting} {
+		namespace := policy.String()
+		info, err := client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: namespace, DuplicatePolicy: policy.String()})
+		r.NoError(err)
+		r.Equal(policy.String(), info.DuplicatePolicy)
+
+		info, err = client.GetInfo(ctx, &pb.Namespace{Namespace: namespace})
+		r.NoError(err)
+		r.Equal(policy.String(), info.DuplicatePolicy)
+
+		_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0], Namespace: namespace})
+		r.NoError(err)
+		_, err = client.Append(ctx, &pb.Hash{Hash: hashes[1], Namespace: namespace})
+		r.NoError(err)
+
+		// a batch of any existing or repeated hash is rejected under both policies
+		_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: [][]byte{hashes[2], hashes[0]}, Namespace: namespace})
+		r.Equal(codes.AlreadyExists, status.Code(err))
+		_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: [][]byte{hashes[2], hashes[2]}, Namespace: namespace})
+		r.Equal(codes.AlreadyExists, status.Code(err))
+
+		id, err := client.Append(ctx, &pb.Hash{Hash: hashes[1], Namespace: namespace})
+		if policy == storage.RejectDuplicates {
+			r.Equal(codes.AlreadyExists, status.Code(err))
+		} else {
+			r.NoError(err)
+			r.EqualValues(1, id.Id)
+		}
+
+		resp, err := client.SearchAll(ctx, &pb.SearchAllRequest{Hash: hashes[1], Namespace: namespace})
+		r.NoError(err)
+		r.Equal([]uint64{1}, resp.Ids)
+	}
+}
+
+func TestAppendWithReceipt(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	_, key, err := ed25519.GenerateKey(nil)
+	r.NoError(err)
+	signer, err := sign.NewSigner(key)
+	r.NoError(err)
+	keys := sign.NewKeySet(signer.PublicKey())
+
+	client, stop := newTestClient(r, namespaces, WithSigner(signer))
+	defer stop()
+
+	ctx := context.Background()
+	hashes := make([][]byte, 5)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: hashes[:4]})
+	r.NoError(err)
+
+	// the receipt proves the leaf to the digest right after it is appended, which is signed with its tree size
+	receipt, err := client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[4], Metadata: []byte(`{"name":"a"}`)})
+	r.NoError(err)
+	r.EqualValues(4, receipt.Id)
+	r.EqualValues(5, receipt.TreeSize)
+	r.Equal(receipt.Id, receipt.Proof.Id)
+	r.Equal(receipt.TreeSize, receipt.Proof.TreeSize)
+	r.Equal(hashes[4], receipt.Proof.Hash)
+	r.NoError(verify.New(merkle.TreeHasher()).HashProof(receipt.Proof, receipt.Id, 0, receipt.Proof.Digest))
+
+	digest, err := client.GetDigestAt(ctx, &pb.TreeSize{Size: receipt.TreeSize})
+	r.NoError(err)
+	r.Equal(digest.Hash, receipt.Proof.Digest)
+
+	sth := receipt.Proof.SignedTreeHead
+	r.NotNil(sth)
+	r.Equal(receipt.Proof.Digest, sth.Digest)
+	r.Equal(receipt.TreeSize, sth.TreeSize)
+	accumulator := sign.Accumulator{Namespace: storage.DefaultNamespace, HashAlgorithm: crypto.SHA256, TreeMode: crypto.PlaceholderMode.String()}
+	r.NoError(keys.VerifyOf(accumulator, sth))
+
+	hash, err := client.Get(ctx, &pb.ID{Id: receipt.Id})
+	r.NoError(err)
+	r.Equal(`{"name":"a"}`, string(hash.Metadata))
+
+	// idempotency keys are only supported by Append
+	_, err = client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[0], IdempotencyKey: "request-1"})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	// a rejected duplicate has no receipt
+	_, err = client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: "team", DuplicatePolicy: storage.RejectDuplicates.String()})
+	r.NoError(err)
+	_, err = client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[0], Namespace: "team"})
+	r.NoError(err)
+	_, err = client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[0], Namespace: "team"})
+	r.Equal(codes.AlreadyExists, status.Code(err))
+}
+
+func TestPrecondition(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx := context.Background()
+	hashes := make([][]byte, 4)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	// an empty tree has no leaf
+	id, err := client.Append(ctx, &pb.Hash{Hash: hashes[0], Precondition: &pb.Precondition{Size: 0}})
+	r.NoError(err)
+	r.EqualValues(0, id.Id)
+
+	digest, err := client.GetDigest(ctx, &pb.Namespace{})
+	r.NoError(err)
+
+	ids, err := client.AppendBatch(ctx, &pb.Hashes{Hashes: hashes[1:3], Precondition: &pb.Precondition{Digest: digest.Hash}})
+	r.NoError(err)
+	r.EqualValues(1, ids.First)
+
+	receipt, err := client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[3], Precondition: &pb.Precondition{Size: 3}})
+	r.NoError(err)
+	r.EqualValues(3, receipt.Id)
+
+	// a stale tree size or digest fails every kind of append, and nothing is appended
+	for _, cond := range []*pb.Precondition{{Size: 3}, {Digest: digest.Hash}, {Size: 4, Digest: digest.Hash}} {
+		_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0], Precondition: cond})
+		r.Equal(codes.FailedPrecondition, status.Code(err))
+		_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0], Precondition: cond, Metadata: []byte(`{}`)})
+		r.Equal(codes.FailedPrecondition, status.Code(err))
+		_, err = client.AppendBatch(ctx, &pb.Hashes{Hashes: hashes, Precondition: cond})
+		r.Equal(codes.FailedPrecondition, status.Code(err))
+		_, err = client.AppendWithReceipt(ctx, &pb.Hash{Hash: hashes[0], Precondition: cond})
+		r.Equal(codes.FailedPrecondition, status.Code(err))
+	}
+
+	_, err = client.Get(ctx, &pb.ID{Id: 4})
+	r.Equal(codes.OutOfRange, status.Code(err))
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces, WithIdempotencyTTL(time.Hour))
+	defer stop()
+
+	ctx := context.Background()
+	hashes := make([][]byte, 3)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0]})
+	r.NoError(err)
+
+	// a retried append returns the original id, even if its precondition fails now
+	for i := 0; i < 2; i++ {
+		id, err := client.Append(ctx, &pb.Hash{Hash: hashes[1], IdempotencyKey: "request-1", Precondition: &pb.Precondition{Size: 1}})
+		r.NoError(err)
+		r.EqualValues(1, id.Id)
+	}
+
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[2], IdempotencyKey: "request-1"})
+	r.Equal(codes.AlreadyExists, status.Code(err))
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[2], IdempotencyKey: string(bytes.Repeat([]byte("k"), maxIdempotencyKeySize+1))})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Get(ctx, &pb.ID{Id: 2})
+	r.Equal(codes.OutOfRange, status.Code(err))
+
+	// the key of an existing hash returned by ReturnExisting is bound to the hash, and its metadata is never discarded
+	_, err = client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: "team", DuplicatePolicy: storage.ReturnExisting.String()})
+	r.NoError(err)
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0], Namespace: "team"})
+	r.NoError(err)
+
+	id, err := client.Append(ctx, &pb.Hash{Hash: hashes[0], Namespace: "team", IdempotencyKey: "request-2"})
+	r.NoError(err)
+	r.EqualValues(0, id.Id)
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[1], Namespace: "team", IdempotencyKey: "request-2"})
+	r.Equal(codes.AlreadyExists, status.Code(err))
+	_, err = client.Append(ctx, &pb.Hash{Hash: hashes[0], Namespace: "team", IdempotencyKey: "request-3", Metadata: []byte(`{}`)})
+	r.Equal(codes.AlreadyExists, status.Code(err))
+}
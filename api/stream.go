@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/storage"
+)
+
+const (
+	// appendStreamBatchSize is the max number of streamed hashes appended in one batch
+	appendStreamBatchSize = 1024
+	// appendStreamBuffer is the max number of hashes received ahead of appending, beyond which clients are held back
+	// by flow control of gRPC
+	appendStreamBuffer = 4 * appendStreamBatchSize
+)
+
+// AppendStream appends hashes streamed by client in batches of hashes received so far, and streams their ids back in
+// order. Hashes are appended in the namespace of the first hash, and a hash of another namespace fails the stream
+// after hashes before it are appended.
+func (s Server) AppendStream(stream pb.Accumulator_AppendStreamServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		s.infoError(apiAppendStream, "Error", err)
+		return err
+	}
+
+	s.infoRequest(apiAppendStream, "Namespace", first.Namespace)
+
+	accumulator, err := s.accumulatorOf(first.Namespace)
+	if err != nil {
+		s.infoError(apiAppendStream, "Error", err)
+		return err
+	}
+
+	// hashes are received in background until the buffer is full
+	hashes := make(chan *pb.Hash, appendStreamBuffer)
+	received := make(chan error, 1)
+	go func() {
+		defer close(hashes)
+
+		for hash := first; ; {
+			select {
+			case hashes <- hash:
+			case <-stream.Context().Done():
+				received <- status.FromContextError(stream.Context().Err()).Err()
+				return
+			}
+
+			var err error
+			hash, err = stream.Recv()
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				received <- err
+				return
+			}
+
+			if hash.Namespace != first.Namespace {
+				received <- status.Errorf(codes.InvalidArgument, "hash of namespace %q in a stream of namespace %q",
+					hash.Namespace, first.Namespace)
+				return
+			}
+		}
+	}()
+
+	var count int
+	for hash := range hashes {
+		batch := []*pb.Hash{hash}
+	drain:
+		for len(batch) < appendStreamBatchSize {
+			select {
+			case hash, ok := <-hashes:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, hash)
+			default:
+				break drain
+			}
+		}
+
+		ids, err := s.appendHashes(accumulator, batch)
+		for _, id := range ids {
+			if err := stream.Send(&pb.ID{Id: id}); err != nil {
+				s.infoError(apiAppendStream, "count", count, "Error", err)
+				return err
+			}
+			count++
+		}
+
+		if err != nil {
+			s.infoError(apiAppendStream, "count", count, "Error", err)
+			return err
+		}
+	}
+
+	if err := <-received; err != nil {
+		s.infoError(apiAppendStream, "count", count, "Error", err)
+		return err
+	}
+
+	s.infoResponse(apiAppendStream, "Count", count)
+	return nil
+}
+
+// appendHashes appends runs of valid plain hashes in batches, while other hashes are appended one by one as Append.
+// Ids of appended hashes are returned in order with the status error of the first failed hash.
+func (s Server) appendHashes(accumulator storage.MerkleAccumulator, hashes []*pb.Hash) ([]uint64, error) {
+	ids := make([]uint64, 0, len(hashes))
+	for len(hashes) > 0 {
+		n := 0
+		for n < len(hashes) && isPlain(hashes[n]) && checkHash(accumulator, hashes[n].Hash) == nil {
+			n++
+		}
+
+		// a hash which is not plain is appended alone, and an invalid hash fails here
+		if n == 0 {
+			id, err := s.appendHash(accumulator, hashes[0])
+			if err != nil {
+				return ids, err
+			}
+
+			ids = append(ids, id)
+			hashes = hashes[1:]
+			continue
+		}
+
+		batch := make([][]byte, n)
+		for i := range batch {
+			batch[i] = hashes[i].Hash
+		}
+
+		first, err := accumulator.AppendBatch(batch)
+		switch {
+		case errors.Is(err, storage.ErrAlreadyExists) && accumulator.DuplicatePolicy() == storage.ReturnExisting:
+			// nothing of the batch is appended, so that appended hashes return their ids one by one
+			for _, hash := range hashes[:n] {
+				id, err := s.appendHash(accumulator, hash)
+				if err != nil {
+					return ids, err
+				}
+
+				ids = append(ids, id)
+			}
+		case err != nil:
+			return ids, appendError(err, "failed to append new hashes")
+		default:
+			for i := range batch {
+				ids = append(ids, first+uint64(i))
+			}
+			s.appended(hashes[0].Namespace, n)
+		}
+
+		hashes = hashes[n:]
+	}
+
+	return ids, nil
+}
+
+// isPlain returns whether a hash is appended without metadata, precondition or idempotency key, which is batched with
+// other plain hashes
+func isPlain(hash *pb.Hash) bool {
+	return len(hash.Metadata) == 0 && !hash.CommitMetadata && hash.Precondition == nil && hash.IdempotencyKey == ""
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/storage"
+)
+
+func TestAppendStream(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// more hashes than the buffer are sent before any id is received
+	hashes := make([][]byte, 3*appendStreamBuffer)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	stream, err := client.AppendStream(ctx)
+	r.NoError(err)
+
+	sent := make(chan error, 1)
+	go func() {
+		for i, hash := range hashes {
+			req := &pb.Hash{Hash: hash}
+			if i == 10 {
+				req.Metadata = []byte(`{"index":10}`)
+			}
+
+			if err := stream.Send(req); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- stream.CloseSend()
+	}()
+
+	for i := range hashes {
+		id, err := stream.Recv()
+		r.NoError(err)
+		r.EqualValues(i, id.Id)
+	}
+	_, err = stream.Recv()
+	r.Equal(io.EOF, err)
+	r.NoError(<-sent)
+
+	for _, i := range []int{0, 10, len(hashes) - 1} {
+		hash, err := client.Get(ctx, &pb.ID{Id: uint64(i)})
+		r.NoError(err)
+		r.Equal(hashes[i], hash.Hash)
+	}
+
+	hash, err := client.Get(ctx, &pb.ID{Id: 10})
+	r.NoError(err)
+	r.Equal(`{"index":10}`, string(hash.Metadata))
+
+	// an invalid hash ends the stream after ids of hashes before it
+	stream, err = client.AppendStream(ctx)
+	r.NoError(err)
+	r.NoError(stream.Send(&pb.Hash{Hash: hashes[0]}))
+	r.NoError(stream.Send(&pb.Hash{Hash: hashes[1][:16]}))
+	r.NoError(stream.CloseSend())
+
+	id, err := stream.Recv()
+	r.NoError(err)
+	r.EqualValues(len(hashes), id.Id)
+	_, err = stream.Recv()
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	// a hash of another namespace is rejected instead of being appended to the namespace of the stream
+	_, err = client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.NoError(err)
+
+	mixed := [][]byte{make([]byte, 32), make([]byte, 32)}
+	rand.Read(mixed[0])
+	rand.Read(mixed[1])
+
+	stream, err = client.AppendStream(ctx)
+	r.NoError(err)
+	r.NoError(stream.Send(&pb.Hash{Hash: mixed[0], Namespace: "team"}))
+	r.NoError(stream.Send(&pb.Hash{Hash: mixed[1]}))
+	r.NoError(stream.CloseSend())
+
+	id, err = stream.Recv()
+	r.NoError(err)
+	r.EqualValues(0, id.Id)
+	_, err = stream.Recv()
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Get(ctx, &pb.ID{Id: 1, Namespace: "team"})
+	r.Equal(codes.OutOfRange, status.Code(err))
+	_, err = client.Search(ctx, &pb.Hash{Hash: mixed[1], Namespace: "team"})
+	r.Equal(codes.NotFound, status.Code(err))
+	_, err = client.Search(ctx, &pb.Hash{Hash: mixed[1]})
+	r.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestAppendStreamExisting(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB(), storage.WithDuplicatePolicy(storage.ReturnExisting))
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	hashes := make([][]byte, 3)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = client.Append(context.Background(), &pb.Hash{Hash: hashes[1]})
+	r.NoError(err)
+
+	stream, err := client.AppendStream(context.Background())
+	r.NoError(err)
+	for _, hash := range [][]byte{hashes[0], hashes[1], hashes[2], hashes[0]} {
+		r.NoError(stream.Send(&pb.Hash{Hash: hash}))
+	}
+	r.NoError(stream.CloseSend())
+
+	// appended hashes return their existing ids
+	for _, expected := range []uint64{1, 0, 2, 1} {
+		id, err := stream.Recv()
+		r.NoError(err)
+		r.Equal(expected, id.Id)
+	}
+	_, err = stream.Recv()
+	r.Equal(io.EOF, err)
+}
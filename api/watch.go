@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/storage"
+)
+
+// watchPageSize is the number of checkpoints read at once by WatchDigests
+const watchPageSize = 100
+
+// WatchLeaves streams leaves from the start id, and then every new leaf once it is appended until client cancels
+func (s Server) WatchLeaves(in *pb.WatchRequest, stream pb.Accumulator_WatchLeavesServer) error {
+	s.infoRequest(apiWatchLeaves, "Start", in.Start, "Tail", in.Tail, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiWatchLeaves, "start", in.Start, "Error", err)
+		return err
+	}
+
+	next := in.Start
+	if in.Tail {
+		next = accumulator.Leaves()
+	}
+
+	for {
+		// leaves appended after Changed are either read below or notified by changed
+		changed, err := accumulator.Changed()
+		if err != nil {
+			err = watchError(err)
+			s.infoError(apiWatchLeaves, "start", in.Start, "next", next, "Error", err)
+			return err
+		}
+
+		for ; next < accumulator.Leaves(); next++ {
+			hash, err := accumulator.Get(next)
+			if err != nil {
+				err = watchError(err)
+				s.infoError(apiWatchLeaves, "start", in.Start, "next", next, "Error", err)
+				return err
+			}
+
+			if err := stream.Send(&pb.Leaf{Id: next, Hash: hash}); err != nil {
+				s.infoError(apiWatchLeaves, "start", in.Start, "next", next, "Error", err)
+				return err
+			}
+		}
+
+		select {
+		case <-stream.Context().Done():
+			s.infoResponse(apiWatchLeaves, "start", in.Start, "Next", next)
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-changed:
+		}
+	}
+}
+
+// WatchDigests streams checkpoints from the start index, and then every new checkpoint once it is recorded until
+// client cancels
+func (s Server) WatchDigests(in *pb.WatchRequest, stream pb.Accumulator_WatchDigestsServer) error {
+	s.infoRequest(apiWatchDigests, "Start", in.Start, "Tail", in.Tail, "Namespace", in.Namespace)
+
+	accumulator, err := s.accumulatorOf(in.Namespace)
+	if err != nil {
+		s.infoError(apiWatchDigests, "start", in.Start, "Error", err)
+		return err
+	}
+
+	next := in.Start
+	if in.Tail {
+		_, next, err = accumulator.ListDigests(0, 0)
+		if err != nil {
+			err = watchError(err)
+			s.infoError(apiWatchDigests, "start", in.Start, "Error", err)
+			return err
+		}
+	}
+
+	for {
+		changed, err := accumulator.Changed()
+		if err != nil {
+			err = watchError(err)
+			s.infoError(apiWatchDigests, "start", in.Start, "next", next, "Error", err)
+			return err
+		}
+
+		for {
+			checkpoints, total, err := accumulator.ListDigests(next, watchPageSize)
+			if errors.Is(err, storage.ErrOutOfRange) {
+				// the start index is not recorded yet
+				break
+			} else if err != nil {
+				err = watchError(err)
+				s.infoError(apiWatchDigests, "start", in.Start, "next", next, "Error", err)
+				return err
+			}
+
+			for _, checkpoint := range checkpoints {
+				p, err := s.newCheckpoint(in.Namespace, accumulator, checkpoint)
+				if err != nil {
+					s.infoError(apiWatchDigests, "start", in.Start, "next", next, "Error", err)
+					return err
+				}
+
+				if err := stream.Send(p); err != nil {
+					s.infoError(apiWatchDigests, "start", in.Start, "next", next, "Error", err)
+					return err
+				}
+				next++
+			}
+
+			if next >= total {
+				break
+			}
+		}
+
+		select {
+		case <-stream.Context().Done():
+			s.infoResponse(apiWatchDigests, "start", in.Start, "Next", next)
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-changed:
+		}
+	}
+}
+
+// watchError converts an error of accumulator during watching to status error
+func watchError(err error) error {
+	if errors.Is(err, storage.ErrClosed) {
+		return status.Error(codes.Unavailable, "accumulator is closed")
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
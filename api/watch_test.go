@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/storage"
+)
+
+// testAdminToken is the admin token of test servers
+const testAdminToken = "test-admin-token"
+
+// adminContext returns a context of client with the admin token of test servers
+func adminContext() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", adminTokenScheme+testAdminToken)
+}
+
+// newTestClient serves accumulators of namespaces in memory, and returns a client of the server with a function to
+// stop both. Clients with adminContext can administrate namespaces.
+func newTestClient(r *require.Assertions, namespaces *storage.Namespaces, opts ...Option) (pb.AccumulatorClient, func()) {
+	lis := bufconn.Listen(1 << 20)
+	apiServer := NewServer(namespaces, zap.NewNop().Sugar(), append([]Option{WithAdminToken(testAdminToken)}, opts...)...)
+	grpcServer := grpc.NewServer()
+	pb.RegisterAccumulatorServer(grpcServer, apiServer)
+	go func() { _ = grpcServer.Serve(lis) }()
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	r.NoError(err)
+
+	return pb.NewAccumulatorClient(conn), func() {
+		_ = conn.Close()
+		grpcServer.Stop()
+		apiServer.Stop()
+	}
+}
+
+func TestWatchLeaves(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	hashes := make([][]byte, 6)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = client.AppendBatch(context.Background(), &pb.Hashes{Hashes: hashes[:3]})
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// resume from id 1 and follow new leaves
+	resumed, err := client.WatchLeaves(ctx, &pb.WatchRequest{Start: 1})
+	r.NoError(err)
+	tail, err := client.WatchLeaves(ctx, &pb.WatchRequest{Tail: true})
+	r.NoError(err)
+
+	for i := 1; i < 3; i++ {
+		leaf, err := resumed.Recv()
+		r.NoError(err)
+		r.EqualValues(i, leaf.Id)
+		r.Equal(hashes[i], leaf.Hash)
+	}
+
+	for i := 3; i < len(hashes); i++ {
+		_, err = client.Append(context.Background(), &pb.Hash{Hash: hashes[i]})
+		r.NoError(err)
+	}
+
+	for i := 3; i < len(hashes); i++ {
+		leaf, err := resumed.Recv()
+		r.NoError(err)
+		r.EqualValues(i, leaf.Id)
+
+		leaf, err = tail.Recv()
+		r.NoError(err)
+		r.EqualValues(i, leaf.Id)
+		r.Equal(hashes[i], leaf.Hash)
+	}
+
+	// watchers of a deleted namespace are stopped
+	_, err = client.CreateNamespace(adminContext(), &pb.CreateNamespaceRequest{Namespace: "team"})
+	r.NoError(err)
+	team, err := client.WatchLeaves(ctx, &pb.WatchRequest{Namespace: "team"})
+	r.NoError(err)
+	_, err = client.Append(context.Background(), &pb.Hash{Hash: hashes[0], Namespace: "team"})
+	r.NoError(err)
+	_, err = team.Recv()
+	r.NoError(err)
+
+	_, err = client.DeleteNamespace(adminContext(), &pb.Namespace{Namespace: "team"})
+	r.NoError(err)
+	_, err = team.Recv()
+	r.Equal(codes.Unavailable, status.Code(err))
+
+	team, err = client.WatchLeaves(ctx, &pb.WatchRequest{Namespace: "team"})
+	r.NoError(err)
+	_, err = team.Recv()
+	r.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestWatchDigests(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB())
+	r.NoError(err)
+	namespaces, err := storage.NewNamespaces(merkle, storage.NewMemProvider())
+	r.NoError(err)
+
+	client, stop := newTestClient(r, namespaces)
+	defer stop()
+
+	digests := make([][]byte, 4)
+	for i := range digests {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err = client.Append(context.Background(), &pb.Hash{Hash: hash})
+		r.NoError(err)
+
+		if i < 2 {
+			digest, err := client.GetDigest(context.Background(), &pb.Namespace{})
+			r.NoError(err)
+			digests[i] = digest.Hash
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resumed, err := client.WatchDigests(ctx, &pb.WatchRequest{Start: 1})
+	r.NoError(err)
+
+	checkpoint, err := resumed.Recv()
+	r.NoError(err)
+	r.EqualValues(1, checkpoint.Index)
+	r.Equal(digests[1], checkpoint.Digest)
+
+	// the digest of all leaves is checkpointed once it is asked
+	digest, err := client.GetDigest(context.Background(), &pb.Namespace{})
+	r.NoError(err)
+
+	checkpoint, err = resumed.Recv()
+	r.NoError(err)
+	r.EqualValues(2, checkpoint.Index)
+	r.EqualValues(4, checkpoint.Leaves)
+	r.Equal(digest.Hash, checkpoint.Digest)
+
+	cancel()
+	_, err = resumed.Recv()
+	r.Equal(codes.Canceled, status.Code(err))
+}
@@ -1,15 +1,68 @@
 package cli
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/crypto/sign"
+	"github.com/frankonly/upchain/crypto/verify"
 )
 
 var (
 	endpoint   string
 	secureConn bool
+	treeSize   uint64
+	hashFile   string
+	treeMode   string
+	hashAlgo   string
+	digestHex  string
+	offset     uint64
+	limit      uint32
+	keysFile   string
+	ledgerURL  string
+	namespace  string
+
+	// treeHeadHash and treeHeadMode are the hash algorithm and tree mode which trusted signed tree heads describe, and
+	// are required to verify them, so that they are never taken from upchain server
+	treeHeadHash string
+	treeHeadMode string
+
+	// metadataJSON and metadataPairs are merged as metadata of an appended leaf
+	metadataJSON   string
+	metadataPairs  map[string]string
+	commitMetadata bool
+
+	// namespaceMode and namespaceHash configure a new namespace, which differ from treeMode and hashAlgo by defaults
+	namespaceMode   string
+	namespaceHash   string
+	duplicatePolicy string
+	// adminTokenFile is the file of the admin token to create and delete namespaces
+	adminTokenFile string
+
+	searchAll   bool
+	receiptPath string
+
+	// idempotencyKey identifies an append, so that retrying it returns the original id
+	idempotencyKey string
+	appendTimeout  time.Duration
+
+	// expectedSize and expectedDigest are the precondition of appending, and expectedSize is only used if set
+	expectedSize   uint64
+	expectedDigest string
+
+	watchFrom    uint64
+	watchDigests bool
 )
 
 var rootCmd = &cobra.Command{
@@ -21,17 +74,189 @@ var rootCmd = &cobra.Command{
 func Init() error {
 	rootCmd.PersistentFlags().StringVar(&endpoint, "endpoint", "localhost:10000", "upchain server endpoint")
 	rootCmd.PersistentFlags().BoolVar(&secureConn, "secure", false, "connect with TLS")
+	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "", "namespace of accumulator on upchain server, the default one if empty")
 
 	rootCmd.AddCommand(appendCmd)
 	rootCmd.AddCommand(getCmd)
 	rootCmd.AddCommand(searchCmd)
 	rootCmd.AddCommand(digestCmd)
+	rootCmd.AddCommand(digestsCmd)
 	rootCmd.AddCommand(proofCmd)
 	rootCmd.AddCommand(registerCmd)
+	rootCmd.AddCommand(appendDataCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(consistencyCmd)
+	rootCmd.AddCommand(multiProofCmd)
+	rootCmd.AddCommand(rangeProofCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(checkpointCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(anchorProofCmd)
+	rootCmd.AddCommand(namespaceCmd)
+
+	namespaceCmd.PersistentFlags().StringVar(&adminTokenFile, "admin-token-file", "", "file of the admin token of upchain server to create and delete namespaces")
+	namespaceCmd.AddCommand(namespaceCreateCmd)
+	namespaceCmd.AddCommand(namespaceListCmd)
+	namespaceCmd.AddCommand(namespaceDeleteCmd)
+
+	appendCmd.Flags().StringVar(&hashFile, "file", "", "file of hashes in hex, one hash per line")
+	appendCmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "key of appending one hash, so that appending again with the key returns the original id")
+	appendCmd.Flags().DurationVar(&appendTimeout, "timeout", 3*time.Second, "timeout of appending")
+	registerCmd.Flags().StringVar(&receiptPath, "receipt", "", "file to write the receipt of id, digest, tree size and hash path in JSON, no receipt if empty")
+	digestCmd.Flags().Uint64Var(&treeSize, "size", 0, "number of leaves of a past tree, the latest digest if 0")
+	searchCmd.Flags().BoolVar(&searchAll, "all", false, "list ids of all transactions of the hash page by page")
+	searchCmd.Flags().Uint64Var(&offset, "offset", 0, "index of the first id to list with --all")
+	searchCmd.Flags().Uint32Var(&limit, "limit", 0, "max number of ids to list with --all, decided by upchain server if 0")
+	digestsCmd.Flags().Uint64Var(&offset, "offset", 0, "index of the first checkpoint to list")
+	digestsCmd.Flags().Uint32Var(&limit, "limit", 0, "max number of checkpoints to list, decided by upchain server if 0")
+	watchCmd.Flags().Uint64Var(&watchFrom, "from", 0, "id of the first leaf or index of the first checkpoint to print, only new ones if not set")
+	watchCmd.Flags().BoolVar(&watchDigests, "digests", false, "follow checkpoints of digests instead of leaves")
+	proofCmd.Flags().Uint64Var(&treeSize, "size", 0, "number of leaves of a past tree to prove against instead of digest")
+	for _, cmd := range []*cobra.Command{appendCmd, registerCmd} {
+		cmd.Flags().Uint64Var(&expectedSize, "expected-size", 0, "append only if upchain server has this number of leaves")
+		cmd.Flags().StringVar(&expectedDigest, "expected-digest", "", "append only if the latest digest in hex of upchain server is this one")
+	}
+	for _, cmd := range []*cobra.Command{appendCmd, registerCmd, appendDataCmd} {
+		cmd.Flags().StringVar(&metadataJSON, "metadata", "", "metadata of the leaf as a JSON object")
+		cmd.Flags().StringToStringVar(&metadataPairs, "meta", nil, "metadata of the leaf as KEY=VALUE pairs, merged into --metadata")
+		cmd.Flags().BoolVar(&commitMetadata, "commit-metadata", false, "commit metadata into the leaf, so that it is proved with the leaf")
+	}
+	verifyCmd.Flags().Uint64Var(&treeSize, "size", 0, "number of leaves when the digest was taken, 0 if unknown")
+	digestCmd.Flags().StringVar(&keysFile, "keys", "", "file of trusted public keys in PEM to verify the signed tree head")
+	digestsCmd.Flags().StringVar(&keysFile, "keys", "", "file of trusted public keys in PEM to verify signed tree heads")
+	checkpointCmd.Flags().StringVar(&keysFile, "keys", "", "file of trusted public keys in PEM to verify the signed tree head")
+	proofCmd.Flags().StringVar(&keysFile, "keys", "", "file of trusted public keys in PEM to verify the signed tree head")
+	for _, cmd := range []*cobra.Command{digestCmd, digestsCmd, checkpointCmd, proofCmd} {
+		cmd.Flags().StringVar(&treeHeadHash, "hash", "", "hash algorithm of the namespace (sha256, sha512/256, sha3-256 or blake2b-256), required with --keys")
+		cmd.Flags().StringVar(&treeHeadMode, "mode", "", "tree mode of the namespace (placeholder or rfc6962), required with --keys")
+	}
+	verifyCmd.Flags().StringVar(&treeMode, "mode", crypto.PlaceholderMode.String(), "tree mode of upchain server (placeholder or rfc6962)")
+	consistencyCmd.Flags().StringVar(&treeMode, "mode", crypto.PlaceholderMode.String(), "tree mode of upchain server (placeholder or rfc6962)")
+	multiProofCmd.Flags().StringVar(&digestHex, "digest", "", "digest in hex to prove against, the latest digest if empty")
+	multiProofCmd.Flags().StringVar(&treeMode, "mode", crypto.PlaceholderMode.String(), "tree mode of upchain server (placeholder or rfc6962)")
+	multiProofCmd.Flags().StringVar(&hashAlgo, "hash", crypto.SHA256, "hash algorithm of upchain server (sha256, sha512/256, sha3-256 or blake2b-256)")
+	rangeProofCmd.Flags().StringVar(&digestHex, "digest", "", "digest in hex to prove against, the latest digest if empty")
+	rangeProofCmd.Flags().StringVar(&treeMode, "mode", crypto.PlaceholderMode.String(), "tree mode of upchain server (placeholder or rfc6962)")
+	rangeProofCmd.Flags().StringVar(&hashAlgo, "hash", crypto.SHA256, "hash algorithm of upchain server (sha256, sha512/256, sha3-256 or blake2b-256)")
+	anchorProofCmd.Flags().StringVar(&ledgerURL, "ledger", "", "ledger to check the anchoring transaction, file://PATH or the JSON-RPC URL of an Ethereum node")
+	anchorProofCmd.Flags().StringVar(&treeMode, "mode", crypto.PlaceholderMode.String(), "tree mode of upchain server (placeholder or rfc6962)")
+	anchorProofCmd.Flags().StringVar(&hashAlgo, "hash", crypto.SHA256, "hash algorithm of upchain server (sha256, sha512/256, sha3-256 or blake2b-256)")
+	namespaceCreateCmd.Flags().StringVar(&namespaceMode, "mode", "", "tree mode of the new namespace (placeholder or rfc6962), placeholder if empty")
+	namespaceCreateCmd.Flags().StringVar(&namespaceHash, "hash", "", "hash algorithm of the new namespace (sha256, sha512/256, sha3-256 or blake2b-256), sha256 if empty")
+	namespaceCreateCmd.Flags().StringVar(&duplicatePolicy, "duplicates", "", "how a hash appended again is handled (allow, reject or existing), allow if empty")
+	verifyCmd.Flags().StringVar(&hashAlgo, "hash", crypto.SHA256, "hash algorithm of upchain server (sha256, sha512/256, sha3-256 or blake2b-256)")
+	consistencyCmd.Flags().StringVar(&hashAlgo, "hash", crypto.SHA256, "hash algorithm of upchain server (sha256, sha512/256, sha3-256 or blake2b-256)")
 
 	return nil
 }
 
+// Verifier returns a verifier of the hash algorithm and tree mode in flags
+func Verifier() (*verify.Verifier, error) {
+	mode, err := crypto.ParseTreeMode(treeMode)
+	if err != nil {
+		return nil, err
+	}
+
+	algo, err := crypto.NewHasher(hashAlgo)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := crypto.NewTreeHasher(algo, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return verify.New(hasher), nil
+}
+
+// KeySet returns the trusted key set in the keys file, or nil if no keys file is specified
+func KeySet() (*sign.KeySet, error) {
+	if keysFile == "" {
+		return nil, nil
+	}
+
+	return sign.LoadKeySet(keysFile)
+}
+
+// TreeHeadAccumulator returns the accumulator of namespace in flags, which trusted signed tree heads should describe
+func TreeHeadAccumulator() (sign.Accumulator, error) {
+	if treeHeadHash == "" || treeHeadMode == "" {
+		return sign.Accumulator{}, fmt.Errorf("verifying signed tree heads requires --hash and --mode")
+	}
+
+	mode, err := crypto.ParseTreeMode(treeHeadMode)
+	if err != nil {
+		return sign.Accumulator{}, err
+	}
+
+	algo, err := crypto.NewHasher(treeHeadHash)
+	if err != nil {
+		return sign.Accumulator{}, err
+	}
+
+	return sign.Accumulator{Namespace: namespace, HashAlgorithm: algo.Name(), TreeMode: mode.String()}, nil
+}
+
+// AdminContext returns the context carrying the admin token in the admin token file as a bearer token
+func AdminContext(ctx context.Context) (context.Context, error) {
+	if adminTokenFile == "" {
+		return nil, fmt.Errorf("requires an admin token file")
+	}
+
+	content, err := ioutil.ReadFile(adminTokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+strings.TrimSpace(string(content))), nil
+}
+
+// Metadata returns the metadata in flags merged with fields as a JSON object, or nil if there is no metadata
+func Metadata(fields map[string]interface{}) ([]byte, error) {
+	metadata := make(map[string]interface{}, len(fields)+len(metadataPairs))
+	for key, value := range fields {
+		metadata[key] = value
+	}
+
+	if metadataJSON != "" {
+		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata, which should be a JSON object: %w", err)
+		}
+	}
+
+	for key, value := range metadataPairs {
+		metadata[key] = value
+	}
+
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(metadata)
+}
+
+// Precondition returns the precondition of appending in flags of cmd, or nil if there is no precondition
+func Precondition(cmd *cobra.Command) (*pb.Precondition, error) {
+	sizeSet := cmd.Flags().Changed("expected-size")
+	if !sizeSet && expectedDigest == "" {
+		return nil, nil
+	}
+
+	if sizeSet && expectedDigest != "" {
+		return nil, fmt.Errorf("only one of expected size and expected digest can be specified")
+	}
+
+	digest, err := hex.DecodeString(expectedDigest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expected digest in hex %s: %w", expectedDigest, err)
+	}
+
+	return &pb.Precondition{Size: expectedSize, Digest: digest}, nil
+}
+
 // Execute executes command
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -1,36 +1,133 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/frankonly/upchain/anchor"
 	pb "github.com/frankonly/upchain/api/accumulator"
 	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/crypto/sign"
+	"github.com/frankonly/upchain/crypto/verify"
 )
 
+const (
+	// dataChunkSize is the number of bytes of a file in one message of append-data
+	dataChunkSize = 64 * 1024
+	// importPending is the max number of hashes sent by import before their ids are received
+	importPending = 4096
+)
+
+// importReceipt is printed as one JSON line for each hash appended by import
+type importReceipt struct {
+	ID   uint64 `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// receiptFile is the receipt of a registered file written by register, which proves the leaf to the digest offline
+// with hash algorithm and tree mode of the accumulator. Hashes are in hex.
+type receiptFile struct {
+	Namespace      string          `json:"namespace,omitempty"`
+	ID             uint64          `json:"id"`
+	TreeSize       uint64          `json:"treeSize"`
+	Leaf           string          `json:"leaf"`
+	Digest         string          `json:"digest"`
+	Path           []string        `json:"path"`
+	Sides          []string        `json:"sides,omitempty"`
+	HashAlgorithm  string          `json:"hashAlgorithm"`
+	TreeMode       string          `json:"treeMode"`
+	SignedTreeHead *signedTreeHead `json:"signedTreeHead,omitempty"`
+}
+
+// signedTreeHead is the signed tree head in receiptFile
+type signedTreeHead struct {
+	Timestamp int64  `json:"timestamp"`
+	KeyID     string `json:"keyId"`
+	Signature string `json:"signature"`
+}
+
 var (
 	appendCmd = &cobra.Command{
-		Use:   "append HASH",
-		Short: "Append hash to upchain server",
-		Args:  cobra.ExactArgs(1),
+		Use:   "append [HASH...]",
+		Short: "Append hashes to upchain server, hashes can be also read from a file line by line",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && hashFile == "" {
+				return fmt.Errorf("requires at least 1 hash or a hash file")
+			}
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			hash, err := hex.DecodeString(args[0])
+			if hashFile != "" {
+				content, err := ioutil.ReadFile(hashFile)
+				if err != nil {
+					return fmt.Errorf("invalid file path %s: %w", hashFile, err)
+				}
+
+				for _, line := range strings.Split(string(content), "\n") {
+					if line = strings.TrimSpace(line); line != "" {
+						args = append(args, line)
+					}
+				}
+			}
+
+			hashes := make([][]byte, 0, len(args))
+			for _, arg := range args {
+				hash, err := hex.DecodeString(arg)
+				if err != nil {
+					return fmt.Errorf("invalid hash in hex %s: %w", arg, err)
+				}
+				hashes = append(hashes, hash)
+			}
+
+			metadata, err := Metadata(nil)
 			if err != nil {
-				return fmt.Errorf("invalid hash in hex: %w", err)
+				return err
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			precondition, err := Precondition(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), appendTimeout)
 			defer cancel()
 
-			id, err := Client().Append(ctx, &pb.Hash{Hash: hash})
+			if len(hashes) == 1 {
+				req := &pb.Hash{Hash: hashes[0], Namespace: namespace, Metadata: metadata, CommitMetadata: commitMetadata,
+					Precondition: precondition, IdempotencyKey: idempotencyKey}
+				id, err := Client().Append(ctx, req)
+				if err == nil {
+					fmt.Println("Transaction ID:", id.Id)
+				}
+
+				return err
+			}
+
+			if metadata != nil {
+				return fmt.Errorf("metadata can only be appended with one hash")
+			}
+
+			if idempotencyKey != "" {
+				return fmt.Errorf("idempotency key can only be used with one hash")
+			}
+
+			ids, err := Client().AppendBatch(ctx, &pb.Hashes{Hashes: hashes, Namespace: namespace, Precondition: precondition})
 			if err == nil {
-				fmt.Println("Transaction ID:", id.Id)
+				fmt.Printf("Transaction IDs: %d-%d\n", ids.First, ids.Last)
 			}
 
 			return err
@@ -50,18 +147,26 @@ var (
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 			defer cancel()
 
-			hash, err := Client().Get(ctx, &pb.ID{Id: id})
-			if err == nil {
-				fmt.Println(hex.EncodeToString(hash.Hash))
+			hash, err := Client().Get(ctx, &pb.ID{Id: id, Namespace: namespace})
+			if err != nil {
+				return err
 			}
 
-			return err
+			fmt.Println(hex.EncodeToString(hash.Hash))
+			if len(hash.Metadata) > 0 {
+				fmt.Println("Metadata:", string(hash.Metadata))
+			}
+			if len(hash.CommittedHash) > 0 {
+				fmt.Println("CommittedHash:", hex.EncodeToString(hash.CommittedHash))
+			}
+
+			return nil
 		},
 	}
 
 	searchCmd = &cobra.Command{
 		Use:   "search HASH",
-		Short: "Get id from upchain server by transaction hash",
+		Short: "Get id from upchain server by transaction hash, or ids of all transactions of the hash",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			hash, err := hex.DecodeString(args[0])
@@ -72,12 +177,31 @@ var (
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 			defer cancel()
 
-			id, err := Client().Search(ctx, &pb.Hash{Hash: hash})
-			if err == nil {
-				fmt.Println(id.Id)
+			if searchAll {
+				req := &pb.SearchAllRequest{Hash: hash, Offset: offset, Limit: limit, Namespace: namespace}
+				resp, err := Client().SearchAll(ctx, req)
+				if err != nil {
+					return err
+				}
+
+				for _, id := range resp.Ids {
+					fmt.Println(id)
+				}
+				fmt.Printf("Total: %d, NextOffset: %d\n", resp.Total, resp.NextOffset)
+				return nil
 			}
 
-			return err
+			id, err := Client().Search(ctx, &pb.Hash{Hash: hash, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(id.Id)
+			if len(id.Metadata) > 0 {
+				fmt.Println("Metadata:", string(id.Metadata))
+			}
+
+			return nil
 		},
 	}
 
@@ -89,12 +213,20 @@ var (
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 			defer cancel()
 
-			hash, err := Client().GetDigest(ctx, &pb.Empty{})
-			if err == nil {
-				fmt.Println(hex.EncodeToString(hash.Hash))
+			var hash *pb.Hash
+			var err error
+			if treeSize == 0 {
+				hash, err = Client().GetDigest(ctx, &pb.Namespace{Namespace: namespace})
+			} else {
+				hash, err = Client().GetDigestAt(ctx, &pb.TreeSize{Size: treeSize, Namespace: namespace})
+			}
+			if err != nil {
+				return err
 			}
 
-			return err
+			// tree size is 0 for the latest digest, whose size is only known from its signed tree head
+			fmt.Println(hex.EncodeToString(hash.Hash))
+			return checkTreeHead(hash.SignedTreeHead, hash.Hash, treeSize)
 		},
 	}
 
@@ -118,11 +250,25 @@ var (
 				}
 			}
 
-			if len(args) == 1 {
+			if treeSize != 0 {
+				if len(args) == 2 {
+					return fmt.Errorf("digest and tree size can't be both specified")
+				}
+
+				if hash != nil {
+					found, err := Client().Search(ctx, &pb.Hash{Hash: hash, Namespace: namespace})
+					if err != nil {
+						return err
+					}
+					id = found.Id
+				}
+
+				hashProof, err = Client().GetProofAt(ctx, &pb.GetProofAtRequest{Id: id, Size: treeSize, Namespace: namespace})
+			} else if len(args) == 1 {
 				if hash == nil {
-					hashProof, err = Client().GetProofByID(ctx, &pb.ID{Id: id})
+					hashProof, err = Client().GetProofByID(ctx, &pb.ID{Id: id, Namespace: namespace})
 				} else {
-					hashProof, err = Client().GetProofByHash(ctx, &pb.Hash{Hash: hash})
+					hashProof, err = Client().GetProofByHash(ctx, &pb.Hash{Hash: hash, Namespace: namespace})
 				}
 			} else {
 				var digest []byte
@@ -132,30 +278,44 @@ var (
 				}
 
 				if hash == nil {
-					hashProof, err = Client().GetOldProofByID(ctx, &pb.GetOldProofByIDRequest{Id: id, Digest: digest})
+					hashProof, err = Client().GetOldProofByID(ctx, &pb.GetOldProofByIDRequest{Id: id, Digest: digest, Namespace: namespace})
 				} else {
-					hashProof, err = Client().GetOldProofByHash(ctx, &pb.GetOldProofByHashRequest{Hash: hash, Digest: digest})
+					hashProof, err = Client().GetOldProofByHash(ctx, &pb.GetOldProofByHashRequest{Hash: hash, Digest: digest, Namespace: namespace})
 				}
 			}
 
-			if err == nil {
-				fmt.Println("Hash:", hex.EncodeToString(hashProof.Hash))
-				fmt.Println("Digest:", hex.EncodeToString(hashProof.Digest))
+			if err != nil {
+				return err
+			}
 
-				path := make([]string, 0, len(hashProof.Path))
-				for _, hash := range hashProof.Path {
-					path = append(path, hex.EncodeToString(hash))
-				}
-				fmt.Println("HashPath:", path)
+			fmt.Println("Hash:", hex.EncodeToString(hashProof.Hash))
+			fmt.Println("Digest:", hex.EncodeToString(hashProof.Digest))
+
+			path := make([]string, 0, len(hashProof.Path))
+			for _, hash := range hashProof.Path {
+				path = append(path, hex.EncodeToString(hash))
 			}
+			fmt.Println("HashPath:", path)
 
-			return err
+			// proofs of old servers only have hash, digest and path
+			if hashProof.Version >= verify.HashProofV2 {
+				fmt.Println("ID:", hashProof.Id)
+				fmt.Printf("Tree: %d leaves of %s in %s mode\n", hashProof.TreeSize, hashProof.HashAlgorithm, hashProof.TreeMode)
+				fmt.Println("Sides:", sideNames(hashProof.Sides))
+			}
+
+			size := treeSize
+			if size == 0 && hashProof.Version >= verify.HashProofV2 {
+				size = hashProof.TreeSize
+			}
+
+			return checkTreeHead(hashProof.SignedTreeHead, hashProof.Digest, size)
 		},
 	}
 
 	registerCmd = &cobra.Command{
 		Use:   "register [FILE]",
-		Short: "Register a file to upchain server by saving its hash for proof",
+		Short: "Register a file to upchain server by saving its hash for proof, with its name, size and mtime as metadata",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			fileByte, err := ioutil.ReadFile(args[0])
@@ -163,18 +323,861 @@ var (
 				return fmt.Errorf("invalid file path %s: %w", args[0], err)
 			}
 
-			hash := crypto.Hash(fileByte)
+			stat, err := os.Stat(args[0])
+			if err != nil {
+				return err
+			}
+
+			metadata, err := Metadata(map[string]interface{}{
+				"name":  filepath.Base(args[0]),
+				"size":  stat.Size(),
+				"mtime": stat.ModTime().UTC().Format(time.RFC3339Nano),
+			})
+			if err != nil {
+				return err
+			}
+
+			precondition, err := Precondition(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			// the file is hashed by the same algorithm as upchain server
+			info, err := Client().GetInfo(ctx, &pb.Namespace{Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			hasher, err := crypto.NewHasher(info.HashAlgorithm)
+			if err != nil {
+				return err
+			}
+
+			hash := hasher.Hash(fileByte)
 			fmt.Println("Hash:", hex.EncodeToString(hash))
+			fmt.Println("Metadata:", string(metadata))
+			if commitMetadata {
+				fmt.Println("Leaf:", hex.EncodeToString(crypto.CommitMetadata(hasher, hash, metadata)))
+			}
+
+			req := &pb.Hash{Hash: hash, Namespace: namespace, Metadata: metadata, CommitMetadata: commitMetadata,
+				Precondition: precondition}
+			if receiptPath == "" {
+				id, err := Client().Append(ctx, req)
+				if err == nil {
+					fmt.Println("Transaction ID:", id.Id)
+				}
+
+				return err
+			}
+
+			receipt, err := Client().AppendWithReceipt(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Transaction ID:", receipt.Id)
+			fmt.Println("Digest:", hex.EncodeToString(receipt.Proof.Digest))
+			fmt.Println("TreeSize:", receipt.TreeSize)
+			return writeReceipt(receiptPath, receipt, info)
+		},
+	}
+
+	appendDataCmd = &cobra.Command{
+		Use:   "append-data FILE",
+		Short: "Stream a file to upchain server, which hashes the file and appends its hash",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid file path %s: %w", args[0], err)
+			}
+			defer file.Close()
+
+			metadata, err := Metadata(nil)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			stream, err := Client().AppendData(ctx)
+			if err != nil {
+				return err
+			}
 
+			// namespace and metadata are only sent in the first chunk, which may be empty for an empty file
+			data := &pb.Data{Namespace: namespace, Metadata: metadata, CommitMetadata: commitMetadata}
+			buf := make([]byte, dataChunkSize)
+			for sent := false; ; {
+				n, err := file.Read(buf)
+				if n > 0 || !sent {
+					data.Chunk = buf[:n]
+					if err := stream.Send(data); err != nil {
+						return err
+					}
+					data, sent = &pb.Data{}, true
+				}
+
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+			}
+
+			resp, err := stream.CloseAndRecv()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Hash:", hex.EncodeToString(resp.Hash))
+			fmt.Println("Size:", resp.Size)
+			fmt.Println("Transaction ID:", resp.Id)
+			return nil
+		},
+	}
+
+	importCmd = &cobra.Command{
+		Use:   "import [FILE]",
+		Short: "Stream hashes in hex from a file or stdin line by line to upchain server, and print receipts in JSON lines",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input := os.Stdin
+			if len(args) == 1 && args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid file path %s: %w", args[0], err)
+				}
+				defer file.Close()
+				input = file
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			stream, err := Client().AppendStream(ctx)
+			if err != nil {
+				return err
+			}
+
+			// ids are received in the order of sent hashes, which wait in pending until then
+			pending := make(chan string, importPending)
+			sent := make(chan error, 1)
+			go func() {
+				defer close(pending)
+				sent <- sendHashes(stream, input, pending)
+			}()
+
+			encoder := json.NewEncoder(os.Stdout)
+			for hash := range pending {
+				id, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+
+				if err := encoder.Encode(importReceipt{ID: id.Id, Hash: hash}); err != nil {
+					return err
+				}
+			}
+
+			return <-sent
+		},
+	}
+
+	digestsCmd = &cobra.Command{
+		Use:   "digests",
+		Short: "List checkpoints of indexed digests from upchain server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			resp, err := Client().ListDigests(ctx, &pb.ListDigestsRequest{Offset: offset, Limit: limit, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			keys, err := KeySet()
+			if err != nil {
+				return err
+			}
+
+			var accumulator sign.Accumulator
+			if keys != nil {
+				if accumulator, err = TreeHeadAccumulator(); err != nil {
+					return err
+				}
+			}
+
+			for _, checkpoint := range resp.Checkpoints {
+				fmt.Printf("%d\t%s\tSize: %d\tLeaves: %d\t%s\n", checkpoint.Index,
+					time.Unix(0, checkpoint.Time).Format(time.RFC3339), checkpoint.Size, checkpoint.Leaves,
+					hex.EncodeToString(checkpoint.Digest))
+
+				if keys != nil {
+					if err := verifyTreeHead(keys, accumulator, checkpoint.SignedTreeHead, checkpoint.Digest, checkpoint.Leaves); err != nil {
+						return fmt.Errorf("checkpoint %d: %w", checkpoint.Index, err)
+					}
+				}
+			}
+
+			if resp.NextOffset < resp.Total {
+				fmt.Printf("%d of %d checkpoints, next offset: %d\n", len(resp.Checkpoints), resp.Total, resp.NextOffset)
+			}
+
+			return nil
+		},
+	}
+
+	checkpointCmd = &cobra.Command{
+		Use:   "checkpoint",
+		Short: "Get the latest checkpoint of digest from upchain server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 			defer cancel()
 
-			id, err := Client().Append(ctx, &pb.Hash{Hash: hash})
+			checkpoint, err := Client().GetLatestCheckpoint(ctx, &pb.Namespace{Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Index:", checkpoint.Index)
+			fmt.Println("Time:", time.Unix(0, checkpoint.Time).Format(time.RFC3339Nano))
+			fmt.Println("Size:", checkpoint.Size)
+			fmt.Println("Leaves:", checkpoint.Leaves)
+			fmt.Println("Digest:", hex.EncodeToString(checkpoint.Digest))
+
+			return checkTreeHead(checkpoint.SignedTreeHead, checkpoint.Digest, checkpoint.Leaves)
+		},
+	}
+
+	anchorProofCmd = &cobra.Command{
+		Use:   "anchor-proof (HASH|ID)",
+		Short: "Prove a transaction to an anchored digest, and check the anchoring transaction on ledger if specified",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var id uint64
+			hash, err := hex.DecodeString(args[0])
 			if err == nil {
-				fmt.Println("Transaction ID:", id.Id)
+				found, err := Client().Search(ctx, &pb.Hash{Hash: hash, Namespace: namespace})
+				if err != nil {
+					return err
+				}
+				id = found.Id
+			} else if id, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+				return fmt.Errorf("invalid input %s, need uint64 or hex string", args[0])
+			}
+
+			anchored, err := Client().GetAnchor(ctx, &pb.ID{Id: id, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			hashProof, err := Client().GetOldProofByID(ctx, &pb.GetOldProofByIDRequest{Id: id, Digest: anchored.Digest, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			path := make([]string, 0, len(hashProof.Path))
+			for _, hash := range hashProof.Path {
+				path = append(path, hex.EncodeToString(hash))
+			}
+
+			fmt.Println("ID:", id)
+			fmt.Println("Hash:", hex.EncodeToString(hashProof.Hash))
+			fmt.Println("HashPath:", path)
+			fmt.Println("Digest:", hex.EncodeToString(anchored.Digest))
+			fmt.Println("Leaves:", anchored.Leaves)
+			fmt.Println("Ledger:", anchored.Ledger)
+			fmt.Println("TxID:", anchored.TxId)
+			fmt.Println("Block:", anchored.Block)
+			fmt.Println("Time:", time.Unix(0, anchored.Time).Format(time.RFC3339))
+
+			verifier, err := Verifier()
+			if err != nil {
+				return err
+			}
+
+			// the leaf is proved to the anchored digest rather than the one returned with proof
+			if err := verifier.HashProof(hashProof, id, anchored.Leaves, anchored.Digest); err != nil {
+				return err
+			}
+			fmt.Println("Proof verified")
+
+			if ledgerURL == "" {
+				return nil
+			}
+
+			anchorer, err := anchor.Open(ledgerURL, "")
+			if err != nil {
+				return err
+			}
+
+			if anchorer.Ledger() != anchored.Ledger {
+				return fmt.Errorf("digest is anchored on %s ledger, not %s", anchored.Ledger, anchorer.Ledger())
+			}
+
+			if err := anchorer.Verify(ctx, anchored.TxId, anchored.Digest); err != nil {
+				return err
+			}
+
+			fmt.Println("Anchor verified")
+			return nil
+		},
+	}
+
+	watchCmd = &cobra.Command{
+		Use:   "watch",
+		Short: "Follow new leaves or checkpoints of upchain server like tail -f, from certain id or index if specified",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the stream runs until the command is interrupted
+			req := &pb.WatchRequest{Start: watchFrom, Tail: !cmd.Flags().Changed("from"), Namespace: namespace}
+
+			if watchDigests {
+				stream, err := Client().WatchDigests(context.Background(), req)
+				if err != nil {
+					return err
+				}
+
+				for {
+					checkpoint, err := stream.Recv()
+					if err != nil {
+						return err
+					}
+
+					fmt.Println(checkpoint.Index, checkpoint.Leaves, hex.EncodeToString(checkpoint.Digest),
+						time.Unix(0, checkpoint.Time).Format(time.RFC3339Nano))
+				}
+			}
+
+			stream, err := Client().WatchLeaves(context.Background(), req)
+			if err != nil {
+				return err
 			}
 
+			for {
+				leaf, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+
+				fmt.Println(leaf.Id, hex.EncodeToString(leaf.Hash))
+			}
+		},
+	}
+
+	infoCmd = &cobra.Command{
+		Use:   "info",
+		Short: "Get hash algorithm, tree mode and duplicate policy of merkle accumulator from upchain server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			info, err := Client().GetInfo(ctx, &pb.Namespace{Namespace: namespace})
+			if err == nil {
+				fmt.Println("HashAlgorithm:", info.HashAlgorithm)
+				fmt.Println("HashSize:", info.HashSize)
+				fmt.Println("TreeMode:", info.TreeMode)
+				fmt.Println("DuplicatePolicy:", info.DuplicatePolicy)
+			}
+
+			return err
+		},
+	}
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify ID HASH DIGEST [SIBLING...]",
+		Short: "Verify hash proof of certain transaction against a trusted digest offline",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid id %s: %w", args[0], err)
+			}
+
+			hashes := make([][]byte, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				hash, err := hex.DecodeString(arg)
+				if err != nil {
+					return fmt.Errorf("invalid hash in hex %s: %w", arg, err)
+				}
+				hashes = append(hashes, hash)
+			}
+
+			verifier, err := Verifier()
+			if err != nil {
+				return err
+			}
+
+			p := &pb.HashProof{Hash: hashes[0], Digest: hashes[1], Path: hashes[2:]}
+			if err := verifier.HashProof(p, id, treeSize, p.Digest); err != nil {
+				return err
+			}
+
+			fmt.Println("Verified")
+			return nil
+		},
+	}
+
+	multiProofCmd = &cobra.Command{
+		Use:   "multiproof ID...",
+		Short: "Get a proof of several transactions to one digest from upchain server and verify it",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids := make([]uint64, 0, len(args))
+			for _, arg := range args {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid id %s: %w", arg, err)
+				}
+				ids = append(ids, id)
+			}
+
+			digest, err := hex.DecodeString(digestHex)
+			if err != nil {
+				return fmt.Errorf("invalid digest input %s, need hex string", digestHex)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			proof, err := Client().GetMultiProof(ctx, &pb.GetMultiProofRequest{Ids: ids, Digest: digest, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			if len(proof.Ids) != len(proof.Leaves) {
+				return fmt.Errorf("invalid multi proof with %d ids and %d leaves", len(proof.Ids), len(proof.Leaves))
+			}
+
+			fmt.Println("Digest:", hex.EncodeToString(proof.Digest))
+			fmt.Println("Size:", proof.Size)
+			for i, id := range proof.Ids {
+				fmt.Printf("Leaf %d: %s\n", id, hex.EncodeToString(proof.Leaves[i]))
+			}
+
+			hashes := make([]string, 0, len(proof.Hashes))
+			for _, hash := range proof.Hashes {
+				hashes = append(hashes, hex.EncodeToString(hash))
+			}
+			fmt.Println("Hashes:", hashes)
+
+			// the latest digest returned by server is trusted if digest is not specified
+			if len(digest) == 0 {
+				digest = proof.Digest
+			}
+
+			verifier, err := Verifier()
+			if err != nil {
+				return err
+			}
+
+			if err := verifier.MultiProof(proof, digest); err != nil {
+				return err
+			}
+
+			fmt.Println("Verified")
+			return nil
+		},
+	}
+
+	rangeProofCmd = &cobra.Command{
+		Use:   "range START END",
+		Short: "Get all transactions in [START, END) with a proof to one digest from upchain server and verify it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid start %s: %w", args[0], err)
+			}
+
+			end, err := strconv.ParseUint(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid end %s: %w", args[1], err)
+			}
+
+			digest, err := hex.DecodeString(digestHex)
+			if err != nil {
+				return fmt.Errorf("invalid digest input %s, need hex string", digestHex)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			stream, err := Client().GetRangeProof(ctx, &pb.GetRangeProofRequest{Start: start, End: end, Digest: digest, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			// chunks of the proof are merged in order
+			proof := &pb.RangeProof{}
+			for {
+				chunk, err := stream.Recv()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+
+				proto.Merge(proof, chunk)
+			}
+
+			fmt.Println("Digest:", hex.EncodeToString(proof.Digest))
+			fmt.Println("Size:", proof.Size)
+			for i, leaf := range proof.Leaves {
+				fmt.Printf("Leaf %d: %s\n", proof.Start+uint64(i), hex.EncodeToString(leaf))
+			}
+
+			left := make([]string, 0, len(proof.Left))
+			for _, hash := range proof.Left {
+				left = append(left, hex.EncodeToString(hash))
+			}
+			fmt.Println("Left:", left)
+
+			right := make([]string, 0, len(proof.Right))
+			for _, hash := range proof.Right {
+				right = append(right, hex.EncodeToString(hash))
+			}
+			fmt.Println("Right:", right)
+
+			// the latest digest returned by server is trusted if digest is not specified
+			if len(digest) == 0 {
+				digest = proof.Digest
+			}
+
+			verifier, err := Verifier()
+			if err != nil {
+				return err
+			}
+
+			if proof.Start != start || uint64(len(proof.Leaves)) != end-start {
+				return fmt.Errorf("expect leaves in [%d, %d), got %d leaves from %d", start, end, len(proof.Leaves), proof.Start)
+			}
+
+			if err := verifier.RangeProof(proof, digest); err != nil {
+				return err
+			}
+
+			fmt.Println("Verified")
+			return nil
+		},
+	}
+
+	consistencyCmd = &cobra.Command{
+		Use:   "consistency OLD_DIGEST [NEW_DIGEST]",
+		Short: "Get consistency proof from an old digest to a new digest from upchain server and verify it",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldDigest, err := hex.DecodeString(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid old digest input %s, need hex string", args[0])
+			}
+
+			var newDigest []byte
+			if len(args) == 2 {
+				newDigest, err = hex.DecodeString(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid new digest input %s, need hex string", args[1])
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			proof, err := Client().GetConsistencyProof(ctx, &pb.GetConsistencyProofRequest{OldDigest: oldDigest, NewDigest: newDigest, Namespace: namespace})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("OldDigest:", hex.EncodeToString(proof.OldDigest))
+			fmt.Println("NewDigest:", hex.EncodeToString(proof.NewDigest))
+			fmt.Println("OldSize:", proof.OldSize)
+			fmt.Println("NewSize:", proof.NewSize)
+
+			path := make([]string, 0, len(proof.Path))
+			for _, hash := range proof.Path {
+				path = append(path, hex.EncodeToString(hash))
+			}
+			fmt.Println("HashPath:", path)
+
+			// the latest digest returned by server is trusted if new digest is not specified
+			if newDigest == nil {
+				newDigest = proof.NewDigest
+			}
+
+			verifier, err := Verifier()
+			if err != nil {
+				return err
+			}
+
+			if err := verifier.ConsistencyProof(proof, oldDigest, newDigest); err != nil {
+				return err
+			}
+
+			fmt.Println("Verified")
+			return nil
+		},
+	}
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Get published public keys of upchain server in PEM, which can be saved as trusted keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+
+		resp, err := Client().GetKeys(ctx, &pb.Empty{})
+		if err != nil {
 			return err
+		}
+
+		// key ids are checked against public keys when the key set is parsed
+		keys, err := sign.KeySetFromProto(resp)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys.Keys() {
+			current := ""
+			if key.ID == resp.Current {
+				current = " (current)"
+			}
+			fmt.Printf("# %s %s%s\n", key.ID, key.Algorithm, current)
+		}
+		fmt.Print(string(keys.MarshalPEM()))
+
+		return nil
+	},
+}
+
+var (
+	namespaceCmd = &cobra.Command{
+		Use:   "namespace",
+		Short: "Manage namespaces of upchain server, each of which has its own accumulator",
+	}
+
+	namespaceCreateCmd = &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a namespace with a new accumulator",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			ctx, err := AdminContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			req := &pb.CreateNamespaceRequest{
+				Namespace:       args[0],
+				TreeMode:        namespaceMode,
+				HashAlgorithm:   namespaceHash,
+				DuplicatePolicy: duplicatePolicy,
+			}
+			info, err := Client().CreateNamespace(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Namespace:", args[0])
+			fmt.Println("HashAlgorithm:", info.HashAlgorithm)
+			fmt.Println("TreeMode:", info.TreeMode)
+			fmt.Println("DuplicatePolicy:", info.DuplicatePolicy)
+			return nil
+		},
+	}
+
+	namespaceListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List namespaces of upchain server besides the default one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			resp, err := Client().ListNamespaces(ctx, &pb.Empty{})
+			if err != nil {
+				return err
+			}
+
+			for _, name := range resp.Namespaces {
+				fmt.Println(name)
+			}
+			return nil
+		},
+	}
+
+	namespaceDeleteCmd = &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Delete a namespace with all of its leaves",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			ctx, err := AdminContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			if _, err := Client().DeleteNamespace(ctx, &pb.Namespace{Namespace: args[0]}); err != nil {
+				return err
+			}
+
+			fmt.Println("Deleted:", args[0])
+			return nil
 		},
 	}
 )
+
+// writeReceipt writes the receipt of a leaf appended to the accumulator of info to a file in JSON
+func writeReceipt(path string, receipt *pb.Receipt, info *pb.Info) error {
+	file := receiptFile{
+		Namespace:     namespace,
+		ID:            receipt.Id,
+		TreeSize:      receipt.TreeSize,
+		Leaf:          hex.EncodeToString(receipt.Proof.Hash),
+		Digest:        hex.EncodeToString(receipt.Proof.Digest),
+		Path:          make([]string, 0, len(receipt.Proof.Path)),
+		HashAlgorithm: info.HashAlgorithm,
+		TreeMode:      info.TreeMode,
+	}
+	for _, hash := range receipt.Proof.Path {
+		file.Path = append(file.Path, hex.EncodeToString(hash))
+	}
+	if receipt.Proof.Version >= verify.HashProofV2 {
+		file.Sides = sideNames(receipt.Proof.Sides)
+	}
+
+	if sth := receipt.Proof.SignedTreeHead; sth != nil {
+		file.SignedTreeHead = &signedTreeHead{
+			Timestamp: sth.Timestamp,
+			KeyID:     sth.KeyId,
+			Signature: hex.EncodeToString(sth.Signature),
+		}
+	}
+
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write receipt %s: %w", path, err)
+	}
+
+	fmt.Println("Receipt:", path)
+	return nil
+}
+
+// sideNames returns names of sides of siblings in a hash proof
+func sideNames(sides []pb.Side) []string {
+	names := make([]string, 0, len(sides))
+	for _, side := range sides {
+		names = append(names, side.String())
+	}
+
+	return names
+}
+
+// sendHashes sends hashes in hex read from input line by line to stream, and passes each sent one to pending. The
+// stream is closed for sending at an invalid line, so that ids of hashes before it are still received.
+func sendHashes(stream pb.Accumulator_AppendStreamClient, input io.Reader, pending chan<- string) error {
+	scanner := bufio.NewScanner(input)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hash, err := hex.DecodeString(text)
+		if err != nil {
+			_ = stream.CloseSend()
+			return fmt.Errorf("invalid hash in hex at line %d: %w", line, err)
+		}
+
+		select {
+		case pending <- text:
+		case <-stream.Context().Done():
+			return nil
+		}
+
+		if err := stream.Send(&pb.Hash{Hash: hash, Namespace: namespace}); err != nil {
+			// the error of a broken stream is received with ids
+			return nil
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	return scanner.Err()
+}
+
+// checkTreeHead prints the signed tree head of digest, and verifies it if trusted keys are specified. Size is the number
+// of leaves of digest, or 0 if it is unknown and then only the signed tree head tells it.
+func checkTreeHead(sth *pb.SignedTreeHead, digest []byte, size uint64) error {
+	if sth != nil {
+		fmt.Println("Namespace:", sth.Namespace)
+		fmt.Println("HashAlgorithm:", sth.HashAlgorithm)
+		fmt.Println("TreeMode:", sth.TreeMode)
+		fmt.Println("TreeSize:", sth.TreeSize)
+		fmt.Println("Timestamp:", time.Unix(0, sth.Timestamp).Format(time.RFC3339Nano))
+		fmt.Println("KeyID:", sth.KeyId)
+		fmt.Println("Signature:", hex.EncodeToString(sth.Signature))
+	}
+
+	keys, err := KeySet()
+	if err != nil || keys == nil {
+		return err
+	}
+
+	if sth == nil {
+		return fmt.Errorf("no signed tree head from upchain server")
+	}
+
+	accumulator, err := TreeHeadAccumulator()
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		size = sth.TreeSize
+	}
+
+	if err := verifyTreeHead(keys, accumulator, sth, digest, size); err != nil {
+		return err
+	}
+
+	fmt.Println("Signature verified")
+	return nil
+}
+
+// verifyTreeHead checks that the signed tree head commits to the digest of a tree of accumulator with certain number
+// of leaves
+func verifyTreeHead(keys *sign.KeySet, accumulator sign.Accumulator, sth *pb.SignedTreeHead, digest []byte, size uint64) error {
+	if sth == nil {
+		return fmt.Errorf("no signed tree head from upchain server")
+	}
+
+	if !bytes.Equal(sth.Digest, digest) || sth.TreeSize != size {
+		return fmt.Errorf("signed tree head mismatches digest %s of %d leaves", hex.EncodeToString(digest), size)
+	}
+
+	return keys.VerifyOf(accumulator, sth)
+}
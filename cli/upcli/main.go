@@ -3,7 +3,7 @@ package main
 import (
 	"log"
 
-	"upchain/cli"
+	"github.com/frankonly/upchain/cli"
 )
 
 func main() {
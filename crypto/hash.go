@@ -1,6 +1,93 @@
 package crypto
 
-import "crypto/sha256"
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// HashPlaceholder used to form a hash for calculating when there is no descendant fixed
+const HashPlaceholder = "merkle placeholder"
+
+// metadataContext separates commitments of metadata from hashes of any other data
+const metadataContext = "upchain leaf metadata v1\x00"
+
+// Names of supported hash algorithms
+const (
+	SHA256     = "sha256"
+	SHA512_256 = "sha512/256"
+	SHA3_256   = "sha3-256"
+	BLAKE2b256 = "blake2b-256"
+)
+
+// Hasher hashes bytes by certain algorithm
+type Hasher interface {
+	// Name returns the name of hash algorithm
+	Name() string
+	// Size returns the number of bytes of hash
+	Size() int
+	// Hash hashes bytes
+	Hash(value []byte) []byte
+	// New returns a new hash.Hash for streaming data
+	New() hash.Hash
+}
+
+var hashers = map[string]Hasher{
+	SHA256:     &hasher{name: SHA256, size: sha256.Size, new: sha256.New},
+	SHA512_256: &hasher{name: SHA512_256, size: sha512.Size256, new: sha512.New512_256},
+	SHA3_256:   &hasher{name: SHA3_256, size: 32, new: sha3.New256},
+	BLAKE2b256: &hasher{name: BLAKE2b256, size: blake2b.Size256, new: newBLAKE2b256},
+}
+
+// NewHasher returns the hasher of certain hash algorithm
+func NewHasher(name string) (Hasher, error) {
+	h, ok := hashers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %s", name)
+	}
+
+	return h, nil
+}
+
+// DefaultHasher returns the hasher of SHA256
+func DefaultHasher() Hasher {
+	return hashers[SHA256]
+}
+
+type hasher struct {
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+func (h *hasher) Name() string {
+	return h.name
+}
+
+func (h *hasher) Size() int {
+	return h.size
+}
+
+func (h *hasher) Hash(value []byte) []byte {
+	digest := h.new()
+	digest.Write(value)
+	return digest.Sum(nil)
+}
+
+func (h *hasher) New() hash.Hash {
+	return h.new()
+}
+
+func newBLAKE2b256() hash.Hash {
+	// error is only returned for invalid key
+	digest, _ := blake2b.New256(nil)
+	return digest
+}
 
 // Hash hashes bytes by SHA256
 func Hash(value []byte) []byte {
@@ -12,3 +99,17 @@ func Hash(value []byte) []byte {
 func HashNodes(left []byte, right []byte) []byte {
 	return Hash(append(left, right...))
 }
+
+// CommitMetadata hashes a hash with its metadata into a leaf, so that the metadata is proved with the leaf. The hash is
+// prefixed with its length in 2 bytes to separate it from metadata.
+func CommitMetadata(hasher Hasher, hash, metadata []byte) []byte {
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(hash)))
+
+	digest := hasher.New()
+	digest.Write([]byte(metadataContext))
+	digest.Write(length)
+	digest.Write(hash)
+	digest.Write(metadata)
+	return digest.Sum(nil)
+}
@@ -43,3 +43,49 @@ func TestHashNodes(t *testing.T) {
 		r.Equal(expects[i], hashString)
 	}
 }
+
+func TestHasher(t *testing.T) {
+	r := require.New(t)
+
+	// digests of "abc"
+	vectors := map[string]string{
+		SHA256:     "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		SHA512_256: "53048e2681941ef99b2e29b76b4c7dabe4c2d0c634fc6d46e0e2f13107e7af23",
+		SHA3_256:   "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532",
+		BLAKE2b256: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+	}
+
+	for name, expected := range vectors {
+		hasher, err := NewHasher(name)
+		r.NoError(err)
+		r.Equal(name, hasher.Name())
+		r.Equal(hasher.Size(), len(hasher.Hash(nil)))
+		r.Equal(expected, hex.EncodeToString(hasher.Hash([]byte("abc"))))
+
+		digest := hasher.New()
+		digest.Write([]byte("a"))
+		digest.Write([]byte("bc"))
+		r.Equal(expected, hex.EncodeToString(digest.Sum(nil)))
+	}
+
+	r.Equal(Hash([]byte("abc")), DefaultHasher().Hash([]byte("abc")))
+
+	_, err := NewHasher("md5")
+	r.Error(err)
+}
+
+func TestCommitMetadata(t *testing.T) {
+	r := require.New(t)
+
+	hasher := DefaultHasher()
+	hash := hasher.Hash([]byte("abc"))
+	leaf := CommitMetadata(hasher, hash, []byte(`{"name":"abc"}`))
+	r.Len(leaf, hasher.Size())
+	r.Equal(leaf, CommitMetadata(hasher, hash, []byte(`{"name":"abc"}`)))
+
+	r.NotEqual(leaf, CommitMetadata(hasher, hash, []byte(`{"name":"abd"}`)))
+	r.NotEqual(leaf, CommitMetadata(hasher, hash, nil))
+
+	// bytes can't be moved between hash and metadata
+	r.NotEqual(CommitMetadata(hasher, []byte("ab"), []byte("c")), CommitMetadata(hasher, []byte("a"), []byte("bc")))
+}
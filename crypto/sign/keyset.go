@@ -0,0 +1,170 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+)
+
+// KeySet is a set of published public keys, so that tree heads signed by retired keys are still verifiable after
+// key rotation
+type KeySet struct {
+	keys  map[string]*PublicKey
+	order []string
+}
+
+// NewKeySet returns a key set of public keys
+func NewKeySet(keys ...*PublicKey) *KeySet {
+	set := &KeySet{keys: make(map[string]*PublicKey, len(keys))}
+	for _, key := range keys {
+		set.Add(key)
+	}
+
+	return set
+}
+
+// ParseKeySet parses a key set from public keys in PEM, one block per key
+func ParseKeySet(content []byte) (*KeySet, error) {
+	set := NewKeySet()
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("%w: PEM block %s", ErrUnsupportedKey, block.Type)
+		}
+
+		key, err := ParsePublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		set.Add(key)
+	}
+
+	if len(bytes.TrimSpace(content)) != 0 {
+		return nil, fmt.Errorf("invalid PEM content")
+	}
+
+	return set, nil
+}
+
+// LoadKeySet reads public keys in PEM from files into one key set
+func LoadKeySet(paths ...string) (*KeySet, error) {
+	set := NewKeySet()
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := ParseKeySet(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key set %s: %w", path, err)
+		}
+
+		for _, key := range keys.Keys() {
+			set.Add(key)
+		}
+	}
+
+	return set, nil
+}
+
+// KeySetFromProto converts the key set published by upchain server
+func KeySetFromProto(p *pb.KeySet) (*KeySet, error) {
+	set := NewKeySet()
+	for _, k := range p.Keys {
+		key, err := ParsePublicKey(k.Der)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.ID != k.KeyId {
+			return nil, fmt.Errorf("key id %s mismatches public key %s", k.KeyId, key.ID)
+		}
+
+		set.Add(key)
+	}
+
+	return set, nil
+}
+
+// Add adds a public key to key set, which is ignored if it is already in the set
+func (s *KeySet) Add(key *PublicKey) {
+	if _, ok := s.keys[key.ID]; ok {
+		return
+	}
+
+	s.keys[key.ID] = key
+	s.order = append(s.order, key.ID)
+}
+
+// Get returns the public key of certain key id
+func (s *KeySet) Get(id string) (*PublicKey, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	return key, nil
+}
+
+// Keys returns public keys in the order of adding
+func (s *KeySet) Keys() []*PublicKey {
+	keys := make([]*PublicKey, 0, len(s.order))
+	for _, id := range s.order {
+		keys = append(keys, s.keys[id])
+	}
+
+	return keys
+}
+
+// Verify checks the signed tree head by the public key of its key id
+func (s *KeySet) Verify(sth *pb.SignedTreeHead) error {
+	if sth == nil {
+		return fmt.Errorf("%w: no signed tree head", ErrInvalidSignature)
+	}
+
+	key, err := s.Get(sth.KeyId)
+	if err != nil {
+		return err
+	}
+
+	return key.Verify(sth)
+}
+
+// VerifyOf checks that the signed tree head describes the accumulator, and verifies it by the public key of its key id
+func (s *KeySet) VerifyOf(accumulator Accumulator, sth *pb.SignedTreeHead) error {
+	if err := s.Verify(sth); err != nil {
+		return err
+	}
+
+	return accumulator.Check(sth)
+}
+
+// Proto converts key set to the message published by upchain server
+func (s *KeySet) Proto(current string) *pb.KeySet {
+	p := &pb.KeySet{Keys: make([]*pb.PublicKey, 0, len(s.order)), Current: current}
+	for _, key := range s.Keys() {
+		p.Keys = append(p.Keys, &pb.PublicKey{KeyId: key.ID, Algorithm: key.Algorithm, Der: key.DER()})
+	}
+
+	return p
+}
+
+// MarshalPEM encodes public keys in PEM, which can be parsed by ParseKeySet
+func (s *KeySet) MarshalPEM() []byte {
+	var buf bytes.Buffer
+	for _, key := range s.Keys() {
+		_ = pem.Encode(&buf, &pem.Block{Type: "PUBLIC KEY", Bytes: key.DER()})
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,242 @@
+// Package sign signs tree heads of merkle accumulator by server keys and verifies them by published key sets.
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+)
+
+// Names of supported signature algorithms
+const (
+	Ed25519   = "ed25519"
+	ECDSAP256 = "ecdsa-p256"
+)
+
+// treeHeadContext separates signatures of tree heads from signatures of anything else by the same key
+const treeHeadContext = "upchain signed tree head v2\x00"
+
+var (
+	// ErrUnsupportedKey indicates that the key is neither ed25519 nor ECDSA P-256
+	ErrUnsupportedKey = fmt.Errorf("unsupported key")
+	// ErrUnknownKey indicates that the key id is not in the key set
+	ErrUnknownKey = fmt.Errorf("unknown key")
+	// ErrInvalidSignature indicates that the signature does not match the tree head
+	ErrInvalidSignature = fmt.Errorf("invalid signature")
+	// ErrMismatchedAccumulator indicates that the tree head describes another accumulator
+	ErrMismatchedAccumulator = fmt.Errorf("mismatched accumulator")
+)
+
+// Accumulator identifies the merkle accumulator a tree head describes, which is signed with the digest so that a tree
+// head of one namespace can't be presented as one of another namespace, or of another hash algorithm or tree mode
+type Accumulator struct {
+	Namespace     string
+	HashAlgorithm string
+	TreeMode      string
+}
+
+// Check checks that the signed tree head describes the accumulator
+func (a Accumulator) Check(sth *pb.SignedTreeHead) error {
+	if sth.Namespace != a.Namespace || sth.HashAlgorithm != a.HashAlgorithm || sth.TreeMode != a.TreeMode {
+		return fmt.Errorf("%w: tree head of namespace %q, %s and %s mode, expected namespace %q, %s and %s mode",
+			ErrMismatchedAccumulator, sth.Namespace, sth.HashAlgorithm, sth.TreeMode,
+			a.Namespace, a.HashAlgorithm, a.TreeMode)
+	}
+
+	return nil
+}
+
+// Signer signs tree heads by a private key
+type Signer struct {
+	key       crypto.Signer
+	publicKey *PublicKey
+}
+
+// NewSigner returns a signer of an ed25519 or ECDSA P-256 private key
+func NewSigner(key crypto.Signer) (*Signer, error) {
+	publicKey, err := NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signer{key: key, publicKey: publicKey}, nil
+}
+
+// LoadSigner reads a private key in PEM, either PKCS #8 or SEC 1 for ECDSA, and returns its signer
+func LoadSigner(path string) (*Signer, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %s", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+
+	return NewSigner(signer)
+}
+
+// PublicKey returns the public key of signer
+func (s *Signer) PublicKey() *PublicKey {
+	return s.publicKey
+}
+
+// KeyID returns the key id of signer
+func (s *Signer) KeyID() string {
+	return s.publicKey.ID
+}
+
+// Sign signs the digest of a tree of accumulator with certain number of leaves at certain time
+func (s *Signer) Sign(accumulator Accumulator, digest []byte, size uint64, timestamp time.Time) (*pb.SignedTreeHead, error) {
+	sth := &pb.SignedTreeHead{
+		Digest:        digest,
+		TreeSize:      size,
+		Timestamp:     timestamp.UnixNano(),
+		KeyId:         s.publicKey.ID,
+		Namespace:     accumulator.Namespace,
+		HashAlgorithm: accumulator.HashAlgorithm,
+		TreeMode:      accumulator.TreeMode,
+	}
+
+	var err error
+	message := serialize(sth)
+	switch s.publicKey.Algorithm {
+	case Ed25519:
+		sth.Signature, err = s.key.Sign(rand.Reader, message, crypto.Hash(0))
+	default:
+		hash := sha256.Sum256(message)
+		sth.Signature, err = s.key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sth, nil
+}
+
+// PublicKey verifies signed tree heads of certain key id
+type PublicKey struct {
+	ID        string
+	Algorithm string
+	key       crypto.PublicKey
+	der       []byte
+}
+
+// NewPublicKey returns the public key of an ed25519 or ECDSA P-256 key
+func NewPublicKey(key crypto.PublicKey) (*PublicKey, error) {
+	var algorithm string
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		algorithm = Ed25519
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		algorithm = ECDSAP256
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicKey{ID: keyID(der), Algorithm: algorithm, key: key, der: der}, nil
+}
+
+// ParsePublicKey parses a public key in PKIX, ASN.1 DER form
+func ParsePublicKey(der []byte) (*PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPublicKey(key)
+}
+
+// DER returns the PKIX, ASN.1 DER form of public key
+func (k *PublicKey) DER() []byte {
+	return k.der
+}
+
+// Verify checks the signature of signed tree head, regardless of its key id
+func (k *PublicKey) Verify(sth *pb.SignedTreeHead) error {
+	message := serialize(sth)
+
+	var ok bool
+	switch key := k.key.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, message, sth.Signature)
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(message)
+		ok = ecdsa.VerifyASN1(key, hash[:], sth.Signature)
+	}
+
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// keyID is the first 8 bytes of SHA256 of public key in hex
+func keyID(der []byte) string {
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:8])
+}
+
+// serialize encodes the signed part of tree head as context, the length-prefixed namespace, hash algorithm and tree
+// mode, tree size, timestamp and the length-prefixed digest
+func serialize(sth *pb.SignedTreeHead) []byte {
+	message := []byte(treeHeadContext)
+	for _, field := range []string{sth.Namespace, sth.HashAlgorithm, sth.TreeMode} {
+		message = appendPrefixed(message, []byte(field))
+	}
+
+	fields := make([]byte, 16)
+	binary.BigEndian.PutUint64(fields, sth.TreeSize)
+	binary.BigEndian.PutUint64(fields[8:], uint64(sth.Timestamp))
+	message = append(message, fields...)
+
+	return appendPrefixed(message, sth.Digest)
+}
+
+// appendPrefixed appends a field prefixed by its length in 2 bytes
+func appendPrefixed(message []byte, field []byte) []byte {
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(field)))
+
+	return append(append(message, length...), field...)
+}
@@ -0,0 +1,128 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testAccumulator = Accumulator{Namespace: "test", HashAlgorithm: "sha256", TreeMode: "placeholder"}
+
+func TestSigner(t *testing.T) {
+	r := require.New(t)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+
+	for _, key := range []interface{}{edKey, ecKey} {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		r.NoError(err)
+
+		path := filepath.Join(os.TempDir(), "upchain_sign_key.pem")
+		r.NoError(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+		signer, err := LoadSigner(path)
+		r.NoError(err)
+		r.NoError(os.Remove(path))
+		r.Len(signer.KeyID(), 16)
+
+		digest := make([]byte, 32)
+		rand.Read(digest)
+
+		sth, err := signer.Sign(testAccumulator, digest, 42, time.Now())
+		r.NoError(err)
+		r.Equal(signer.KeyID(), sth.KeyId)
+		r.NoError(signer.PublicKey().Verify(sth))
+
+		sth.TreeSize++
+		r.True(errors.Is(signer.PublicKey().Verify(sth), ErrInvalidSignature))
+		sth.TreeSize--
+
+		// a tree head can't be presented as one of another namespace, hash algorithm or tree mode
+		sth.Namespace = ""
+		r.True(errors.Is(signer.PublicKey().Verify(sth), ErrInvalidSignature))
+		sth.Namespace = testAccumulator.Namespace
+
+		sth.HashAlgorithm = "sha3-256"
+		r.True(errors.Is(signer.PublicKey().Verify(sth), ErrInvalidSignature))
+		sth.HashAlgorithm = testAccumulator.HashAlgorithm
+
+		sth.TreeMode = "rfc6962"
+		r.True(errors.Is(signer.PublicKey().Verify(sth), ErrInvalidSignature))
+		sth.TreeMode = testAccumulator.TreeMode
+		r.NoError(signer.PublicKey().Verify(sth))
+
+		sth.Digest = append([]byte{}, digest...)
+		sth.Digest[0] ^= 1
+		r.True(errors.Is(signer.PublicKey().Verify(sth), ErrInvalidSignature))
+	}
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	r.NoError(err)
+	_, err = NewSigner(p384)
+	r.True(errors.Is(err, ErrUnsupportedKey))
+}
+
+func TestKeySet(t *testing.T) {
+	r := require.New(t)
+
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+
+	oldSigner, err := NewSigner(oldKey)
+	r.NoError(err)
+	newSigner, err := NewSigner(newKey)
+	r.NoError(err)
+
+	digest := make([]byte, 32)
+	rand.Read(digest)
+
+	oldHead, err := oldSigner.Sign(testAccumulator, digest, 1, time.Now())
+	r.NoError(err)
+	newHead, err := newSigner.Sign(testAccumulator, digest, 1, time.Now())
+	r.NoError(err)
+
+	// tree heads signed by the retired key are still verifiable after rotation
+	set := NewKeySet(oldSigner.PublicKey(), newSigner.PublicKey(), oldSigner.PublicKey())
+	r.Len(set.Keys(), 2)
+	r.NoError(set.Verify(oldHead))
+	r.NoError(set.Verify(newHead))
+
+	parsed, err := ParseKeySet(set.MarshalPEM())
+	r.NoError(err)
+	r.NoError(parsed.Verify(oldHead))
+	r.NoError(parsed.Verify(newHead))
+
+	fromProto, err := KeySetFromProto(set.Proto(newSigner.KeyID()))
+	r.NoError(err)
+	r.Len(fromProto.Keys(), 2)
+	r.NoError(fromProto.Verify(newHead))
+
+	// a validly signed tree head of another accumulator is rejected
+	r.NoError(set.VerifyOf(testAccumulator, newHead))
+	other := testAccumulator
+	other.Namespace = "other"
+	r.True(errors.Is(set.VerifyOf(other, newHead), ErrMismatchedAccumulator))
+
+	newOnly := NewKeySet(newSigner.PublicKey())
+	r.True(errors.Is(newOnly.Verify(oldHead), ErrUnknownKey))
+
+	// a signature can't be moved to another key id
+	newHead.KeyId = oldHead.KeyId
+	r.True(errors.Is(set.Verify(newHead), ErrInvalidSignature))
+}
@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// TreeMode decides how leaves and nodes of merkle tree are hashed
+type TreeMode byte
+
+const (
+	// PlaceholderMode keeps leaves as they are, hashes left||right as node and pads missing subtrees with placeholder
+	PlaceholderMode TreeMode = iota
+	// RFC6962Mode hashes 0x00||leaf as leaf and 0x01||left||right as node, and promotes the left child when right
+	// subtree is missing, which is compatible with Certificate Transparency
+	RFC6962Mode
+)
+
+// RFC 6962 domain separation prefixes
+const (
+	rfc6962LeafPrefix = 0x00
+	rfc6962NodePrefix = 0x01
+)
+
+var treeModeNames = map[TreeMode]string{
+	PlaceholderMode: "placeholder",
+	RFC6962Mode:     "rfc6962",
+}
+
+// ParseTreeMode parses tree mode from its name
+func ParseTreeMode(name string) (TreeMode, error) {
+	for mode, modeName := range treeModeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown tree mode %s", name)
+}
+
+// String returns the name of tree mode
+func (m TreeMode) String() string {
+	if name, ok := treeModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown(%d)", byte(m))
+}
+
+// TreeHasher hashes leaves and nodes of merkle tree by certain hash algorithm in certain tree mode
+type TreeHasher struct {
+	hasher      Hasher
+	mode        TreeMode
+	placeholder []byte
+}
+
+// NewTreeHasher returns a tree hasher of certain hash algorithm and tree mode
+func NewTreeHasher(hasher Hasher, mode TreeMode) (*TreeHasher, error) {
+	switch mode {
+	case PlaceholderMode:
+		return &TreeHasher{hasher: hasher, mode: mode, placeholder: hasher.Hash([]byte(HashPlaceholder))}, nil
+	case RFC6962Mode:
+		return &TreeHasher{hasher: hasher, mode: mode}, nil
+	default:
+		return nil, fmt.Errorf("unknown tree mode %d", byte(mode))
+	}
+}
+
+// Hasher returns the hasher of hash algorithm
+func (h *TreeHasher) Hasher() Hasher {
+	return h.hasher
+}
+
+// Mode returns the tree mode of hasher
+func (h *TreeHasher) Mode() TreeMode {
+	return h.mode
+}
+
+// Empty returns the hash of a subtree without any leaf, which is nil if the subtree is omitted
+func (h *TreeHasher) Empty() []byte {
+	return h.placeholder
+}
+
+// HashLeaf returns the hash of a leaf as a node of tree
+func (h *TreeHasher) HashLeaf(leaf []byte) []byte {
+	if h.mode == RFC6962Mode {
+		return h.hasher.Hash(append([]byte{rfc6962LeafPrefix}, leaf...))
+	}
+
+	return leaf
+}
+
+// HashChildren returns the hash of parent node. If right subtree is omitted, the left child is promoted as parent.
+func (h *TreeHasher) HashChildren(left, right []byte) []byte {
+	if right == nil {
+		return left
+	}
+
+	if h.mode == RFC6962Mode {
+		value := make([]byte, 0, 1+len(left)+len(right))
+		value = append(value, rfc6962NodePrefix)
+		value = append(value, left...)
+		return h.hasher.Hash(append(value, right...))
+	}
+
+	value := make([]byte, 0, len(left)+len(right))
+	value = append(value, left...)
+	return h.hasher.Hash(append(value, right...))
+}
+
+// Subtree is a perfect subtree covering leaves in [Start, Start+2^Level)
+type Subtree struct {
+	Start uint64
+	Level int
+}
+
+// SubtreesOfRange returns the largest subtrees which exactly cover leaves in [start, end) from left to right. Both
+// provers and verifiers of consistency proofs decompose ranges by it, so that they never disagree on the path.
+func SubtreesOfRange(start, end uint64) []Subtree {
+	subtrees := make([]Subtree, 0, 128)
+	for start < end {
+		level := bits.TrailingZeros64(start)
+		if level > 63 {
+			level = 63
+		}
+
+		for level > 0 && start+1<<level > end {
+			level--
+		}
+
+		subtrees = append(subtrees, Subtree{Start: start, Level: level})
+		start += 1 << level
+	}
+
+	return subtrees
+}
@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTreeMode(t *testing.T) {
+	r := require.New(t)
+
+	for _, mode := range []TreeMode{PlaceholderMode, RFC6962Mode} {
+		parsed, err := ParseTreeMode(mode.String())
+		r.NoError(err)
+		r.Equal(mode, parsed)
+	}
+
+	_, err := ParseTreeMode("unknown")
+	r.Error(err)
+
+	_, err = NewTreeHasher(DefaultHasher(), TreeMode(0xff))
+	r.Error(err)
+}
+
+func TestTreeHasher(t *testing.T) {
+	r := require.New(t)
+
+	left := Hash([]byte("left"))
+	right := Hash([]byte("right"))
+
+	hasher, err := NewTreeHasher(DefaultHasher(), PlaceholderMode)
+	r.NoError(err)
+	r.Equal(Hash([]byte(HashPlaceholder)), hasher.Empty())
+	r.Equal(left, hasher.HashLeaf(left))
+	r.Equal(HashNodes(left, right), hasher.HashChildren(left, right))
+
+	hasher, err = NewTreeHasher(DefaultHasher(), RFC6962Mode)
+	r.NoError(err)
+	r.Nil(hasher.Empty())
+	r.Equal(left, hasher.HashChildren(left, nil))
+
+	// test vectors of RFC 6962 from Certificate Transparency
+	leaf := hasher.HashLeaf([]byte{})
+	r.Equal("6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d", hex.EncodeToString(leaf))
+
+	root := hasher.HashChildren(leaf, hasher.HashLeaf([]byte{0x00}))
+	r.Equal("fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125", hex.EncodeToString(root))
+}
+
+func TestSubtreesOfRange(t *testing.T) {
+	r := require.New(t)
+
+	r.Empty(SubtreesOfRange(3, 3))
+	r.Equal([]Subtree{{Start: 0, Level: 2}, {Start: 4, Level: 1}, {Start: 6, Level: 0}}, SubtreesOfRange(0, 7))
+	r.Equal([]Subtree{{Start: 3, Level: 0}, {Start: 4, Level: 2}, {Start: 8, Level: 3}}, SubtreesOfRange(3, 16))
+
+	// subtrees are the largest ones, which exactly cover the range from left to right
+	for start := uint64(0); start < 40; start++ {
+		for end := start; end < 80; end++ {
+			next := start
+			for _, subtree := range SubtreesOfRange(start, end) {
+				r.Equal(next, subtree.Start)
+				r.Zero(subtree.Start % (1 << subtree.Level))
+				next += 1 << subtree.Level
+				r.True(subtree.Start%(1<<(subtree.Level+1)) != 0 || next+1<<subtree.Level > end)
+			}
+			r.Equal(end, next)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+)
+
+// subtree is a perfect subtree covering leaves in [start, start+2^level)
+type subtree struct {
+	start uint64
+	level int
+	hash  []byte
+}
+
+// Consistency checks the consistency proof by the default verifier
+func Consistency(oldDigest, newDigest []byte, oldSize, newSize uint64, path [][]byte) error {
+	return defaultVerifier.Consistency(oldDigest, newDigest, oldSize, newSize, path)
+}
+
+// ConsistencyProof checks the consistency proof returned by upchain server by the default verifier
+func ConsistencyProof(p *pb.ConsistencyProof, oldDigest, newDigest []byte) error {
+	return defaultVerifier.ConsistencyProof(p, oldDigest, newDigest)
+}
+
+// Consistency checks that the tree of old digest with oldSize leaves is a prefix of the tree of new digest with
+// newSize leaves. The path begins with the largest subtrees covering all leaves of old tree and continues with the
+// largest subtrees covering the rest leaves of new tree, both from left to right. Omitted empty subtrees are not
+// a part of the path.
+func (v *Verifier) Consistency(oldDigest, newDigest []byte, oldSize, newSize uint64, path [][]byte) error {
+	if oldSize == 0 || oldSize > newSize {
+		return fmt.Errorf("%w: old size %d and new size %d", ErrInvalidProof, oldSize, newSize)
+	}
+
+	empty := v.hasher.Empty()
+	frozen := newSubtrees(0, oldSize)
+	rest := newSubtrees(oldSize, 1<<bits.Len64(newSize-1))
+
+	next := 0
+	for i := range frozen {
+		if next >= len(path) {
+			return fmt.Errorf("%w: too few hashes", ErrInvalidProof)
+		}
+
+		frozen[i].hash = path[next]
+		next++
+	}
+
+	for i := range rest {
+		isEmpty := rest[i].start >= newSize
+		if isEmpty && empty == nil {
+			continue
+		}
+
+		if next >= len(path) {
+			return fmt.Errorf("%w: too few hashes", ErrInvalidProof)
+		}
+
+		rest[i].hash = path[next]
+		next++
+
+		if isEmpty && !bytes.Equal(rest[i].hash, empty) {
+			return fmt.Errorf("%w: subtree from leaf %d should be empty subtree", ErrInvalidProof, rest[i].start)
+		}
+	}
+
+	if next != len(path) {
+		return fmt.Errorf("%w: expect %d hashes, got %d", ErrInvalidProof, next, len(path))
+	}
+
+	// the old tree is padded with empty subtrees
+	oldTree := append([]subtree{}, frozen...)
+	for _, t := range newSubtrees(oldSize, 1<<bits.Len64(oldSize-1)) {
+		t.hash = empty
+		oldTree = append(oldTree, t)
+	}
+
+	if !bytes.Equal(v.mergeSubtrees(oldTree), oldDigest) {
+		return fmt.Errorf("%w: old digest", ErrDigestMismatch)
+	}
+
+	if !bytes.Equal(v.mergeSubtrees(append(frozen, rest...)), newDigest) {
+		return fmt.Errorf("%w: new digest", ErrDigestMismatch)
+	}
+
+	return nil
+}
+
+// ConsistencyProof checks the consistency proof returned by upchain server against trusted digests
+func (v *Verifier) ConsistencyProof(p *pb.ConsistencyProof, oldDigest, newDigest []byte) error {
+	if p == nil {
+		return fmt.Errorf("%w: nil proof", ErrInvalidProof)
+	}
+
+	if !bytes.Equal(p.OldDigest, oldDigest) || !bytes.Equal(p.NewDigest, newDigest) {
+		return ErrDigestMismatch
+	}
+
+	return v.Consistency(oldDigest, newDigest, p.OldSize, p.NewSize, p.Path)
+}
+
+// newSubtrees returns the subtrees of crypto.SubtreesOfRange covering leaves in [start, end) without hashes
+func newSubtrees(start, end uint64) []subtree {
+	ranges := crypto.SubtreesOfRange(start, end)
+	subtrees := make([]subtree, 0, len(ranges))
+	for _, t := range ranges {
+		subtrees = append(subtrees, subtree{start: t.Start, level: t.Level})
+	}
+
+	return subtrees
+}
+
+// mergeSubtrees merges adjacent subtrees from left to right and returns the hash of the final root
+func (v *Verifier) mergeSubtrees(subtrees []subtree) []byte {
+	stack := make([]subtree, 0, len(subtrees))
+	for _, t := range subtrees {
+		stack = append(stack, t)
+
+		for len(stack) > 1 {
+			left, right := stack[len(stack)-2], stack[len(stack)-1]
+			if left.level != right.level || (left.start>>left.level)&1 != 0 {
+				break
+			}
+
+			stack = stack[:len(stack)-2]
+			stack = append(stack, subtree{start: left.start, level: left.level + 1, hash: v.hasher.HashChildren(left.hash, right.hash)})
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil
+	}
+
+	return stack[0].hash
+}
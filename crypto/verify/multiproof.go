@@ -0,0 +1,115 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+)
+
+// Multi checks the multi proof by the default verifier
+func Multi(leaves [][]byte, ids []uint64, size uint64, hashes [][]byte, digest []byte) error {
+	return defaultVerifier.Multi(leaves, ids, size, hashes, digest)
+}
+
+// MultiProof checks the multi proof returned by upchain server by the default verifier
+func MultiProof(p *pb.MultiProof, digest []byte) error {
+	return defaultVerifier.MultiProof(p, digest)
+}
+
+// MultiRoot recomputes the root from several leaves with strictly increasing ids and the minimal sibling hashes.
+// Hashes are ordered level by level from bottom to top and from left to right on each level. Siblings which are
+// empty subtrees are not a part of hashes, since they are decided by the size. In placeholder mode, the size is
+// not bound as tightly as in single proofs, which contain the empty subtrees.
+func (v *Verifier) MultiRoot(leaves [][]byte, ids []uint64, size uint64, hashes [][]byte) ([]byte, error) {
+	if len(ids) == 0 || len(ids) != len(leaves) {
+		return nil, fmt.Errorf("%w: %d ids with %d leaves", ErrInvalidProof, len(ids), len(leaves))
+	}
+
+	positions := make([]uint64, 0, len(ids))
+	nodes := make([][]byte, 0, len(ids))
+	for i, id := range ids {
+		if i > 0 && id <= ids[i-1] {
+			return nil, fmt.Errorf("%w: ids are not strictly increasing", ErrInvalidProof)
+		}
+
+		if id >= size {
+			return nil, fmt.Errorf("%w: id %d is out of tree size %d", ErrInvalidProof, id, size)
+		}
+
+		positions = append(positions, id)
+		nodes = append(nodes, v.hasher.HashLeaf(leaves[i]))
+	}
+
+	next := 0
+	for level := 0; level < bits.Len64(size-1); level++ {
+		parentPositions := make([]uint64, 0, len(positions))
+		parents := make([][]byte, 0, len(nodes))
+
+		for i := 0; i < len(positions); i++ {
+			position, node := positions[i], nodes[i]
+			sibling := position ^ 1
+
+			var siblingHash []byte
+			switch {
+			case position&1 == 0 && i+1 < len(positions) && positions[i+1] == sibling:
+				i++
+				siblingHash = nodes[i]
+			case sibling<<level >= size:
+				siblingHash = v.hasher.Empty()
+			default:
+				if next >= len(hashes) {
+					return nil, fmt.Errorf("%w: too few hashes", ErrInvalidProof)
+				}
+
+				siblingHash = hashes[next]
+				next++
+			}
+
+			if position&1 == 0 {
+				node = v.hasher.HashChildren(node, siblingHash)
+			} else {
+				node = v.hasher.HashChildren(siblingHash, node)
+			}
+
+			parentPositions = append(parentPositions, position>>1)
+			parents = append(parents, node)
+		}
+
+		positions, nodes = parentPositions, parents
+	}
+
+	if next != len(hashes) {
+		return nil, fmt.Errorf("%w: expect %d hashes, got %d", ErrInvalidProof, next, len(hashes))
+	}
+
+	return nodes[0], nil
+}
+
+// Multi checks that leaves with certain ids are all included in the tree of the trusted digest
+func (v *Verifier) Multi(leaves [][]byte, ids []uint64, size uint64, hashes [][]byte, digest []byte) error {
+	root, err := v.MultiRoot(leaves, ids, size, hashes)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(root, digest) {
+		return ErrDigestMismatch
+	}
+
+	return nil
+}
+
+// MultiProof checks the multi proof returned by upchain server against the trusted digest
+func (v *Verifier) MultiProof(p *pb.MultiProof, digest []byte) error {
+	if p == nil {
+		return fmt.Errorf("%w: nil proof", ErrInvalidProof)
+	}
+
+	if !bytes.Equal(p.Digest, digest) {
+		return ErrDigestMismatch
+	}
+
+	return v.Multi(p.Leaves, p.Ids, p.Size, p.Hashes, digest)
+}
@@ -0,0 +1,107 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+)
+
+// Range checks the range proof by the default verifier
+func Range(leaves [][]byte, start, size uint64, left, right [][]byte, digest []byte) error {
+	return defaultVerifier.Range(leaves, start, size, left, right, digest)
+}
+
+// RangeProof checks the range proof returned by upchain server by the default verifier
+func RangeProof(p *pb.RangeProof, digest []byte) error {
+	return defaultVerifier.RangeProof(p, digest)
+}
+
+// RangeRoot recomputes the root from all leaves in [start, start+len(leaves)) and the siblings on the left and right
+// boundaries of the range, both from bottom to top. Siblings which are empty subtrees are not a part of right, since
+// they are decided by the size.
+func (v *Verifier) RangeRoot(leaves [][]byte, start, size uint64, left, right [][]byte) ([]byte, error) {
+	if len(leaves) == 0 {
+		return nil, fmt.Errorf("%w: empty range", ErrInvalidProof)
+	}
+
+	end := start + uint64(len(leaves))
+	if end <= start || end > size {
+		return nil, fmt.Errorf("%w: range [%d, %d) is out of tree size %d", ErrInvalidProof, start, end, size)
+	}
+
+	nodes := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		nodes = append(nodes, v.hasher.HashLeaf(leaf))
+	}
+
+	nextLeft, nextRight := 0, 0
+	first, last := start, end-1
+	for level := 0; level < bits.Len64(size-1); level++ {
+		if first&1 == 1 {
+			if nextLeft >= len(left) {
+				return nil, fmt.Errorf("%w: too few left siblings", ErrInvalidProof)
+			}
+
+			nodes = append([][]byte{left[nextLeft]}, nodes...)
+			nextLeft++
+		}
+
+		if last&1 == 0 {
+			if (last+1)<<level < size {
+				if nextRight >= len(right) {
+					return nil, fmt.Errorf("%w: too few right siblings", ErrInvalidProof)
+				}
+
+				nodes = append(nodes, right[nextRight])
+				nextRight++
+			} else {
+				nodes = append(nodes, v.hasher.Empty())
+			}
+		}
+
+		parents := make([][]byte, 0, len(nodes)/2)
+		for i := 0; i < len(nodes); i += 2 {
+			parents = append(parents, v.hasher.HashChildren(nodes[i], nodes[i+1]))
+		}
+
+		nodes = parents
+		first, last = first>>1, last>>1
+	}
+
+	if nextLeft != len(left) || nextRight != len(right) {
+		return nil, fmt.Errorf("%w: expect %d left and %d right siblings, got %d and %d", ErrInvalidProof,
+			nextLeft, nextRight, len(left), len(right))
+	}
+
+	return nodes[0], nil
+}
+
+// Range checks that leaves are exactly the leaves in [start, start+len(leaves)) of the tree of the trusted digest
+func (v *Verifier) Range(leaves [][]byte, start, size uint64, left, right [][]byte, digest []byte) error {
+	root, err := v.RangeRoot(leaves, start, size, left, right)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(root, digest) {
+		return ErrDigestMismatch
+	}
+
+	return nil
+}
+
+// RangeProof checks the range proof returned by upchain server against the trusted digest. A range proof streamed
+// in several messages should be merged in order before checking.
+func (v *Verifier) RangeProof(p *pb.RangeProof, digest []byte) error {
+	if p == nil {
+		return fmt.Errorf("%w: nil proof", ErrInvalidProof)
+	}
+
+	if !bytes.Equal(p.Digest, digest) {
+		return ErrDigestMismatch
+	}
+
+	return v.Range(p.Leaves, p.Start, p.Size, p.Left, p.Right, digest)
+}
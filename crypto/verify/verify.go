@@ -0,0 +1,249 @@
+// Package verify checks proofs of merkle accumulator offline, without talking to upchain server.
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+)
+
+var (
+	// ErrInvalidProof indicates that the proof is malformed
+	ErrInvalidProof = fmt.Errorf("invalid proof")
+	// ErrDigestMismatch indicates that the proof does not lead to the trusted digest
+	ErrDigestMismatch = fmt.Errorf("digest mismatch")
+)
+
+// HashProofV2 is the version of hash proofs which tell the position of the leaf, how the tree is hashed and the side of
+// each sibling
+const HashProofV2 = 2
+
+// Verifier checks proofs of merkle trees hashed by certain tree hasher
+type Verifier struct {
+	hasher *crypto.TreeHasher
+}
+
+// New returns a verifier of trees hashed by the tree hasher
+func New(hasher *crypto.TreeHasher) *Verifier {
+	return &Verifier{hasher: hasher}
+}
+
+// defaultVerifier checks proofs of trees in placeholder mode
+var defaultVerifier *Verifier
+
+func init() {
+	hasher, err := crypto.NewTreeHasher(crypto.DefaultHasher(), crypto.PlaceholderMode)
+	if err != nil {
+		panic(err)
+	}
+
+	defaultVerifier = New(hasher)
+}
+
+// Root recomputes the root by the default verifier
+func Root(leaf []byte, id, size uint64, siblings [][]byte) ([]byte, error) {
+	return defaultVerifier.Root(leaf, id, size, siblings)
+}
+
+// Proof checks the proof by the default verifier
+func Proof(leaf []byte, id, size uint64, siblings [][]byte, digest []byte) error {
+	return defaultVerifier.Proof(leaf, id, size, siblings, digest)
+}
+
+// Path checks the hash path by the default verifier
+func Path(path [][]byte, id, size uint64, digest []byte) error {
+	return defaultVerifier.Path(path, id, size, digest)
+}
+
+// HashProof checks the hash proof by the default verifier
+func HashProof(p *pb.HashProof, id, size uint64, digest []byte) error {
+	return defaultVerifier.HashProof(p, id, size, digest)
+}
+
+// Sides returns sides of siblings by the default verifier
+func Sides(id, size uint64) ([]pb.Side, error) {
+	return defaultVerifier.Sides(id, size)
+}
+
+// Root recomputes the root from a leaf and its sibling hashes ordered from bottom to top.
+// The size is the number of leaves in the tree at the time of digest. If size is 0, it is
+// treated as unknown and the height of tree is derived from the number of siblings, which is only
+// supported when no subtree is omitted. Otherwise, siblings on the right of the last leaf must be
+// the hashes of empty subtrees, or be omitted.
+func (v *Verifier) Root(leaf []byte, id, size uint64, siblings [][]byte) ([]byte, error) {
+	hash := v.hasher.HashLeaf(leaf)
+	empty := v.hasher.Empty()
+
+	if size == 0 {
+		if empty == nil {
+			return nil, fmt.Errorf("%w: tree size is required in %s mode", ErrInvalidProof, v.hasher.Mode())
+		}
+
+		if len(siblings) < 64 && id>>len(siblings) != 0 {
+			return nil, fmt.Errorf("%w: id %d is out of tree with %d levels", ErrInvalidProof, id, len(siblings))
+		}
+
+		for level, sibling := range siblings {
+			if (id>>level)&1 == 0 {
+				hash = v.hasher.HashChildren(hash, sibling)
+			} else {
+				hash = v.hasher.HashChildren(sibling, hash)
+			}
+		}
+
+		return hash, nil
+	}
+
+	if id >= size {
+		return nil, fmt.Errorf("%w: id %d is out of tree size %d", ErrInvalidProof, id, size)
+	}
+
+	next := 0
+	for level := 0; level < bits.Len64(size-1); level++ {
+		// sibling is the right child, whose leaves may be not appended yet
+		isEmpty := (id>>level)&1 == 0 && (id>>level|1)<<level >= size
+		if isEmpty && empty == nil {
+			continue
+		}
+
+		if next >= len(siblings) {
+			return nil, fmt.Errorf("%w: too few siblings", ErrInvalidProof)
+		}
+
+		sibling := siblings[next]
+		next++
+
+		if isEmpty && !bytes.Equal(sibling, empty) {
+			return nil, fmt.Errorf("%w: sibling on level %d should be empty subtree", ErrInvalidProof, level)
+		}
+
+		if (id>>level)&1 == 0 {
+			hash = v.hasher.HashChildren(hash, sibling)
+		} else {
+			hash = v.hasher.HashChildren(sibling, hash)
+		}
+	}
+
+	if next != len(siblings) {
+		return nil, fmt.Errorf("%w: expect %d siblings, got %d", ErrInvalidProof, next, len(siblings))
+	}
+
+	return hash, nil
+}
+
+// Proof checks that leaf with certain id is included in the tree of the trusted digest
+func (v *Verifier) Proof(leaf []byte, id, size uint64, siblings [][]byte, digest []byte) error {
+	root, err := v.Root(leaf, id, size, siblings)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(root, digest) {
+		return ErrDigestMismatch
+	}
+
+	return nil
+}
+
+// Path checks the hash path returned by MerkleTreeStream.GetProof, which begins with the leaf and ends with the root,
+// against the trusted digest
+func (v *Verifier) Path(path [][]byte, id, size uint64, digest []byte) error {
+	if len(path) == 0 {
+		return fmt.Errorf("%w: empty path", ErrInvalidProof)
+	}
+
+	if !bytes.Equal(path[len(path)-1], digest) {
+		return ErrDigestMismatch
+	}
+
+	if len(path) == 1 {
+		return v.Proof(path[0], id, size, nil, digest)
+	}
+
+	return v.Proof(path[0], id, size, path[1:len(path)-1], digest)
+}
+
+// Sides returns the sides of siblings in the hash path of a leaf with certain id in the tree of size leaves. Empty
+// subtrees on the right of the last leaf are placeholders, or omitted if the tree mode has no placeholder.
+func (v *Verifier) Sides(id, size uint64) ([]pb.Side, error) {
+	if id >= size {
+		return nil, fmt.Errorf("%w: id %d is out of tree size %d", ErrInvalidProof, id, size)
+	}
+
+	empty := v.hasher.Empty()
+	sides := make([]pb.Side, 0, bits.Len64(size-1))
+	for level := 0; level < bits.Len64(size-1); level++ {
+		isEmpty := (id>>level)&1 == 0 && (id>>level|1)<<level >= size
+		switch {
+		case isEmpty && empty == nil:
+		case isEmpty:
+			sides = append(sides, pb.Side_PLACEHOLDER)
+		case (id>>level)&1 == 0:
+			sides = append(sides, pb.Side_RIGHT)
+		default:
+			sides = append(sides, pb.Side_LEFT)
+		}
+	}
+
+	return sides, nil
+}
+
+// HashProof checks the hash proof returned by upchain server against the trusted digest. A proof of version 2 should
+// also be of the leaf of id in the tree hashed like the verifier, and its tree size is used if size is 0.
+func (v *Verifier) HashProof(p *pb.HashProof, id, size uint64, digest []byte) error {
+	if p == nil {
+		return fmt.Errorf("%w: nil proof", ErrInvalidProof)
+	}
+
+	if !bytes.Equal(p.Digest, digest) {
+		return ErrDigestMismatch
+	}
+
+	if p.Version >= HashProofV2 {
+		if err := v.checkPosition(p, id, size); err != nil {
+			return err
+		}
+
+		size = p.TreeSize
+	}
+
+	return v.Proof(p.Hash, id, size, p.Path, digest)
+}
+
+// checkPosition checks that a hash proof of version 2 proves the leaf of id in the tree of size leaves, which is
+// unknown if size is 0, and the tree is hashed like the verifier
+func (v *Verifier) checkPosition(p *pb.HashProof, id, size uint64) error {
+	if p.Id != id {
+		return fmt.Errorf("%w: proof of id %d, expected %d", ErrInvalidProof, p.Id, id)
+	}
+
+	if size != 0 && p.TreeSize != size {
+		return fmt.Errorf("%w: proof of tree size %d, expected %d", ErrInvalidProof, p.TreeSize, size)
+	}
+
+	hasher := v.hasher.Hasher()
+	if p.HashAlgorithm != hasher.Name() || p.TreeMode != v.hasher.Mode().String() {
+		return fmt.Errorf("%w: proof of %s tree in %s mode, expected %s tree in %s mode", ErrInvalidProof,
+			p.HashAlgorithm, p.TreeMode, hasher.Name(), v.hasher.Mode())
+	}
+
+	sides, err := v.Sides(id, p.TreeSize)
+	if err != nil {
+		return err
+	}
+
+	if len(sides) != len(p.Sides) {
+		return fmt.Errorf("%w: expect %d sides, got %d", ErrInvalidProof, len(sides), len(p.Sides))
+	}
+
+	for i, side := range sides {
+		if p.Sides[i] != side {
+			return fmt.Errorf("%w: sibling %d should be %s, got %s", ErrInvalidProof, i, side, p.Sides[i])
+		}
+	}
+
+	return nil
+}
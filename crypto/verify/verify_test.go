@@ -0,0 +1,411 @@
+package verify
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/storage"
+)
+
+func TestPath(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := storage.NewMemDB()
+	merkle, err := storage.NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	hashes := make([][]byte, 129)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+
+		_, err := merkle.Append(hashes[i])
+		r.NoError(err)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+
+		size := uint64(i + 1)
+		for id := uint64(0); id < size; id++ {
+			hashPath, err := merkle.GetProof(id, nil)
+			r.NoError(err)
+
+			r.NoError(Path(hashPath, id, size, digest))
+			r.NoError(Path(hashPath, id, 0, digest))
+
+			fake := make([]byte, 32)
+			rand.Read(fake)
+			err = Path(hashPath, id, size, fake)
+			r.True(errors.Is(err, ErrDigestMismatch))
+
+			if size > 1 {
+				err = Path(hashPath, id^1, size+1, digest)
+				r.Error(err)
+			}
+		}
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestHashProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := storage.NewMemDB()
+	merkle, err := storage.NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	hashes := make([][]byte, 33)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+
+		_, err := merkle.Append(hashes[i])
+		r.NoError(err)
+	}
+
+	digest, err := merkle.Digest()
+	r.NoError(err)
+
+	size := uint64(len(hashes))
+	for id := range hashes {
+		hashPath, err := merkle.GetProof(uint64(id), digest)
+		r.NoError(err)
+
+		p := &pb.HashProof{Hash: hashPath[0], Digest: hashPath[len(hashPath)-1], Path: hashPath[1 : len(hashPath)-1]}
+		r.NoError(HashProof(p, uint64(id), size, digest))
+
+		err = HashProof(p, uint64(id), size+64, digest)
+		r.True(errors.Is(err, ErrInvalidProof))
+
+		err = HashProof(p, uint64(1)<<len(p.Path), 0, digest)
+		r.True(errors.Is(err, ErrInvalidProof))
+
+		tampered := &pb.HashProof{Hash: hashes[(id+1)%len(hashes)], Digest: p.Digest, Path: p.Path}
+		err = HashProof(tampered, uint64(id), size, digest)
+		r.True(errors.Is(err, ErrDigestMismatch))
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestHashProofV2(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	for _, mode := range []crypto.TreeMode{crypto.PlaceholderMode, crypto.RFC6962Mode} {
+		merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB(), storage.WithTreeMode(mode))
+		r.NoError(err)
+
+		hasher, err := crypto.NewTreeHasher(crypto.DefaultHasher(), mode)
+		r.NoError(err)
+		verifier := New(hasher)
+
+		size := uint64(37)
+		for i := uint64(0); i < size; i++ {
+			hash := make([]byte, 32)
+			rand.Read(hash)
+
+			_, err := merkle.Append(hash)
+			r.NoError(err)
+		}
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+
+		for id := uint64(0); id < size; id++ {
+			hashPath, err := merkle.GetProof(id, digest)
+			r.NoError(err)
+
+			sides, err := verifier.Sides(id, size)
+			r.NoError(err)
+			r.Len(sides, len(hashPath)-2)
+
+			p := &pb.HashProof{
+				Hash:          hashPath[0],
+				Digest:        digest,
+				Path:          hashPath[1 : len(hashPath)-1],
+				Version:       HashProofV2,
+				Id:            id,
+				TreeSize:      size,
+				HashAlgorithm: crypto.SHA256,
+				TreeMode:      mode.String(),
+				Sides:         sides,
+			}
+
+			// the tree size in proof is used if it is unknown
+			r.NoError(verifier.HashProof(p, id, size, digest))
+			r.NoError(verifier.HashProof(p, id, 0, digest))
+
+			err = verifier.HashProof(p, id, size+1, digest)
+			r.True(errors.Is(err, ErrInvalidProof))
+			err = verifier.HashProof(p, id^1, size, digest)
+			r.True(errors.Is(err, ErrInvalidProof))
+
+			if len(sides) > 0 {
+				p.Sides = append([]pb.Side{(sides[0] + 1) % 3}, sides[1:]...)
+				err = verifier.HashProof(p, id, size, digest)
+				r.True(errors.Is(err, ErrInvalidProof))
+				p.Sides = sides
+			}
+
+			p.TreeMode = "unknown"
+			err = verifier.HashProof(p, id, size, digest)
+			r.True(errors.Is(err, ErrInvalidProof))
+		}
+
+		r.NoError(merkle.Close())
+	}
+
+	// placeholders are only on the right of the last leaf
+	sides, err := Sides(4, 6)
+	r.NoError(err)
+	r.Equal([]pb.Side{pb.Side_RIGHT, pb.Side_PLACEHOLDER, pb.Side_LEFT}, sides)
+
+	_, err = Sides(6, 6)
+	r.True(errors.Is(err, ErrInvalidProof))
+}
+
+func TestConsistency(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := storage.NewMemDB()
+	merkle, err := storage.NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	digests := make([][]byte, 0, 33)
+	for i := 0; i < 33; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err := merkle.Append(hash)
+		r.NoError(err)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		digests = append(digests, digest)
+	}
+
+	for i := range digests {
+		for j := i; j < len(digests); j++ {
+			proof, err := merkle.GetConsistencyProof(digests[i], digests[j])
+			r.NoError(err)
+
+			p := &pb.ConsistencyProof{
+				OldDigest: proof.OldDigest,
+				NewDigest: proof.NewDigest,
+				OldSize:   proof.OldSize,
+				NewSize:   proof.NewSize,
+				Path:      proof.Path,
+			}
+			r.NoError(ConsistencyProof(p, digests[i], digests[j]))
+
+			err = Consistency(digests[i], digests[j], p.OldSize+1, p.NewSize, p.Path)
+			r.Error(err)
+
+			err = Consistency(digests[j], digests[i], p.OldSize, p.NewSize, p.Path)
+			if i != j {
+				r.True(errors.Is(err, ErrDigestMismatch))
+			}
+
+			tampered := append([][]byte{}, p.Path...)
+			k := rand.Intn(len(tampered))
+			tampered[k] = append([]byte{}, tampered[k]...)
+			tampered[k][0] ^= 1
+			err = Consistency(digests[i], digests[j], p.OldSize, p.NewSize, tampered)
+			r.Error(err)
+		}
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestVerifierRFC6962(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := storage.NewMemDB()
+	merkle, err := storage.NewMerkleTreeStreaming(db, storage.WithTreeMode(crypto.RFC6962Mode))
+	r.NoError(err)
+
+	hasher, err := crypto.NewTreeHasher(crypto.DefaultHasher(), crypto.RFC6962Mode)
+	r.NoError(err)
+	verifier := New(hasher)
+
+	for i := 0; i < 67; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err := merkle.Append(hash)
+		r.NoError(err)
+	}
+
+	digest, err := merkle.Digest()
+	r.NoError(err)
+
+	for id := uint64(0); id < 67; id++ {
+		hashPath, err := merkle.GetProof(id, digest)
+		r.NoError(err)
+		r.NoError(verifier.Path(hashPath, id, 67, digest))
+
+		// size decides which subtrees are omitted
+		err = verifier.Path(hashPath, id, 0, digest)
+		r.True(errors.Is(err, ErrInvalidProof))
+
+		err = verifier.Path(hashPath, id, id, digest)
+		r.True(errors.Is(err, ErrInvalidProof))
+
+		// proofs of placeholder mode are different
+		r.Error(Path(hashPath, id, 67, digest))
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestMultiProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	for _, mode := range []crypto.TreeMode{crypto.PlaceholderMode, crypto.RFC6962Mode} {
+		merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB(), storage.WithTreeMode(mode))
+		r.NoError(err)
+
+		hasher, err := crypto.NewTreeHasher(crypto.DefaultHasher(), mode)
+		r.NoError(err)
+		verifier := New(hasher)
+
+		digests := make([][]byte, 0, 67)
+		for i := 0; i < 67; i++ {
+			hash := make([]byte, 32)
+			rand.Read(hash)
+
+			_, err := merkle.Append(hash)
+			r.NoError(err)
+
+			digest, err := merkle.Digest()
+			r.NoError(err)
+			digests = append(digests, digest)
+		}
+
+		for size := uint64(1); size <= 67; size++ {
+			digest := digests[size-1]
+			for round := 0; round < 8; round++ {
+				ids := make([]uint64, 1+rand.Intn(int(size)))
+				for i := range ids {
+					ids[i] = uint64(rand.Intn(int(size)))
+				}
+
+				proof, err := merkle.GetMultiProof(ids, digest)
+				r.NoError(err)
+				r.Equal(size, proof.Size)
+
+				p := &pb.MultiProof{Digest: proof.Digest, Size: proof.Size, Ids: proof.IDs, Leaves: proof.Leaves, Hashes: proof.Hashes}
+				r.NoError(verifier.MultiProof(p, digest))
+
+				// siblings are shared, so there are never more hashes than in single proofs
+				total := 0
+				for _, id := range proof.IDs {
+					hashPath, err := merkle.GetProof(id, digest)
+					r.NoError(err)
+					total += len(hashPath)
+				}
+				r.LessOrEqual(len(proof.Hashes), total)
+
+				err = verifier.Multi(p.Leaves, p.Ids, p.Ids[len(p.Ids)-1], p.Hashes, digest)
+				r.True(errors.Is(err, ErrInvalidProof))
+
+				if len(p.Hashes) > 0 {
+					err = verifier.Multi(p.Leaves, p.Ids, size, p.Hashes[1:], digest)
+					r.True(errors.Is(err, ErrInvalidProof))
+				}
+
+				tampered := append([][]byte{}, p.Leaves...)
+				k := rand.Intn(len(tampered))
+				tampered[k] = append([]byte{}, tampered[k]...)
+				tampered[k][0] ^= 1
+				err = verifier.Multi(tampered, p.Ids, size, p.Hashes, digest)
+				r.True(errors.Is(err, ErrDigestMismatch))
+
+				if len(p.Ids) > 1 {
+					reversed := []uint64{p.Ids[1], p.Ids[0]}
+					err = verifier.Multi(p.Leaves[:2], reversed, size, p.Hashes, digest)
+					r.True(errors.Is(err, ErrInvalidProof))
+				}
+			}
+		}
+
+		r.NoError(merkle.Close())
+	}
+}
+
+func TestRangeProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	for _, mode := range []crypto.TreeMode{crypto.PlaceholderMode, crypto.RFC6962Mode} {
+		merkle, err := storage.NewMerkleTreeStreaming(storage.NewMemDB(), storage.WithTreeMode(mode))
+		r.NoError(err)
+
+		hasher, err := crypto.NewTreeHasher(crypto.DefaultHasher(), mode)
+		r.NoError(err)
+		verifier := New(hasher)
+
+		digests := make([][]byte, 0, 35)
+		for i := 0; i < 35; i++ {
+			hash := make([]byte, 32)
+			rand.Read(hash)
+
+			_, err := merkle.Append(hash)
+			r.NoError(err)
+
+			digest, err := merkle.Digest()
+			r.NoError(err)
+			digests = append(digests, digest)
+		}
+
+		for size := uint64(1); size <= 35; size++ {
+			digest := digests[size-1]
+			for start := uint64(0); start < size; start++ {
+				for end := start + 1; end <= size; end++ {
+					proof, err := merkle.GetRangeProof(start, end, digest)
+					r.NoError(err)
+					r.Equal(size, proof.Size)
+					r.Len(proof.Leaves, int(end-start))
+
+					p := &pb.RangeProof{Digest: proof.Digest, Size: proof.Size, Start: proof.Start, Leaves: proof.Leaves, Left: proof.Left, Right: proof.Right}
+					r.NoError(verifier.RangeProof(p, digest))
+
+					// leaves can't be dropped from either side
+					if end-start > 1 {
+						err = verifier.Range(p.Leaves[1:], start+1, size, p.Left, p.Right, digest)
+						r.Error(err)
+
+						err = verifier.Range(p.Leaves[:len(p.Leaves)-1], start, size, p.Left, p.Right, digest)
+						r.Error(err)
+					}
+
+					err = verifier.Range(p.Leaves, start+1, size, p.Left, p.Right, digest)
+					r.Error(err)
+
+					tampered := append([][]byte{}, p.Leaves...)
+					k := rand.Intn(len(tampered))
+					tampered[k] = append([]byte{}, tampered[k]...)
+					tampered[k][0] ^= 1
+					err = verifier.Range(tampered, start, size, p.Left, p.Right, digest)
+					r.True(errors.Is(err, ErrDigestMismatch))
+				}
+			}
+		}
+
+		r.NoError(merkle.Close())
+	}
+}
@@ -30,19 +30,109 @@ func New() *zap.SugaredLogger {
 }
 
 type HashProof struct {
-	Hash   string
-	Digest string
-	Path   []string
+	Version       uint32
+	ID            uint64
+	TreeSize      uint64
+	HashAlgorithm string
+	TreeMode      string
+	Hash          string
+	Digest        string
+	Path          []string
+	Sides         []string
 }
 
 func HashProofLog(p *pb.HashProof) HashProof {
 	proof := HashProof{
-		Hash:   hex.EncodeToString(p.Hash),
-		Digest: hex.EncodeToString(p.Digest),
-		Path:   make([]string, 0, len(p.Path)),
+		Version:       p.Version,
+		ID:            p.Id,
+		TreeSize:      p.TreeSize,
+		HashAlgorithm: p.HashAlgorithm,
+		TreeMode:      p.TreeMode,
+		Hash:          hex.EncodeToString(p.Hash),
+		Digest:        hex.EncodeToString(p.Digest),
+		Path:          make([]string, 0, len(p.Path)),
+		Sides:         make([]string, 0, len(p.Sides)),
+	}
+	for _, hash := range p.Path {
+		proof.Path = append(proof.Path, hex.EncodeToString(hash))
+	}
+	for _, side := range p.Sides {
+		proof.Sides = append(proof.Sides, side.String())
+	}
+	return proof
+}
+
+type ConsistencyProof struct {
+	OldDigest string
+	NewDigest string
+	OldSize   uint64
+	NewSize   uint64
+	Path      []string
+}
+
+func ConsistencyProofLog(p *pb.ConsistencyProof) ConsistencyProof {
+	proof := ConsistencyProof{
+		OldDigest: hex.EncodeToString(p.OldDigest),
+		NewDigest: hex.EncodeToString(p.NewDigest),
+		OldSize:   p.OldSize,
+		NewSize:   p.NewSize,
+		Path:      make([]string, 0, len(p.Path)),
 	}
 	for _, hash := range p.Path {
 		proof.Path = append(proof.Path, hex.EncodeToString(hash))
 	}
 	return proof
 }
+
+type MultiProof struct {
+	Digest string
+	Size   uint64
+	IDs    []uint64
+	Leaves []string
+	Hashes []string
+}
+
+func MultiProofLog(p *pb.MultiProof) MultiProof {
+	proof := MultiProof{
+		Digest: hex.EncodeToString(p.Digest),
+		Size:   p.Size,
+		IDs:    p.Ids,
+		Leaves: make([]string, 0, len(p.Leaves)),
+		Hashes: make([]string, 0, len(p.Hashes)),
+	}
+	for _, leaf := range p.Leaves {
+		proof.Leaves = append(proof.Leaves, hex.EncodeToString(leaf))
+	}
+	for _, hash := range p.Hashes {
+		proof.Hashes = append(proof.Hashes, hex.EncodeToString(hash))
+	}
+	return proof
+}
+
+type RangeProof struct {
+	Digest string
+	Size   uint64
+	Start  uint64
+	Count  int
+	Left   []string
+	Right  []string
+}
+
+// RangeProofLog omits leaves, which may be too many to log
+func RangeProofLog(p *pb.RangeProof) RangeProof {
+	proof := RangeProof{
+		Digest: hex.EncodeToString(p.Digest),
+		Size:   p.Size,
+		Start:  p.Start,
+		Count:  len(p.Leaves),
+		Left:   make([]string, 0, len(p.Left)),
+		Right:  make([]string, 0, len(p.Right)),
+	}
+	for _, hash := range p.Left {
+		proof.Left = append(proof.Left, hex.EncodeToString(hash))
+	}
+	for _, hash := range p.Right {
+		proof.Right = append(proof.Right, hex.EncodeToString(hash))
+	}
+	return proof
+}
@@ -3,47 +3,134 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/frankonly/upchain/anchor"
 	"github.com/frankonly/upchain/api"
 	pb "github.com/frankonly/upchain/api/accumulator"
+	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/crypto/sign"
 	"github.com/frankonly/upchain/data"
 	"github.com/frankonly/upchain/log"
 	"github.com/frankonly/upchain/storage"
 )
 
 var (
-	tls      = flag.Bool("tls", false, "Connection uses TLS if true, else plain TCP")
-	certFile = flag.String("cert_file", "", "The TLS cert file")
-	keyFile  = flag.String("key_file", "", "The TLS key file")
-	dbDir    = flag.String("db_dir", "accumulator.db", "The upchain DB directory")
-	port     = flag.Int("port", 10000, "The server port")
+	tls                = flag.Bool("tls", false, "Connection uses TLS if true, else plain TCP")
+	certFile           = flag.String("cert_file", "", "The TLS cert file")
+	keyFile            = flag.String("key_file", "", "The TLS key file")
+	dbDir              = flag.String("db_dir", "accumulator.db", "The upchain DB directory, file://DIR for a flat-file DB, or mem:// for an in-memory DB")
+	treeMode           = flag.String("tree_mode", "", "The tree mode (placeholder or rfc6962) of a new DB, the recorded one is used if empty")
+	hashAlgo           = flag.String("hash", "", "The hash algorithm (sha256, sha512/256, sha3-256 or blake2b-256) of a new DB, the recorded one is used if empty")
+	port               = flag.Int("port", 10000, "The server port")
+	signKey            = flag.String("sign_key", "", "The ed25519 or ECDSA P-256 private key in PEM to sign tree heads, no signing if empty")
+	retiredKeys        = flag.String("retired_keys", "", "Comma-separated files of retired public keys in PEM, which are published to verify old tree heads")
+	checkpointAppends  = flag.Uint64("checkpoint_appends", 0, "Checkpoint the digest every N appended leaves, disabled if 0")
+	checkpointInterval = flag.Duration("checkpoint_interval", 0, "Checkpoint the digest every interval such as 30s, disabled if 0")
+	ledgerURL          = flag.String("anchor", "", "The ledger to anchor digests of every namespace, file://PATH for a file ledger or the JSON-RPC URL of an Ethereum node, disabled if empty")
+	ledgerAccount      = flag.String("anchor_account", "", "The unlocked Ethereum account to send anchoring transactions")
+	anchorInterval     = flag.Duration("anchor_interval", 10*time.Minute, "Anchor the latest digest every interval")
+	duplicates         = flag.String("duplicates", "", "How a hash appended again is handled (allow, reject or existing), the recorded one or allow is used if empty")
+	idempotencyTTL     = flag.Duration("idempotency_ttl", 24*time.Hour, "How long a retried append with the same idempotency key returns the original id")
+	maxDataSize        = flag.Uint64("max_data_size", 1<<30, "The max number of bytes of content hashed by the server in one append")
+	adminTokenFile     = flag.String("admin_token_file", "", "The file of the admin token, which clients present to create and delete namespaces, namespace administration is disabled if empty")
+	namespaceDir       = flag.String("namespace_dir", "", "The directory of namespace DBs, which are of the same kind as the upchain DB, DB_DIR.namespaces if empty")
+)
+
+const (
+	// shutdownTimeout is how long to wait for running requests on SIGINT or SIGTERM before they are canceled
+	shutdownTimeout = 10 * time.Second
+	// memDBDir is the DB directory for an in-memory DB
+	memDBDir = "mem://"
+	// fileDBScheme is the prefix of DB directory for a flat-file DB
+	fileDBScheme = "file://"
 )
 
 func main() {
 	flag.Parse()
 	logger := log.New()
 
-	db, err := storage.NewLevelDB(data.Path(*dbDir))
+	var err error
+
+	var db storage.KvStore
+	var provider storage.DBProvider
+	switch {
+	case *dbDir == memDBDir:
+		// everything is lost after the server stops, which is useful in tests
+		db = storage.NewMemDB()
+		provider = storage.NewMemProvider()
+	case strings.HasPrefix(*dbDir, fileDBScheme):
+		dir := data.Path(strings.TrimPrefix(*dbDir, fileDBScheme))
+		db, err = storage.NewFileDB(dir)
+		if err == nil {
+			provider, err = storage.NewDirProvider(namespacePath(dir), func(path string) (storage.KvStore, error) {
+				return storage.NewFileDB(path)
+			})
+		}
+	default:
+		dir := data.Path(*dbDir)
+		db, err = storage.NewLevelDB(dir)
+		if err == nil {
+			provider, err = storage.NewDirProvider(namespacePath(dir), storage.NewLevelDB)
+		}
+	}
+
 	if err != nil {
 		logger.Fatalf("failed to initialize db: %v", err)
 	}
 
-	merkle, err := storage.NewMerkleTreeStreaming(db)
+	var opts []storage.Option
+	if *treeMode != "" {
+		mode, err := crypto.ParseTreeMode(*treeMode)
+		if err != nil {
+			logger.Fatalf("invalid tree mode: %v", err)
+		}
+		opts = append(opts, storage.WithTreeMode(mode))
+	}
+
+	if *hashAlgo != "" {
+		hasher, err := crypto.NewHasher(*hashAlgo)
+		if err != nil {
+			logger.Fatalf("invalid hash algorithm: %v", err)
+		}
+		opts = append(opts, storage.WithHasher(hasher))
+	}
+
+	if *duplicates != "" {
+		policy, err := storage.ParseDuplicatePolicy(*duplicates)
+		if err != nil {
+			logger.Fatalf("invalid duplicate policy: %v", err)
+		}
+		opts = append(opts, storage.WithDuplicatePolicy(policy))
+	}
+
+	merkle, err := storage.NewMerkleTreeStreaming(db, opts...)
 	if err != nil {
 		logger.Fatalf("failed to initialize merkle accumulator: %v", err)
 	}
 
+	namespaces, err := storage.NewNamespaces(merkle, provider)
+	if err != nil {
+		logger.Fatalf("failed to initialize namespaces: %v", err)
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", *port))
 	if err != nil {
 		logger.Fatalf("failed to listen: %v", err)
 	}
 
-	var opts []grpc.ServerOption
+	var serverOpts []grpc.ServerOption
 	if *tls {
 		if *certFile == "" {
 			*certFile = data.Path("x509/server_cert.pem")
@@ -55,15 +142,106 @@ func main() {
 		if err != nil {
 			logger.Fatalf("Failed to generate credentials %v", err)
 		}
-		opts = []grpc.ServerOption{grpc.Creds(creds)}
+		serverOpts = []grpc.ServerOption{grpc.Creds(creds)}
+	}
+
+	var apiOpts []api.Option
+	if *signKey != "" {
+		signer, err := sign.LoadSigner(*signKey)
+		if err != nil {
+			logger.Fatalf("failed to load signing key: %v", err)
+		}
+
+		var retired []*sign.PublicKey
+		if *retiredKeys != "" {
+			keys, err := sign.LoadKeySet(strings.Split(*retiredKeys, ",")...)
+			if err != nil {
+				logger.Fatalf("failed to load retired keys: %v", err)
+			}
+			retired = keys.Keys()
+		}
+
+		apiOpts = append(apiOpts, api.WithSigner(signer, retired...))
+		logger.Infow("tree heads are signed", "keyID", signer.KeyID())
+	}
+
+	policy := api.CheckpointPolicy{Appends: *checkpointAppends, Interval: *checkpointInterval}
+	if policy.Enabled() {
+		apiOpts = append(apiOpts, api.WithCheckpointPolicy(policy))
+		logger.Infow("digests are checkpointed", "appends", policy.Appends, "interval", policy.Interval)
+	}
+
+	apiOpts = append(apiOpts, api.WithIdempotencyTTL(*idempotencyTTL), api.WithMaxDataSize(*maxDataSize))
+
+	if *adminTokenFile != "" {
+		content, err := ioutil.ReadFile(*adminTokenFile)
+		if err != nil {
+			logger.Fatalf("failed to load admin token: %v", err)
+		}
+
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			logger.Fatalf("empty admin token in %s", *adminTokenFile)
+		}
+		apiOpts = append(apiOpts, api.WithAdminToken(token))
+	}
+
+	if *ledgerURL != "" {
+		anchorer, err := anchor.Open(*ledgerURL, *ledgerAccount)
+		if err != nil {
+			logger.Fatalf("failed to open ledger: %v", err)
+		}
+
+		apiOpts = append(apiOpts, api.WithAnchorer(anchorer, *anchorInterval))
+		logger.Infow("digests are anchored", "ledger", anchorer.Ledger(), "interval", *anchorInterval)
 	}
 
-	grpcServer := grpc.NewServer(opts...)
-	apiServer := api.NewServer(merkle, logger)
+	grpcServer := grpc.NewServer(serverOpts...)
+	apiServer := api.NewServer(namespaces, logger, apiOpts...)
 	pb.RegisterAccumulatorServer(grpcServer, apiServer)
 	reflection.Register(grpcServer)
 
+	go stopOnSignal(grpcServer, logger)
+
 	logger.Infow("upchain starts serving", "port", *port)
-	err = grpcServer.Serve(lis)
-	logger.Errorw("upchain stops", "err", err)
+	if err := grpcServer.Serve(lis); err != nil {
+		logger.Errorw("upchain stops serving", "err", err)
+	}
+
+	// background services are stopped before accumulators are closed, which syncs unsynced batches of DBs
+	apiServer.Stop()
+	if err := namespaces.Close(); err != nil {
+		logger.Errorw("failed to close namespaces", "err", err)
+	}
+	logger.Info("upchain stops")
+}
+
+// stopOnSignal stops grpc server gracefully on SIGINT or SIGTERM, and cancels requests still running after
+// shutdownTimeout, such as watchers
+func stopOnSignal(grpcServer *grpc.Server, logger *zap.SugaredLogger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	logger.Infow("upchain is stopping", "signal", sig.String())
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		grpcServer.Stop()
+	}
+}
+
+// namespacePath returns the directory of namespace DBs next to the upchain DB in dir
+func namespacePath(dir string) string {
+	if *namespaceDir != "" {
+		return data.Path(*namespaceDir)
+	}
+
+	return dir + ".namespaces"
 }
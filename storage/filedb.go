@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+const (
+	fileDBNodeFile  = "nodes"
+	fileDBIndexDir  = "index"
+	fileDBMagic     = "UPNODES1"
+	fileDBHeaderLen = 16
+
+	// fileDBNodeCountKey records the number of committed nodes in side index, which is only committed after the nodes
+	// are fsynced, so that nodes written to the node file but not committed are truncated when the file DB is opened
+	fileDBNodeCountKey = "\x00nodes"
+
+	// tags of node records, a zero tag means a hole in the node file
+	nodeInline   = 1
+	nodeExternal = 2
+)
+
+// FileDB is a KvStore that stores merkle nodes as fixed-size records in an append-only file addressed by postorder
+// index, and other key-values in a small side index of level DB.
+// Nodes whose value is not of the node size are stored in the side index, and marked in the node file.
+type FileDB struct {
+	mutex sync.RWMutex
+
+	file  *os.File
+	index *leveldb.DB
+
+	nodeSize int
+	// nodes is the number of nodes in node file, including nodes of pending batches
+	nodes     uint64
+	syncEvery int
+
+	// pending is the last operation on each key of side index by batches written since the last commit. It is read
+	// before side index, and committed with the node count at once after the node file is fsynced.
+	pending  map[string]batchOp
+	unsynced int
+	// syncs is the number of fsyncs of the node file
+	syncs int
+}
+
+// FileDBOption configures a FileDB when it is opened
+type FileDBOption func(*fileDBOptions)
+
+type fileDBOptions struct {
+	nodeSize  int
+	syncEvery int
+}
+
+// WithNodeSize decides the size of node records in a new file DB, which should be the size of hash. The node size is
+// recorded in the node file once it is created.
+func WithNodeSize(size int) FileDBOption {
+	return func(o *fileDBOptions) {
+		o.nodeSize = size
+	}
+}
+
+// WithSyncEvery decides how many batches are committed in a group by one fsync of the node file and one of the side
+// index. Batches written after the last commit are lost as a whole after a crash, but never break the consistency of
+// the file DB.
+func WithSyncEvery(batches int) FileDBOption {
+	return func(o *fileDBOptions) {
+		o.syncEvery = batches
+	}
+}
+
+// NewFileDB news or opens a file DB from specified directory
+func NewFileDB(dir string, opts ...FileDBOption) (KvStore, error) {
+	o := fileDBOptions{nodeSize: 32, syncEvery: 64}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.nodeSize <= 0 || o.syncEvery <= 0 {
+		return nil, fmt.Errorf("invalid node size %d or sync interval %d", o.nodeSize, o.syncEvery)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	index, err := leveldb.OpenFile(filepath.Join(dir, fileDBIndexDir), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &FileDB{index: index, syncEvery: o.syncEvery, pending: make(map[string]batchOp)}
+	if err := db.openNodeFile(filepath.Join(dir, fileDBNodeFile), o.nodeSize); err != nil {
+		_ = index.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// openNodeFile opens the node file and truncates the torn or uncommitted tail
+func (db *FileDB) openNodeFile(name string, nodeSize int) error {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	db.file = file
+
+	header := make([]byte, fileDBHeaderLen)
+	if _, err := io.ReadFull(file, header); err != nil {
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			_ = file.Close()
+			return err
+		}
+
+		// a new node file, or a node file whose header is torn
+		copy(header, fileDBMagic)
+		binary.BigEndian.PutUint64(header[len(fileDBMagic):], uint64(nodeSize))
+		if _, err := file.WriteAt(header, 0); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if string(header[:len(fileDBMagic)]) != fileDBMagic {
+		_ = file.Close()
+		return fmt.Errorf("%w: invalid node file", ErrIncompatible)
+	}
+	db.nodeSize = int(binary.BigEndian.Uint64(header[len(fileDBMagic):]))
+
+	value, err := db.index.Get([]byte(fileDBNodeCountKey), nil)
+	if err == nil {
+		db.nodes = binary.BigEndian.Uint64(value)
+	} else if !errors.Is(err, leveldb.ErrNotFound) {
+		_ = file.Close()
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	// committed nodes are fsynced before their count, so they are lost only by a disk which does not honor fsync, and
+	// the side index still refers to them. Then the file DB is not opened, and should be recovered explicitly.
+	if available := uint64(info.Size()-fileDBHeaderLen) / db.recordSize(); available < db.nodes {
+		_ = file.Close()
+		return fmt.Errorf("%w: %d nodes committed, but only %d nodes in node file", ErrCorrupted, db.nodes, available)
+	}
+
+	if db.nodes > 0 {
+		tag := make([]byte, 1)
+		if _, err := file.ReadAt(tag, db.offset(db.nodes-1)); err != nil {
+			_ = file.Close()
+			return err
+		}
+
+		if tag[0] != nodeInline && tag[0] != nodeExternal {
+			_ = file.Close()
+			return fmt.Errorf("%w: committed node %d is not written in node file", ErrCorrupted, db.nodes-1)
+		}
+	}
+
+	if err := file.Truncate(db.offset(db.nodes)); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Sync()
+}
+
+// Close commits pending batches and closes file DB
+func (db *FileDB) Close() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	err := db.commit()
+	if closeErr := db.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := db.index.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Get gets value from node file or side index
+func (db *FileDB) Get(key []byte) ([]byte, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	order, ok := nodeOrder(key)
+	if !ok {
+		return db.getIndex(key)
+	}
+
+	if order >= db.nodes {
+		return nil, ErrNotFound
+	}
+
+	record := make([]byte, db.recordSize())
+	if _, err := db.file.ReadAt(record, db.offset(order)); err != nil {
+		return nil, err
+	}
+
+	switch record[0] {
+	case nodeInline:
+		return record[1:], nil
+	case nodeExternal:
+		return db.getIndex(key)
+	default:
+		return nil, fmt.Errorf("%w: invalid record of node %d", ErrCorrupted, order)
+	}
+}
+
+// Put puts a key-value to file DB
+func (db *FileDB) Put(key, value []byte) error {
+	batch := db.NewBatch()
+	batch.Put(key, value)
+	return batch.Write()
+}
+
+// Delete deletes a key-value from file DB, only the last node can be deleted from node file
+func (db *FileDB) Delete(key []byte) error {
+	batch := db.NewBatch()
+	batch.Delete(key)
+	return batch.Write()
+}
+
+// NewBatch returns a new batch of file DB
+func (db *FileDB) NewBatch() Batch {
+	return &fileDBBatch{db: db}
+}
+
+// Sync commits pending batches to disk
+func (db *FileDB) Sync() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.commit()
+}
+
+// commit fsyncs nodes of pending batches, and then commits them to side index with the node count at once.
+// mutex should be used when a function calls commit()
+func (db *FileDB) commit() error {
+	if db.unsynced == 0 {
+		return nil
+	}
+
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+	db.syncs++
+
+	batch := leveldb.Batch{}
+	for key, op := range db.pending {
+		if op.deleted {
+			batch.Delete([]byte(key))
+		} else {
+			batch.Put([]byte(key), op.value)
+		}
+	}
+
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, db.nodes)
+	batch.Put([]byte(fileDBNodeCountKey), count)
+
+	// a failed commit is retried by the next batch or Sync, since pending batches are kept
+	if err := db.index.Write(&batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
+
+	db.pending = make(map[string]batchOp)
+	db.unsynced = 0
+	return nil
+}
+
+// getIndex gets value from pending batches or side index.
+// mutex should be used when a function calls getIndex()
+func (db *FileDB) getIndex(key []byte) ([]byte, error) {
+	if op, ok := db.pending[string(key)]; ok {
+		if op.deleted {
+			return nil, ErrNotFound
+		}
+
+		return append([]byte{}, op.value...), nil
+	}
+
+	value, err := db.index.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	return value, err
+}
+
+func (db *FileDB) recordSize() uint64 {
+	return uint64(1 + db.nodeSize)
+}
+
+func (db *FileDB) offset(order uint64) int64 {
+	return int64(fileDBHeaderLen + order*db.recordSize())
+}
+
+// nodeOrder returns the postorder index if key is a merkle key
+func nodeOrder(key []byte) (uint64, bool) {
+	if len(key) != len(merklePrefix)+8 || string(key[:len(merklePrefix)]) != merklePrefix {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint64(key[len(merklePrefix):]), true
+}
+
+// fileDBBatch is a batch of writes committed to file DB atomically
+type fileDBBatch struct {
+	db  *FileDB
+	ops []batchOp
+}
+
+// Put appends a put operation to the batch
+func (b *fileDBBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key), value: append([]byte{}, value...)})
+}
+
+// Delete appends a delete operation to the batch
+func (b *fileDBBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key), deleted: true})
+}
+
+// Len returns the number of operations in the batch
+func (b *fileDBBatch) Len() int {
+	return len(b.ops)
+}
+
+// Write writes nodes to node file, and keeps them with other key-values pending until they are committed by side index
+// in a group of batches. Nodes are appended in postorder, or overwritten in place. A failed batch leaves nothing
+// pending, but overwritten nodes are not restored.
+func (b *fileDBBatch) Write() error {
+	db := b.db
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	nodes := db.nodes
+	pending := make([]batchOp, 0, len(b.ops))
+
+	// appended records are written to the end of node file at once
+	size := db.recordSize()
+	tail := make([]byte, 0, uint64(len(b.ops))*size)
+
+	for _, op := range b.ops {
+		key := []byte(op.key)
+		order, ok := nodeOrder(key)
+		if !ok {
+			pending = append(pending, op)
+			continue
+		}
+
+		if op.deleted {
+			if order+1 != nodes {
+				return fmt.Errorf("node %d is not the last node, which can't be deleted", order)
+			}
+
+			nodes--
+			if nodes >= db.nodes {
+				tail = tail[:uint64(len(tail))-size]
+			}
+			pending = append(pending, op)
+			continue
+		}
+
+		if order > nodes {
+			return fmt.Errorf("node %d is written before node %d", order, nodes)
+		}
+
+		record := make([]byte, size)
+		if len(op.value) == db.nodeSize {
+			record[0] = nodeInline
+			copy(record[1:], op.value)
+
+			// an overwritten node may be stored in side index
+			if order < nodes {
+				pending = append(pending, batchOp{key: op.key, deleted: true})
+			}
+		} else {
+			record[0] = nodeExternal
+			pending = append(pending, op)
+		}
+
+		switch {
+		case order == nodes:
+			tail = append(tail, record...)
+			nodes++
+		case order >= db.nodes:
+			copy(tail[(order-db.nodes)*size:], record)
+		default:
+			if _, err := db.file.WriteAt(record, db.offset(order)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(tail) > 0 {
+		if _, err := db.file.WriteAt(tail, db.offset(db.nodes)); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range pending {
+		db.pending[op.key] = op
+	}
+	db.nodes = nodes
+	db.unsynced++
+
+	if db.unsynced < db.syncEvery {
+		return nil
+	}
+
+	return db.commit()
+}
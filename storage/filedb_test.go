@@ -0,0 +1,458 @@
+package storage
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testFileDB = "test_file.db"
+
+func TestFileDBRW(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(os.TempDir(), testFileDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewFileDB(path)
+	r.NoError(err)
+
+	key := []byte("test")
+	value := []byte("Hello, FileDB")
+
+	_, err = db.Get(key)
+	r.True(errors.Is(err, ErrNotFound))
+	r.NoError(db.Put(key, value))
+
+	result, err := db.Get(key)
+	r.NoError(err)
+	r.Equal(value, result)
+
+	node := make([]byte, 32)
+	rand.Read(node)
+
+	_, err = db.Get(merkleKey(0))
+	r.True(errors.Is(err, ErrNotFound))
+	r.NoError(db.Put(merkleKey(0), node))
+
+	// nodes of other sizes are stored in side index
+	short := []byte("short leaf")
+	r.NoError(db.Put(merkleKey(1), short))
+
+	result, err = db.Get(merkleKey(0))
+	r.NoError(err)
+	r.Equal(node, result)
+
+	result, err = db.Get(merkleKey(1))
+	r.NoError(err)
+	r.Equal(short, result)
+
+	// nodes are only appended in postorder
+	r.Error(db.Put(merkleKey(3), node))
+	r.Error(db.Delete(merkleKey(0)))
+
+	// overwrite in place
+	r.NoError(db.Put(merkleKey(1), node))
+	result, err = db.Get(merkleKey(1))
+	r.NoError(err)
+	r.Equal(node, result)
+
+	r.NoError(db.Delete(merkleKey(1)))
+	_, err = db.Get(merkleKey(1))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(db.Close())
+
+	db, err = NewFileDB(path)
+	r.NoError(err)
+
+	result, err = db.Get(merkleKey(0))
+	r.NoError(err)
+	r.Equal(node, result)
+
+	_, err = db.Get(merkleKey(1))
+	r.True(errors.Is(err, ErrNotFound))
+
+	result, err = db.Get(key)
+	r.NoError(err)
+	r.Equal(value, result)
+
+	r.NoError(db.Close())
+	r.NoError(os.RemoveAll(path))
+}
+
+func TestFileDBBatch(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(os.TempDir(), testFileDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewFileDB(path, WithSyncEvery(2))
+	r.NoError(err)
+
+	r.NoError(db.Put([]byte("deleted"), []byte("value")))
+
+	nodes := make([][]byte, 3)
+	batch := db.NewBatch()
+	for i := range nodes {
+		nodes[i] = make([]byte, 32)
+		rand.Read(nodes[i])
+		batch.Put(merkleKey(uint64(i)), nodes[i])
+	}
+	batch.Put([]byte("first"), []byte("1"))
+	batch.Delete([]byte("deleted"))
+	r.Equal(5, batch.Len())
+
+	_, err = db.Get(merkleKey(0))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(batch.Write())
+
+	for i, node := range nodes {
+		value, err := db.Get(merkleKey(uint64(i)))
+		r.NoError(err)
+		r.Equal(node, value)
+	}
+
+	value, err := db.Get([]byte("first"))
+	r.NoError(err)
+	r.Equal([]byte("1"), value)
+
+	_, err = db.Get([]byte("deleted"))
+	r.True(errors.Is(err, ErrNotFound))
+
+	// a failed batch leaves nothing committed
+	batch = db.NewBatch()
+	batch.Put(merkleKey(3), nodes[0])
+	batch.Put([]byte("second"), []byte("2"))
+	batch.Put(merkleKey(5), nodes[0])
+	r.Error(batch.Write())
+
+	_, err = db.Get(merkleKey(3))
+	r.True(errors.Is(err, ErrNotFound))
+
+	_, err = db.Get([]byte("second"))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(db.Close())
+	r.NoError(os.RemoveAll(path))
+}
+
+func TestFileDBTornTail(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(os.TempDir(), testFileDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewFileDB(path)
+	r.NoError(err)
+
+	node := make([]byte, 32)
+	rand.Read(node)
+	r.NoError(db.Put(merkleKey(0), node))
+	r.NoError(db.Close())
+
+	// a torn record and an uncommitted record after the committed nodes
+	file, err := os.OpenFile(filepath.Join(path, fileDBNodeFile), os.O_WRONLY|os.O_APPEND, 0644)
+	r.NoError(err)
+	_, err = file.Write(append([]byte{nodeInline}, node...))
+	r.NoError(err)
+	_, err = file.Write([]byte{nodeInline, 1, 2, 3})
+	r.NoError(err)
+	r.NoError(file.Close())
+
+	db, err = NewFileDB(path)
+	r.NoError(err)
+
+	value, err := db.Get(merkleKey(0))
+	r.NoError(err)
+	r.Equal(node, value)
+
+	_, err = db.Get(merkleKey(1))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(db.Put(merkleKey(1), node))
+	r.NoError(db.Close())
+
+	info, err := os.Stat(filepath.Join(path, fileDBNodeFile))
+	r.NoError(err)
+	r.EqualValues(fileDBHeaderLen+2*33, info.Size())
+
+	// committed nodes which are lost can't be recovered
+	r.NoError(os.Truncate(filepath.Join(path, fileDBNodeFile), fileDBHeaderLen+33+10))
+	_, err = NewFileDB(path)
+	r.True(errors.Is(err, ErrCorrupted))
+
+	r.NoError(os.RemoveAll(path))
+}
+
+func TestFileDBLostTail(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(os.TempDir(), testFileDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewFileDB(path)
+	r.NoError(err)
+
+	nodes := make([][]byte, 6)
+	for i := range nodes {
+		nodes[i] = make([]byte, 32)
+		rand.Read(nodes[i])
+		r.NoError(db.Put(merkleKey(uint64(i)), nodes[i]))
+	}
+	r.NoError(db.Close())
+
+	// committed nodes lost by a disk which does not honor fsync are not dropped silently, since side index refers to
+	// them
+	nodeFile := filepath.Join(path, fileDBNodeFile)
+	r.NoError(os.Truncate(nodeFile, fileDBHeaderLen+4*33+10))
+	_, err = NewFileDB(path)
+	r.True(errors.Is(err, ErrCorrupted))
+
+	// the node file grew, but pages of its tail were never written
+	r.NoError(os.Truncate(nodeFile, fileDBHeaderLen+3*33))
+	r.NoError(os.Truncate(nodeFile, fileDBHeaderLen+6*33))
+	_, err = NewFileDB(path)
+	r.True(errors.Is(err, ErrCorrupted))
+
+	r.NoError(os.RemoveAll(path))
+}
+
+func TestFileDBGroupCommit(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(os.TempDir(), testFileDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewFileDB(path, WithSyncEvery(4))
+	r.NoError(err)
+	fileDB := db.(*FileDB)
+
+	nodes := make([][]byte, 10)
+	for i := range nodes {
+		nodes[i] = make([]byte, 32)
+		rand.Read(nodes[i])
+
+		batch := db.NewBatch()
+		batch.Put(merkleKey(uint64(i)), nodes[i])
+		batch.Put([]byte{'k', byte(i)}, nodes[i])
+		r.NoError(batch.Write())
+	}
+
+	// one fsync for a group of 4 batches, and pending batches are readable
+	r.Equal(2, fileDB.syncs)
+	for i, node := range nodes {
+		value, err := db.Get(merkleKey(uint64(i)))
+		r.NoError(err)
+		r.Equal(node, value)
+
+		value, err = db.Get([]byte{'k', byte(i)})
+		r.NoError(err)
+		r.Equal(node, value)
+	}
+
+	// a crash loses pending batches as a whole
+	r.NoError(fileDB.file.Close())
+	r.NoError(fileDB.index.Close())
+
+	db, err = NewFileDB(path, WithSyncEvery(4))
+	r.NoError(err)
+	fileDB = db.(*FileDB)
+	r.EqualValues(8, fileDB.nodes)
+
+	value, err := db.Get([]byte{'k', 7})
+	r.NoError(err)
+	r.Equal(nodes[7], value)
+
+	_, err = db.Get(merkleKey(8))
+	r.True(errors.Is(err, ErrNotFound))
+	_, err = db.Get([]byte{'k', 8})
+	r.True(errors.Is(err, ErrNotFound))
+
+	// pending batches are committed on close
+	r.NoError(db.Put(merkleKey(8), nodes[8]))
+	r.Zero(fileDB.syncs)
+	r.NoError(db.Close())
+	r.Equal(1, fileDB.syncs)
+
+	db, err = NewFileDB(path)
+	r.NoError(err)
+	value, err = db.Get(merkleKey(8))
+	r.NoError(err)
+	r.Equal(nodes[8], value)
+
+	r.NoError(db.Close())
+	r.NoError(os.RemoveAll(path))
+}
+
+func TestMerkleTreeStreamingFileDB(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	path := filepath.Join(os.TempDir(), testFileDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewFileDB(path)
+	r.NoError(err)
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	hashes := make([][]byte, 129)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+
+		if i%2 == 0 {
+			_, err = merkle.Append(hashes[i])
+		} else {
+			_, err = merkle.AppendBatch(hashes[i : i+1])
+		}
+		r.NoError(err)
+	}
+
+	digest, err := merkle.Digest()
+	r.NoError(err)
+	r.NoError(merkle.Close())
+
+	db, err = NewFileDB(path)
+	r.NoError(err)
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	reopened, err := merkle.Digest()
+	r.NoError(err)
+	r.Equal(digest, reopened)
+
+	for id, hash := range hashes {
+		hashPath, err := merkle.GetProof(uint64(id), digest)
+		r.NoError(err)
+		r.Equal(hash, hashPath[0])
+		r.True(testVerify(hash, hashPath[1:]))
+
+		found, err := merkle.Search(hash)
+		r.NoError(err)
+		r.Equal(uint64(id), found)
+	}
+
+	r.NoError(merkle.Close())
+	r.NoError(os.RemoveAll(path))
+}
+
+func benchmarkAppend(b *testing.B, db KvStore) {
+	merkle, err := NewMerkleTreeStreaming(db)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	hashes := make([][]byte, b.N)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	b.ResetTimer()
+	for _, hash := range hashes {
+		if _, err := merkle.Append(hash); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	if err := merkle.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func benchmarkGetProof(b *testing.B, db KvStore) {
+	merkle, err := NewMerkleTreeStreaming(db)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	hashes := make([][]byte, 4096)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	if _, err := merkle.AppendBatch(hashes); err != nil {
+		b.Fatal(err)
+	}
+
+	digest, err := merkle.Digest()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := merkle.GetProof(uint64(i%len(hashes)), digest); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	if err := merkle.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkLevelDBAppend(b *testing.B) {
+	path := filepath.Join(os.TempDir(), testDB)
+	_ = os.RemoveAll(path)
+	defer os.RemoveAll(path)
+
+	db, err := NewLevelDB(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkAppend(b, db)
+}
+
+func BenchmarkFileDBAppend(b *testing.B) {
+	path := filepath.Join(os.TempDir(), testFileDB)
+	_ = os.RemoveAll(path)
+	defer os.RemoveAll(path)
+
+	db, err := NewFileDB(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkAppend(b, db)
+}
+
+func BenchmarkLevelDBGetProof(b *testing.B) {
+	path := filepath.Join(os.TempDir(), testDB)
+	_ = os.RemoveAll(path)
+	defer os.RemoveAll(path)
+
+	db, err := NewLevelDB(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkGetProof(b, db)
+}
+
+func BenchmarkFileDBGetProof(b *testing.B) {
+	path := filepath.Join(os.TempDir(), testFileDB)
+	_ = os.RemoveAll(path)
+	defer os.RemoveAll(path)
+
+	db, err := NewFileDB(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkGetProof(b, db)
+}
@@ -3,6 +3,8 @@ package storage
 import (
 	"fmt"
 	"math/bits"
+
+	"github.com/frankonly/upchain/crypto"
 )
 
 // ref Libra Position module
@@ -117,6 +119,17 @@ func RootLevelFromLeafIndex(leafIndex uint64) int {
 	return maxLevel + 1 - bits.LeadingZeros64(leafIndex)
 }
 
+// subtreeIndexes returns the indexes of subtrees of crypto.SubtreesOfRange covering leaves in [start, end)
+func subtreeIndexes(start, end uint64) []InorderIndex {
+	subtrees := crypto.SubtreesOfRange(start, end)
+	indexes := make([]InorderIndex, 0, len(subtrees))
+	for _, t := range subtrees {
+		indexes = append(indexes, FromIndexOnLevel(t.Start>>t.Level, t.Level))
+	}
+
+	return indexes
+}
+
 func isolateRightMostZeroBit(x InorderIndex) InorderIndex {
 	return (^x) & (x + 1)
 }
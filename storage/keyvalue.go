@@ -2,6 +2,10 @@ package storage
 
 import (
 	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/frankonly/upchain/crypto"
 )
 
 func merkleKey(order uint64) []byte {
@@ -22,6 +26,22 @@ func sizeKeyValue(size uint64) ([]byte, []byte) {
 	return []byte(sizeConstantKey), sizeValue
 }
 
+func treeModeKey() []byte {
+	return []byte(treeModeConstantKey)
+}
+
+func treeModeKeyValue(mode crypto.TreeMode) ([]byte, []byte) {
+	return treeModeKey(), []byte{byte(mode)}
+}
+
+func hasherKey() []byte {
+	return []byte(hasherConstantKey)
+}
+
+func hasherKeyValue(name string) ([]byte, []byte) {
+	return hasherKey(), []byte(name)
+}
+
 func leafKey(hash []byte) []byte {
 	return append([]byte(leafHashIndexPrefix), hash...)
 }
@@ -33,6 +53,72 @@ func leafKeyValue(hash []byte, order uint64) ([]byte, []byte) {
 	return leafKey(hash), value
 }
 
+func metadataKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+
+	return append([]byte(metadataPrefix), key...)
+}
+
+// metadataKeyValue encodes the committed hash of metadata prefixed with its length in 2 bytes, followed by the value
+func metadataKeyValue(id uint64, metadata *Metadata) ([]byte, []byte) {
+	value := make([]byte, 2, 2+len(metadata.Committed)+len(metadata.Value))
+	binary.BigEndian.PutUint16(value, uint16(len(metadata.Committed)))
+	value = append(value, metadata.Committed...)
+
+	return metadataKey(id), append(value, metadata.Value...)
+}
+
+func parseMetadata(id uint64, value []byte) (*Metadata, error) {
+	if len(value) < 2 || len(value) < 2+int(binary.BigEndian.Uint16(value)) {
+		return nil, fmt.Errorf("%w: invalid metadata of leaf %d", ErrCorrupted, id)
+	}
+
+	length := 2 + int(binary.BigEndian.Uint16(value))
+	metadata := &Metadata{Value: value[length:]}
+	if length > 2 {
+		metadata.Committed = value[2:length]
+	}
+
+	return metadata, nil
+}
+
+func duplicatePolicyKey() []byte {
+	return []byte(duplicatePolicyConstantKey)
+}
+
+func duplicatePolicyKeyValue(policy DuplicatePolicy) ([]byte, []byte) {
+	return duplicatePolicyKey(), []byte{byte(policy)}
+}
+
+func occurrenceCountKey(hash []byte) []byte {
+	return append([]byte(occurrenceCountPrefix), hash...)
+}
+
+func occurrenceCountKeyValue(hash []byte, count uint64) ([]byte, []byte) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, count)
+
+	return occurrenceCountKey(hash), value
+}
+
+// occurrenceKey is the key of the n-th occurrence of a leaf hash, where n is encoded in 8 bytes after the hash
+func occurrenceKey(hash []byte, n uint64) []byte {
+	key := make([]byte, len(occurrencePrefix)+len(hash)+8)
+	copy(key, occurrencePrefix)
+	copy(key[len(occurrencePrefix):], hash)
+	binary.BigEndian.PutUint64(key[len(occurrencePrefix)+len(hash):], n)
+
+	return key
+}
+
+func occurrenceKeyValue(hash []byte, n uint64, order uint64) ([]byte, []byte) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, order)
+
+	return occurrenceKey(hash, n), value
+}
+
 func rootKey(hash []byte) []byte {
 	return append([]byte(rootHashIndexPrefix), hash...)
 }
@@ -43,3 +129,177 @@ func rootKeyValue(hash []byte, order uint64) ([]byte, []byte) {
 
 	return rootKey(hash), value
 }
+
+func checkpointCountKey() []byte {
+	return []byte(checkpointConstantKey)
+}
+
+func checkpointCountKeyValue(count uint64) ([]byte, []byte) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, count)
+
+	return checkpointCountKey(), value
+}
+
+func checkpointKey(index uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, index)
+
+	return append([]byte(checkpointPrefix), key...)
+}
+
+// checkpointKeyValue encodes size, leaves and time of a checkpoint in 8 bytes each, followed by the digest
+func checkpointKeyValue(checkpoint *Checkpoint) ([]byte, []byte) {
+	value := make([]byte, 24, 24+len(checkpoint.Digest))
+	binary.BigEndian.PutUint64(value, checkpoint.Size)
+	binary.BigEndian.PutUint64(value[8:], checkpoint.Leaves)
+	binary.BigEndian.PutUint64(value[16:], uint64(checkpoint.Time.UnixNano()))
+
+	return checkpointKey(checkpoint.Index), append(value, checkpoint.Digest...)
+}
+
+func parseCheckpoint(index uint64, value []byte) (*Checkpoint, error) {
+	if len(value) <= 24 {
+		return nil, fmt.Errorf("%w: invalid checkpoint %d", ErrCorrupted, index)
+	}
+
+	return &Checkpoint{
+		Index:  index,
+		Digest: value[24:],
+		Size:   binary.BigEndian.Uint64(value),
+		Leaves: binary.BigEndian.Uint64(value[8:]),
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(value[16:]))),
+	}, nil
+}
+
+func anchorCountKey() []byte {
+	return []byte(anchorConstantKey)
+}
+
+func anchorCountKeyValue(count uint64) ([]byte, []byte) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, count)
+
+	return anchorCountKey(), value
+}
+
+func anchorKey(index uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, index)
+
+	return append([]byte(anchorPrefix), key...)
+}
+
+// anchorKeyValue encodes leaves, block and time of an anchor in 8 bytes each, followed by digest, ledger and
+// transaction id, where the first two are prefixed with their lengths in 2 bytes
+func anchorKeyValue(anchor *Anchor) ([]byte, []byte) {
+	value := make([]byte, 24, 28+len(anchor.Digest)+len(anchor.Ledger)+len(anchor.TxID))
+	binary.BigEndian.PutUint64(value, anchor.Leaves)
+	binary.BigEndian.PutUint64(value[8:], anchor.Block)
+	binary.BigEndian.PutUint64(value[16:], uint64(anchor.Time.UnixNano()))
+
+	for _, field := range [][]byte{anchor.Digest, []byte(anchor.Ledger)} {
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(field)))
+		value = append(append(value, length...), field...)
+	}
+
+	return anchorKey(anchor.Index), append(value, anchor.TxID...)
+}
+
+func parseAnchor(index uint64, value []byte) (*Anchor, error) {
+	if len(value) < 24 {
+		return nil, fmt.Errorf("%w: invalid anchor %d", ErrCorrupted, index)
+	}
+
+	anchor := &Anchor{
+		Index:  index,
+		Leaves: binary.BigEndian.Uint64(value),
+		Block:  binary.BigEndian.Uint64(value[8:]),
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(value[16:]))),
+	}
+
+	rest := value[24:]
+	fields := make([][]byte, 2)
+	for i := range fields {
+		if len(rest) < 2 || len(rest) < 2+int(binary.BigEndian.Uint16(rest)) {
+			return nil, fmt.Errorf("%w: invalid anchor %d", ErrCorrupted, index)
+		}
+
+		length := 2 + int(binary.BigEndian.Uint16(rest))
+		fields[i], rest = rest[2:length], rest[length:]
+	}
+
+	anchor.Digest = fields[0]
+	anchor.Ledger = string(fields[1])
+	anchor.TxID = string(rest)
+	return anchor, nil
+}
+
+// idempotencyRecord is the record of an append request by its idempotency key, and index is the position of the key in
+// the idempotency log
+type idempotencyRecord struct {
+	id      uint64
+	expires time.Time
+	index   uint64
+	hash    []byte
+}
+
+func idempotencyCountKey() []byte {
+	return []byte(idempotencyConstantKey)
+}
+
+// idempotencyCountKeyValue encodes the first and the next index of the idempotency log in 8 bytes each
+func idempotencyCountKeyValue(first, next uint64) ([]byte, []byte) {
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value, first)
+	binary.BigEndian.PutUint64(value[8:], next)
+
+	return idempotencyCountKey(), value
+}
+
+func parseIdempotencyCount(value []byte) (uint64, uint64, error) {
+	if len(value) != 16 {
+		return 0, 0, fmt.Errorf("%w: invalid idempotency count", ErrCorrupted)
+	}
+
+	return binary.BigEndian.Uint64(value), binary.BigEndian.Uint64(value[8:]), nil
+}
+
+func idempotencyKey(key []byte) []byte {
+	return append([]byte(idempotencyPrefix), key...)
+}
+
+// idempotencyKeyValue encodes id, expiry time and log index of a record in 8 bytes each, followed by the hash
+func idempotencyKeyValue(key []byte, record *idempotencyRecord) ([]byte, []byte) {
+	value := make([]byte, 24, 24+len(record.hash))
+	binary.BigEndian.PutUint64(value, record.id)
+	binary.BigEndian.PutUint64(value[8:], uint64(record.expires.UnixNano()))
+	binary.BigEndian.PutUint64(value[16:], record.index)
+
+	return idempotencyKey(key), append(value, record.hash...)
+}
+
+func parseIdempotencyRecord(key []byte, value []byte) (*idempotencyRecord, error) {
+	if len(value) <= 24 {
+		return nil, fmt.Errorf("%w: invalid record of idempotency key %q", ErrCorrupted, key)
+	}
+
+	return &idempotencyRecord{
+		id:      binary.BigEndian.Uint64(value),
+		expires: time.Unix(0, int64(binary.BigEndian.Uint64(value[8:]))),
+		index:   binary.BigEndian.Uint64(value[16:]),
+		hash:    value[24:],
+	}, nil
+}
+
+func idempotencyLogKey(index uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, index)
+
+	return append([]byte(idempotencyLogPrefix), key...)
+}
+
+func idempotencyLogKeyValue(index uint64, key []byte) ([]byte, []byte) {
+	return idempotencyLogKey(index), key
+}
@@ -54,3 +54,34 @@ func (h *LevelDBHelper) Delete(key []byte) error {
 
 	return nil
 }
+
+// NewBatch returns a new batch of level DB
+func (h *LevelDBHelper) NewBatch() Batch {
+	return &levelDBBatch{db: h.db}
+}
+
+// levelDBBatch is a batch of writes committed to level DB atomically
+type levelDBBatch struct {
+	db    *leveldb.DB
+	batch leveldb.Batch
+}
+
+// Put appends a put operation to the batch
+func (b *levelDBBatch) Put(key, value []byte) {
+	b.batch.Put(key, value)
+}
+
+// Delete appends a delete operation to the batch
+func (b *levelDBBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+// Len returns the number of operations in the batch
+func (b *levelDBBatch) Len() int {
+	return b.batch.Len()
+}
+
+// Write commits all operations in the batch atomically
+func (b *levelDBBatch) Write() error {
+	return b.db.Write(&b.batch, nil)
+}
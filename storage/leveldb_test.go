@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/binary"
+	"errors"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -88,3 +89,41 @@ func TestLevelDBLoad(t *testing.T) {
 	r.NoError(db.Close())
 	r.NoError(os.RemoveAll(path))
 }
+
+func TestLevelDBBatch(t *testing.T) {
+	r := require.New(t)
+
+	path := filepath.Join(os.TempDir(), testDB)
+	r.NoError(os.RemoveAll(path))
+
+	db, err := NewLevelDB(path)
+	r.NoError(err)
+	r.NotNil(db)
+
+	r.NoError(db.Put([]byte("deleted"), []byte("value")))
+
+	batch := db.NewBatch()
+	batch.Put([]byte("first"), []byte("1"))
+	batch.Put([]byte("second"), []byte("2"))
+	batch.Delete([]byte("deleted"))
+	r.Equal(3, batch.Len())
+
+	_, err = db.Get([]byte("first"))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(batch.Write())
+
+	value, err := db.Get([]byte("first"))
+	r.NoError(err)
+	r.Equal([]byte("1"), value)
+
+	value, err = db.Get([]byte("second"))
+	r.NoError(err)
+	r.Equal([]byte("2"), value)
+
+	_, err = db.Get([]byte("deleted"))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(db.Close())
+	r.NoError(os.RemoveAll(path))
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"sync"
+)
+
+// MemDB is a concurrency-safe KvStore in memory, which is lost after the process exits
+type MemDB struct {
+	mutex  sync.RWMutex
+	data   map[string][]byte
+	closed bool
+}
+
+// NewMemDB returns an empty in-memory DB
+func NewMemDB() KvStore {
+	return &MemDB{data: make(map[string][]byte)}
+}
+
+// Close closes in-memory DB and releases all key-values
+func (m *MemDB) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.closed = true
+	m.data = nil
+	return nil
+}
+
+// Get gets value from in-memory DB
+func (m *MemDB) Get(key []byte) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+// Put puts a key-value to in-memory DB
+func (m *MemDB) Put(key, value []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete deletes a key-value from in-memory DB
+func (m *MemDB) Delete(key []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	delete(m.data, string(key))
+	return nil
+}
+
+// NewBatch returns a new batch of in-memory DB
+func (m *MemDB) NewBatch() Batch {
+	return &memDBBatch{db: m}
+}
+
+// Snapshot returns an independent copy of all key-values in in-memory DB at this moment
+func (m *MemDB) Snapshot() (*MemDB, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	data := make(map[string][]byte, len(m.data))
+	for key, value := range m.data {
+		data[key] = value
+	}
+
+	// values are never modified in place, so they can be shared
+	return &MemDB{data: data}, nil
+}
+
+// Len returns the number of key-values in in-memory DB
+func (m *MemDB) Len() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.data)
+}
+
+// memDBBatch is a batch of writes committed to in-memory DB atomically
+type memDBBatch struct {
+	db  *MemDB
+	ops []batchOp
+}
+
+// batchOp is a put operation in a batch, or a delete operation if deleted is true
+type batchOp struct {
+	key     string
+	value   []byte
+	deleted bool
+}
+
+// Put appends a put operation to the batch
+func (b *memDBBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key), value: append([]byte{}, value...)})
+}
+
+// Delete appends a delete operation to the batch
+func (b *memDBBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key), deleted: true})
+}
+
+// Len returns the number of operations in the batch
+func (b *memDBBatch) Len() int {
+	return len(b.ops)
+}
+
+// Write commits all operations in the batch atomically
+func (b *memDBBatch) Write() error {
+	b.db.mutex.Lock()
+	defer b.db.mutex.Unlock()
+
+	if b.db.closed {
+		return ErrClosed
+	}
+
+	for _, op := range b.ops {
+		if op.deleted {
+			delete(b.db.data, op.key)
+		} else {
+			b.db.data[op.key] = op.value
+		}
+	}
+
+	return nil
+}
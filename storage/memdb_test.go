@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemDBRW(t *testing.T) {
+	r := require.New(t)
+
+	db := NewMemDB()
+
+	key := []byte("test")
+	value := []byte("Hello, MemDB")
+
+	_, err := db.Get(key)
+	r.True(errors.Is(err, ErrNotFound))
+	r.NoError(db.Put(key, value))
+
+	result, err := db.Get(key)
+	r.NoError(err)
+	r.Equal(value, result)
+
+	// values are copied in and out
+	value[0] = 'h'
+	result[1] = 'E'
+	result, err = db.Get(key)
+	r.NoError(err)
+	r.Equal([]byte("Hello, MemDB"), result)
+
+	r.NoError(db.Delete(key))
+	_, err = db.Get(key)
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(db.Close())
+	_, err = db.Get(key)
+	r.True(errors.Is(err, ErrClosed))
+	r.True(errors.Is(db.Put(key, value), ErrClosed))
+	r.True(errors.Is(db.Close(), ErrClosed))
+}
+
+func TestMemDBBatch(t *testing.T) {
+	r := require.New(t)
+
+	db := NewMemDB()
+	r.NoError(db.Put([]byte("deleted"), []byte("value")))
+
+	batch := db.NewBatch()
+	batch.Put([]byte("first"), []byte("1"))
+	batch.Put([]byte("second"), []byte("2"))
+	batch.Delete([]byte("deleted"))
+	r.Equal(3, batch.Len())
+
+	_, err := db.Get([]byte("first"))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(batch.Write())
+
+	value, err := db.Get([]byte("first"))
+	r.NoError(err)
+	r.Equal([]byte("1"), value)
+
+	value, err = db.Get([]byte("second"))
+	r.NoError(err)
+	r.Equal([]byte("2"), value)
+
+	_, err = db.Get([]byte("deleted"))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(db.Close())
+	r.True(errors.Is(batch.Write(), ErrClosed))
+}
+
+func TestMemDBSnapshot(t *testing.T) {
+	r := require.New(t)
+
+	db := NewMemDB()
+	r.NoError(db.Put([]byte("key"), []byte("old")))
+
+	snapshot, err := db.(*MemDB).Snapshot()
+	r.NoError(err)
+
+	r.NoError(db.Put([]byte("key"), []byte("new")))
+	r.NoError(db.Put([]byte("other"), []byte("value")))
+	r.Equal(2, db.(*MemDB).Len())
+
+	value, err := snapshot.Get([]byte("key"))
+	r.NoError(err)
+	r.Equal([]byte("old"), value)
+
+	_, err = snapshot.Get([]byte("other"))
+	r.True(errors.Is(err, ErrNotFound))
+	r.Equal(1, snapshot.Len())
+
+	r.NoError(db.Close())
+
+	value, err = snapshot.Get([]byte("key"))
+	r.NoError(err)
+	r.Equal([]byte("old"), value)
+
+	_, err = db.(*MemDB).Snapshot()
+	r.True(errors.Is(err, ErrClosed))
+	r.NoError(snapshot.Close())
+}
+
+func TestMemDBConcurrently(t *testing.T) {
+	r := require.New(t)
+
+	db := NewMemDB()
+
+	wg := sync.WaitGroup{}
+	wg.Add(16)
+	for i := 0; i < 16; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				key := []byte(fmt.Sprintf("%d-%d", i, j))
+				value := make([]byte, 8)
+				binary.BigEndian.PutUint64(value, rand.Uint64())
+
+				if j%2 == 0 {
+					_ = db.Put(key, value)
+				} else {
+					batch := db.NewBatch()
+					batch.Put(key, value)
+					_ = batch.Write()
+				}
+
+				_, _ = db.Get(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.Equal(16000, db.(*MemDB).Len())
+	r.NoError(db.Close())
+}
+
+func TestMerkleTreeStreamingMemDB(t *testing.T) {
+	r := require.New(t)
+
+	db := NewMemDB()
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	hashes := make([][]byte, 129)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendBatch(hashes)
+	r.NoError(err)
+
+	digest, err := merkle.Digest()
+	r.NoError(err)
+
+	for id, hash := range hashes {
+		hashPath, err := merkle.GetProof(uint64(id), digest)
+		r.NoError(err)
+		r.Equal(hash, hashPath[0])
+		r.True(testVerify(hash, hashPath[1:]))
+
+		found, err := merkle.Search(hash)
+		r.NoError(err)
+		r.Equal(uint64(id), found)
+	}
+
+	// a snapshot can be loaded as another tree and diverges afterwards
+	snapshot, err := db.(*MemDB).Snapshot()
+	r.NoError(err)
+
+	forked, err := NewMerkleTreeStreaming(snapshot)
+	r.NoError(err)
+
+	forkedDigest, err := forked.Digest()
+	r.NoError(err)
+	r.Equal(digest, forkedDigest)
+
+	_, err = forked.Append(hashes[0])
+	r.NoError(err)
+
+	latest, err := merkle.Digest()
+	r.NoError(err)
+	r.Equal(digest, latest)
+
+	r.NoError(forked.Close())
+	r.NoError(merkle.Close())
+}
@@ -5,21 +5,43 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/bits"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/frankonly/upchain/crypto"
 )
 
 const (
-	sizeConstantKey = "s"
+	sizeConstantKey       = "s"
+	treeModeConstantKey   = "t"
+	hasherConstantKey     = "h"
+	checkpointConstantKey = "n"
+	anchorConstantKey     = "b"
+
+	duplicatePolicyConstantKey = "p"
+	idempotencyConstantKey     = "q"
 
 	merklePrefix        = "m"
 	leafHashIndexPrefix = "l"
 	rootHashIndexPrefix = "r"
+	checkpointPrefix    = "c"
+	anchorPrefix        = "a"
+	metadataPrefix      = "d"
+
+	occurrenceCountPrefix = "k"
+	occurrencePrefix      = "o"
+
+	idempotencyPrefix    = "i"
+	idempotencyLogPrefix = "j"
+
+	// idempotencyPurgeLimit is the max number of expired idempotency keys purged by one request
+	idempotencyPurgeLimit = 16
 )
 
 // HashPlaceholder used to form a hash for calculating when there is no descendant fixed
-const HashPlaceholder = "merkle placeholder"
+const HashPlaceholder = crypto.HashPlaceholder
 
 // MerkleTreeStream stores append-only data stream as a binary Merkle tree and supports core operations of MerkleAccumulator
 type MerkleTreeStream struct {
@@ -33,16 +55,77 @@ type MerkleTreeStream struct {
 	next         uint64
 	leftSiblings [maxLevel + 1][]byte
 	isRootValid  bool
+	checkpoints  uint64
+	latest       *Checkpoint
+	anchors      uint64
+	lastAnchor   *Anchor
+	duplicates   DuplicatePolicy
+
+	// idempotency keys are logged in the order of requests, and the log in [idempotencyFirst, idempotencyNext) is
+	// not purged yet
+	idempotencyFirst uint64
+	idempotencyNext  uint64
+
+	// changed is closed and replaced once leaves are appended or checkpoints are recorded, and it is closed without
+	// replacement once the stream is closed
+	changed chan struct{}
+	closed  bool
+
+	// hasher of leaves and nodes
+	hasher *crypto.TreeHasher
+}
+
+// Option configures a MerkleTreeStream when it is created
+type Option func(*options)
+
+type options struct {
+	treeMode    crypto.TreeMode
+	treeModeSet bool
+	hasher      crypto.Hasher
+	hasherSet   bool
+
+	duplicates    DuplicatePolicy
+	duplicatesSet bool
+}
+
+// WithTreeMode decides the tree mode of a new database. The tree mode is recorded in the database once it is created,
+// so opening an existing database with another tree mode fails. Without this option, the recorded one is used.
+func WithTreeMode(mode crypto.TreeMode) Option {
+	return func(o *options) {
+		o.treeMode = mode
+		o.treeModeSet = true
+	}
+}
 
-	// node placeholder
-	placeholderHash []byte
+// WithHasher decides the hash algorithm of a new database. The hash algorithm is recorded in the database once it is
+// created, so opening an existing database with another hash algorithm fails. Without this option, the recorded one
+// is used.
+func WithHasher(hasher crypto.Hasher) Option {
+	return func(o *options) {
+		o.hasher = hasher
+		o.hasherSet = true
+	}
+}
+
+// WithDuplicatePolicy decides how hashes appended again are handled. Unlike tree mode, the policy of a database can be
+// changed by this option, and the new policy is recorded. Without this option, the recorded one is used, which is
+// AllowDuplicates for a database without record.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(o *options) {
+		o.duplicates = policy
+		o.duplicatesSet = true
+	}
 }
 
 // NewMerkleTreeStreaming is only used at beginning of upchain server.
 // The db should be only used by one MerkleTreeStream, so there is no mutex used directly here.
-func NewMerkleTreeStreaming(db KvStore) (MerkleAccumulator, error) {
-	stream := &MerkleTreeStream{db: db}
-	stream.placeholderHash = crypto.Hash([]byte(HashPlaceholder))
+func NewMerkleTreeStreaming(db KvStore, opts ...Option) (MerkleAccumulator, error) {
+	o := options{treeMode: crypto.PlaceholderMode, hasher: crypto.DefaultHasher()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	stream := &MerkleTreeStream{db: db, changed: make(chan struct{})}
 
 	res, err := db.Get(sizeKey())
 	if err != nil {
@@ -54,42 +137,127 @@ func NewMerkleTreeStreaming(db KvStore) (MerkleAccumulator, error) {
 	}
 
 	stream.next = binary.BigEndian.Uint64(res)
+
+	checkpoints, err := db.Get(checkpointCountKey())
+	if err == nil {
+		stream.checkpoints = binary.BigEndian.Uint64(checkpoints)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	if stream.checkpoints > 0 {
+		value, err := db.Get(checkpointKey(stream.checkpoints - 1))
+		if err != nil {
+			return nil, err
+		}
+
+		stream.latest, err = parseCheckpoint(stream.checkpoints-1, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	anchors, err := db.Get(anchorCountKey())
+	if err == nil {
+		stream.anchors = binary.BigEndian.Uint64(anchors)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	if stream.anchors > 0 {
+		value, err := db.Get(anchorKey(stream.anchors - 1))
+		if err != nil {
+			return nil, err
+		}
+
+		stream.lastAnchor, err = parseAnchor(stream.anchors-1, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	idempotency, err := db.Get(idempotencyCountKey())
+	if err == nil {
+		stream.idempotencyFirst, stream.idempotencyNext, err = parseIdempotencyCount(idempotency)
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	// metadata is written when the database is created
+	meta := db.NewBatch()
 	if stream.next == 0 {
-		if err := db.Put(sizeKey(), res); err != nil {
+		meta.Put(sizeKey(), res)
+	}
+
+	mode, err := loadTreeMode(db, stream.next, o)
+	if errors.Is(err, ErrNotFound) {
+		meta.Put(treeModeKeyValue(mode))
+	} else if err != nil {
+		return nil, err
+	}
+
+	hasher, err := loadHasher(db, stream.next, o)
+	if errors.Is(err, ErrNotFound) {
+		meta.Put(hasherKeyValue(hasher.Name()))
+	} else if err != nil {
+		return nil, err
+	}
+
+	stream.duplicates, err = loadDuplicatePolicy(db, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.duplicatesSet {
+		meta.Put(duplicatePolicyKeyValue(o.duplicates))
+	}
+
+	if meta.Len() > 0 {
+		if err := meta.Write(); err != nil {
 			return nil, err
 		}
+	}
+
+	stream.hasher, err = crypto.NewTreeHasher(hasher, mode)
+	if err != nil {
+		return nil, err
+	}
 
+	if stream.next == 0 {
 		stream.isRootValid = false
 	} else {
 		index := FromPostorder(stream.next - 1)
 
-		hash, err := db.Get(merkleKey(index.Postorder()))
+		hash, err := stream.readNode(index)
 		if err != nil {
 			return nil, err
 		}
 
-		// recover lost nodes
+		// recover lost nodes, which only happens to databases written without batch
+		batch := db.NewBatch()
 		for index.IsRightChild() {
-			sibling := index.Sibling()
-			siblingHash, err := db.Get(merkleKey(sibling.Postorder()))
+			siblingHash, err := stream.readNode(index.Sibling())
 			if err != nil {
 				return nil, err
 			}
 
-			hash = crypto.HashNodes(siblingHash, hash)
+			hash = stream.hasher.HashChildren(siblingHash, hash)
 			index = index.Parent()
 
-			if err := db.Put(merkleKey(index.Postorder()), hash); err != nil {
-				return nil, err
-			}
-
+			batch.Put(merkleKey(index.Postorder()), hash)
 			stream.next++
 		}
 		stream.lastHash = hash
 
 		// update size
-		if err := db.Put(sizeKeyValue(stream.next)); err != nil {
-			return nil, err
+		if batch.Len() > 0 {
+			batch.Put(sizeKeyValue(stream.next))
+			if err := batch.Write(); err != nil {
+				return nil, err
+			}
 		}
 
 		// update left siblings
@@ -100,7 +268,7 @@ func NewMerkleTreeStreaming(db KvStore) (MerkleAccumulator, error) {
 			// judge whether the node is frozen
 			if index.Postorder() < stream.next {
 				// frozen node here must be left child
-				hash, err := db.Get(merkleKey(index.Postorder()))
+				hash, err := stream.readNode(index)
 				if err != nil {
 					return nil, err
 				}
@@ -110,7 +278,7 @@ func NewMerkleTreeStreaming(db KvStore) (MerkleAccumulator, error) {
 				if index.IsRightChild() {
 					// left sibling here must be frozen node
 					index = index.Sibling()
-					hash, err := db.Get(merkleKey(index.Postorder()))
+					hash, err := stream.readNode(index)
 					if err != nil {
 						return nil, err
 					}
@@ -132,212 +300,1146 @@ func NewMerkleTreeStreaming(db KvStore) (MerkleAccumulator, error) {
 	return stream, nil
 }
 
-// Get searches id in database layer to find its hash.
-// Get only reads the database.
-func (s *MerkleTreeStream) Get(id uint64) ([]byte, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// loadTreeMode reads the tree mode recorded in database and checks it with options.
+// ErrNotFound is returned with the tree mode to record if there is no record.
+func loadTreeMode(db KvStore, next uint64, o options) (crypto.TreeMode, error) {
+	value, err := db.Get(treeModeKey())
+	if errors.Is(err, ErrNotFound) {
+		if next == 0 {
+			return o.treeMode, err
+		}
 
-	index := FromLeafIndex(id)
-	if index.Postorder() >= s.next {
-		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, id)
+		// databases created before tree mode is recorded only support placeholder mode
+		if o.treeModeSet && o.treeMode != crypto.PlaceholderMode {
+			return 0, fmt.Errorf("%w: tree mode %s of database, not %s", ErrIncompatible, crypto.PlaceholderMode, o.treeMode)
+		}
+
+		return crypto.PlaceholderMode, err
+	} else if err != nil {
+		return 0, err
 	}
-	return s.db.Get(merkleKey(index.Postorder()))
-}
 
-// Append appends new hash to database layer.
-// Append writes the database and states
-func (s *MerkleTreeStream) Append(hash []byte) (uint64, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if len(value) != 1 {
+		return 0, fmt.Errorf("%w: invalid tree mode record", ErrIncompatible)
+	}
 
-	index := FromPostorder(s.next)
-	if !index.IsLeaf() {
-		return 0, fmt.Errorf("current position for writting is not a leaf")
+	mode := crypto.TreeMode(value[0])
+	if o.treeModeSet && o.treeMode != mode {
+		return 0, fmt.Errorf("%w: tree mode %s of database, not %s", ErrIncompatible, mode, o.treeMode)
 	}
 
-	s.isRootValid = false
-	id := index.LeafIndexOnLevel()
+	return mode, nil
+}
 
-	// using oldest proof strategy here
-	_, err := s.db.Get(leafKey(hash))
+// loadHasher reads the hash algorithm recorded in database and checks it with options.
+// ErrNotFound is returned with the hasher to record if there is no record.
+func loadHasher(db KvStore, next uint64, o options) (crypto.Hasher, error) {
+	value, err := db.Get(hasherKey())
 	if errors.Is(err, ErrNotFound) {
-		if err := s.db.Put(leafKeyValue(hash, index.Postorder())); err != nil {
-			return 0, err
+		if next == 0 {
+			return o.hasher, err
 		}
-	} else if err != nil {
-		return 0, err
-	}
 
-	for i := range s.leftSiblings {
-		if err := s.db.Put(merkleKey(index.Postorder()), hash); err != nil {
-			return 0, err
+		// databases created before hash algorithm is recorded only support SHA256
+		legacy := crypto.DefaultHasher()
+		if o.hasherSet && o.hasher.Name() != legacy.Name() {
+			return nil, fmt.Errorf("%w: hash algorithm %s of database, not %s", ErrIncompatible, legacy.Name(), o.hasher.Name())
 		}
-		s.next++
 
-		if index.IsLeftChild() {
-			s.leftSiblings[i] = hash
-			s.lastHash = hash
-			if s.root.Parent() == index || s.root == 0 {
-				s.root = index
-				s.rootHash = hash
-				s.isRootValid = true
-			}
-			break
-		}
+		return legacy, err
+	} else if err != nil {
+		return nil, err
+	}
 
-		index = index.Parent()
-		hash = crypto.HashNodes(s.leftSiblings[i], hash)
+	hasher, err := crypto.NewHasher(string(value))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrIncompatible, err.Error())
 	}
 
-	// update size
-	if err := s.db.Put(sizeKeyValue(s.next)); err != nil {
-		return 0, err
+	if o.hasherSet && o.hasher.Name() != hasher.Name() {
+		return nil, fmt.Errorf("%w: hash algorithm %s of database, not %s", ErrIncompatible, hasher.Name(), o.hasher.Name())
 	}
 
-	return id, nil
+	return hasher, nil
 }
 
-// Search searches hash in database layer to get the id of node. If there are several nodes contains the same hash,
-// Search returns id of the oldest node (oldest strategy).
-// Search reads and may write to database.
-func (s *MerkleTreeStream) Search(hash []byte) (uint64, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// loadDuplicatePolicy returns the policy in options if it is set, or the one recorded in database
+func loadDuplicatePolicy(db KvStore, o options) (DuplicatePolicy, error) {
+	if o.duplicatesSet {
+		if _, ok := duplicatePolicyNames[o.duplicates]; !ok {
+			return 0, fmt.Errorf("unknown duplicate policy %d", o.duplicates)
+		}
 
-	value, err := s.db.Get(leafKey(hash))
-	if err != nil {
+		return o.duplicates, nil
+	}
+
+	value, err := db.Get(duplicatePolicyKey())
+	if errors.Is(err, ErrNotFound) {
+		return AllowDuplicates, nil
+	} else if err != nil {
 		return 0, err
 	}
 
-	order := binary.BigEndian.Uint64(value)
-	index := FromPostorder(order)
-	if !index.IsLeaf() {
-		return 0, fmt.Errorf("not leaf")
+	if len(value) != 1 {
+		return 0, fmt.Errorf("%w: invalid duplicate policy record", ErrIncompatible)
 	}
 
+	return DuplicatePolicy(value[0]), nil
+}
+
+// Get searches id in database layer to find its hash.
+// Get only reads the database.
+func (s *MerkleTreeStream) Get(id uint64) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	index := FromLeafIndex(id)
 	if index.Postorder() >= s.next {
-		return 0, ErrNotFound
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, id)
+	}
+	return s.db.Get(merkleKey(index.Postorder()))
+}
+
+// GetMetadata returns the metadata of a leaf, or ErrNotFound if the leaf is appended without metadata.
+// GetMetadata only reads the database.
+func (s *MerkleTreeStream) GetMetadata(id uint64) (*Metadata, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if FromLeafIndex(id).Postorder() >= s.next {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, id)
 	}
 
-	leafHash, err := s.db.Get(merkleKey(order))
+	value, err := s.db.Get(metadataKey(id))
 	if err != nil {
-		return 0, nil
+		return nil, err
 	}
 
-	if bytes.Compare(hash, leafHash) != 0 {
-		err := s.db.Delete(leafKey(hash))
-		if err != nil {
-			return 0, err
-		}
+	return parseMetadata(id, value)
+}
 
-		return 0, ErrNotFound
-	}
+// Leaves returns the number of appended leaves
+func (s *MerkleTreeStream) Leaves() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	return index.LeafIndexOnLevel(), nil
+	return s.leaves()
 }
 
-// Digest updates the root hash of Merkle tree and returns the root.
-// Digest reads and may write to database and states.
-func (s *MerkleTreeStream) Digest() ([]byte, error) {
+// Append appends new hash to database layer.
+// Append writes the database and states
+func (s *MerkleTreeStream) Append(hash []byte) (uint64, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return s.digest(true)
+	return s.append([][]byte{hash}, nil)
 }
 
-// GetProof constructs a hash path who can proof the existence of data in certain id at the time of certain digest.
-// GetProof reads and may write to database and states.
-func (s *MerkleTreeStream) GetProof(id uint64, digest []byte) ([][]byte, error) {
+// AppendWithMetadata appends new hash with its metadata in one batch, and the hash is expected to commit to metadata
+// if metadata is committed.
+// AppendWithMetadata writes the database and states
+func (s *MerkleTreeStream) AppendWithMetadata(hash []byte, metadata *Metadata) (uint64, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	index := FromLeafIndex(id)
-	if index.Postorder() >= s.next {
-		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, id)
+	return s.append([][]byte{hash}, []*Metadata{metadata})
+}
+
+// AppendWithReceipt appends new hash with its metadata, which may be nil, and proves it to the latest digest at once.
+// No other hash is appended between them, so the digest of receipt is exactly the one after the hash is appended.
+// The hash is only appended if cond holds, and cond may be nil.
+// AppendWithReceipt writes the database and states
+func (s *MerkleTreeStream) AppendWithReceipt(hash []byte, metadata *Metadata, cond *Precondition) (*Receipt, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkPrecondition(cond); err != nil {
+		return nil, err
 	}
 
-	var err error
-	var lastFrozen uint64
-	var rootLevel int
+	id, err := s.append([][]byte{hash}, []*Metadata{metadata})
+	if err != nil {
+		return nil, err
+	}
 
-	rootHash := digest
-	if rootHash == nil {
-		lastFrozen = s.next - 1
+	path, err := s.getProof(id, nil)
+	if err != nil {
+		return nil, err
+	}
 
-		// GetProof will return the latest digest, so the current root should be indexed
-		rootHash, err = s.digest(true)
-		if err != nil {
-			return nil, err
-		}
+	return &Receipt{ID: id, Leaves: s.leaves(), Path: path}, nil
+}
 
-		rootLevel = s.root.Level()
-	} else {
-		value, err := s.db.Get(rootKey(rootHash))
-		if errors.Is(err, ErrNotFound) {
-			return nil, ErrInvalidDigest
-		} else if err != nil {
-			return nil, err
-		}
+// AppendIf appends hashes with their metadata like AppendBatch only if cond holds, and fails with
+// ErrPreconditionFailed otherwise. Metadata may be nil or shorter than hashes for hashes without metadata.
+// AppendIf writes the database and states
+func (s *MerkleTreeStream) AppendIf(hashes [][]byte, metadata []*Metadata, cond *Precondition) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-		lastFrozen = binary.BigEndian.Uint64(value)
-		lastIndex := FromPostorder(lastFrozen)
-		rootLevel = RootLevelFromLeafIndex(lastIndex.RightMostChild().LeafIndexOnLevel())
+	if len(hashes) == 0 {
+		return 0, fmt.Errorf("%w: no hash to append", ErrEmpty)
 	}
 
-	if lastFrozen < index.Postorder() {
-		return nil, ErrNotFound
+	if err := s.checkPrecondition(cond); err != nil {
+		return 0, err
 	}
 
-	hash, err := s.db.Get(merkleKey(index.Postorder()))
-	if err != nil {
-		return nil, err
+	return s.append(hashes, metadata)
+}
+
+// AppendBatch appends hashes to database layer in one batch and returns the id of the first hash.
+// The ids of hashes are contiguous in the order of the batch.
+// AppendBatch writes the database and states
+func (s *MerkleTreeStream) AppendBatch(hashes [][]byte) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(hashes) == 0 {
+		return 0, fmt.Errorf("%w: no hash to append", ErrEmpty)
 	}
 
-	if rootLevel == 0 {
-		if bytes.Equal(rootHash, hash) {
-			return [][]byte{rootHash}, nil
-		}
+	return s.append(hashes, nil)
+}
 
-		return nil, ErrNotFound
+// AppendOnce appends new hash with its metadata, which may be nil, like AppendIf, unless a request with the same key
+// has appended the hash within ttl, in which case the id of the original leaf is returned instead. Using a key for
+// another hash within ttl fails with ErrAlreadyExists. A key is stored with its leaf in one batch, or alone for the
+// existing leaf returned by ReturnExisting, and expired keys are purged gradually by later requests.
+// AppendOnce writes the database and states
+func (s *MerkleTreeStream) AppendOnce(key []byte, ttl time.Duration, hash []byte, metadata *Metadata, cond *Precondition) (uint64, error) {
+	if len(key) == 0 {
+		return 0, fmt.Errorf("%w: no idempotency key", ErrEmpty)
 	}
 
-	hashPath := make([][]byte, 0, rootLevel+2)
-	hashPath = append(hashPath, hash)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	for index.Parent().Level() <= rootLevel {
-		sibling := index.Sibling()
-		siblingHash, err := s.getHash(sibling, lastFrozen)
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate hash path: %s", err.Error())
+	now := time.Now()
+	record, err := s.idempotencyRecord(key)
+	if err == nil && now.Before(record.expires) {
+		if !bytes.Equal(record.hash, hash) {
+			return 0, fmt.Errorf("%w: idempotency key %q is used for another hash", ErrAlreadyExists, key)
 		}
 
-		if len(digest) == 0 {
-			if index.IsLeftChild() {
-				hash = crypto.HashNodes(hash, siblingHash)
-			} else {
-				hash = crypto.HashNodes(siblingHash, hash)
-			}
-		}
+		return record.id, nil
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
 
-		hashPath = append(hashPath, siblingHash)
-		index = index.Parent()
+	if err := s.checkPrecondition(cond); err != nil {
+		return 0, err
 	}
 
-	// check the validity of digest when using old digest
-	if len(digest) == 0 && !bytes.Equal(rootHash, hash) {
-		return nil, ErrInvalidDigest
+	batch := s.db.NewBatch()
+	first, err := s.purgeIdempotency(batch, now)
+	if err != nil {
+		return 0, err
 	}
 
-	hashPath = append(hashPath, rootHash)
-	return hashPath, nil
-}
+	index := s.idempotencyNext
+	record = &idempotencyRecord{
+		id:      FromPostorder(s.next).LeafIndexOnLevel(),
+		expires: now.Add(ttl),
+		index:   index,
+		hash:    hash,
+	}
 
-// Close closes merkle tree streaming and lower components
+	// the existing leaf returned by ReturnExisting is not appended again, but the key is still recorded for it
+	existing := false
+	if s.duplicates == ReturnExisting {
+		id, err := s.existingLeaf(hash, metadata)
+		if err == nil {
+			record.id, existing = id, true
+		} else if !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+	}
+
+	batch.Put(idempotencyKeyValue(key, record))
+	batch.Put(idempotencyLogKeyValue(index, key))
+	batch.Put(idempotencyCountKeyValue(first, index+1))
+
+	id := record.id
+	if existing {
+		err = batch.Write()
+	} else {
+		id, err = s.appendInBatch(batch, [][]byte{hash}, []*Metadata{metadata})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	s.idempotencyFirst, s.idempotencyNext = first, index+1
+	return id, nil
+}
+
+// existingLeaf returns the id of the oldest leaf of hash, which is returned by ReturnExisting instead of appending hash
+// again. It fails with ErrAlreadyExists if metadata is not nil and differs from the one of the leaf, since metadata
+// can't be changed after the leaf is appended.
+// mutex should be used when a function calls existingLeaf()
+func (s *MerkleTreeStream) existingLeaf(hash []byte, metadata *Metadata) (uint64, error) {
+	id, err := s.search(hash)
+	if err != nil || metadata == nil {
+		return id, err
+	}
+
+	value, err := s.db.Get(metadataKey(id))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	if _, expected := metadataKeyValue(id, metadata); !bytes.Equal(value, expected) {
+		return 0, fmt.Errorf("%w: hash %x at id %d with other metadata", ErrAlreadyExists, hash, id)
+	}
+
+	return id, nil
+}
+
+// idempotencyRecord reads the record of an idempotency key, which may be expired.
+// mutex should be used when a function calls idempotencyRecord()
+func (s *MerkleTreeStream) idempotencyRecord(key []byte) (*idempotencyRecord, error) {
+	value, err := s.db.Get(idempotencyKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIdempotencyRecord(key, value)
+}
+
+// purgeIdempotency deletes expired keys from the start of the idempotency log in batch, and returns the new start of
+// the log. A key with a longer ttl holds the keys after it until it expires.
+// mutex should be used when a function calls purgeIdempotency()
+func (s *MerkleTreeStream) purgeIdempotency(batch Batch, now time.Time) (uint64, error) {
+	first := s.idempotencyFirst
+	for ; first < s.idempotencyNext && first-s.idempotencyFirst < idempotencyPurgeLimit; first++ {
+		key, err := s.db.Get(idempotencyLogKey(first))
+		if err != nil {
+			return 0, err
+		}
+
+		// a key used again after it expired has a newer record, which is not deleted with the old log
+		record, err := s.idempotencyRecord(key)
+		if err == nil && record.index == first {
+			if now.Before(record.expires) {
+				break
+			}
+
+			batch.Delete(idempotencyKey(key))
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+
+		batch.Delete(idempotencyLogKey(first))
+	}
+
+	return first, nil
+}
+
+// checkPrecondition checks cond against the current tree, and it holds if cond is nil.
+// mutex should be used when a function calls checkPrecondition()
+func (s *MerkleTreeStream) checkPrecondition(cond *Precondition) error {
+	if cond == nil {
+		return nil
+	}
+
+	leaves := s.leaves()
+	if len(cond.Digest) == 0 {
+		if leaves != cond.Leaves {
+			return fmt.Errorf("%w: tree size %d, expected %d", ErrPreconditionFailed, leaves, cond.Leaves)
+		}
+
+		return nil
+	}
+
+	// the digest is not indexed, because it is only compared here
+	digest, err := s.digest(false)
+	if err != nil && !errors.Is(err, ErrEmpty) {
+		return err
+	}
+
+	if !bytes.Equal(digest, cond.Digest) {
+		return fmt.Errorf("%w: tree size %d, digest %x, expected digest %x", ErrPreconditionFailed, leaves, digest, cond.Digest)
+	}
+
+	return nil
+}
+
+// append calculates all new nodes of hashes in one pass and commits them in one batch with metadata of hashes, where
+// metadata may be nil for hashes without metadata.
+// mutex should be used when a function calls append()
+func (s *MerkleTreeStream) append(hashes [][]byte, metadata []*Metadata) (uint64, error) {
+	return s.appendInBatch(s.db.NewBatch(), hashes, metadata)
+}
+
+// appendInBatch appends hashes like append, and commits them with writes already in batch, which are discarded if
+// nothing is appended.
+// mutex should be used when a function calls appendInBatch()
+func (s *MerkleTreeStream) appendInBatch(batch Batch, hashes [][]byte, metadata []*Metadata) (uint64, error) {
+	index := FromPostorder(s.next)
+	if !index.IsLeaf() {
+		return 0, fmt.Errorf("current position for writting is not a leaf")
+	}
+
+	id := index.LeafIndexOnLevel()
+	if s.duplicates != AllowDuplicates {
+		existing, err := s.checkDuplicates(hashes)
+		if errors.Is(err, ErrAlreadyExists) && s.duplicates == ReturnExisting && len(hashes) == 1 {
+			return existing, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	// occurrences are the numbers of indexed occurrences of hashes including the ones in batch
+	occurrences := make(map[string]uint64, len(hashes))
+
+	// states are only updated after the batch is committed
+	next := s.next
+	leftSiblings := s.leftSiblings
+	lastHash := s.lastHash
+	root, rootHash, isRootValid := s.root, s.rootHash, s.isRootValid
+
+	for i, hash := range hashes {
+		index := FromPostorder(next)
+
+		if i < len(metadata) && metadata[i] != nil {
+			batch.Put(metadataKeyValue(id+uint64(i), metadata[i]))
+		}
+
+		// leaves may be kept in states, so they should not be shared with the caller
+		hash = append([]byte{}, hash...)
+
+		// using oldest proof strategy here, and all occurrences are indexed in order
+		count, ok := occurrences[string(hash)]
+		if !ok {
+			oldest, err := s.db.Get(leafKey(hash))
+			if errors.Is(err, ErrNotFound) {
+				batch.Put(leafKeyValue(hash, index.Postorder()))
+			} else if err != nil {
+				return 0, err
+			}
+
+			count, err = s.occurrenceCount(hash)
+			if err != nil {
+				return 0, err
+			}
+
+			// hashes appended before occurrences are indexed only have their oldest leaves indexed
+			if count == 0 && oldest != nil {
+				batch.Put(occurrenceKeyValue(hash, 0, binary.BigEndian.Uint64(oldest)))
+				count = 1
+			}
+		}
+
+		batch.Put(occurrenceKeyValue(hash, count, index.Postorder()))
+		occurrences[string(hash)] = count + 1
+
+		// leaves are stored as they are, but hashed as nodes of tree
+		value := hash
+		hash = s.hasher.HashLeaf(hash)
+
+		isRootValid = false
+		for level := range leftSiblings {
+			batch.Put(merkleKey(index.Postorder()), value)
+			next++
+
+			if index.IsLeftChild() {
+				leftSiblings[level] = hash
+				lastHash = hash
+				if root.Parent() == index || root == 0 {
+					root = index
+					rootHash = hash
+					isRootValid = true
+				}
+				break
+			}
+
+			index = index.Parent()
+			hash = s.hasher.HashChildren(leftSiblings[level], hash)
+			value = hash
+		}
+	}
+
+	for hash, count := range occurrences {
+		batch.Put(occurrenceCountKeyValue([]byte(hash), count))
+	}
+
+	// update size
+	batch.Put(sizeKeyValue(next))
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+
+	s.next = next
+	s.leftSiblings = leftSiblings
+	s.lastHash = lastHash
+	s.root, s.rootHash, s.isRootValid = root, rootHash, isRootValid
+	s.notify()
+
+	return id, nil
+}
+
+// Search searches hash in database layer to get the id of node. If there are several nodes contains the same hash,
+// Search returns id of the oldest node (oldest strategy).
+// Search reads and may write to database.
+func (s *MerkleTreeStream) Search(hash []byte) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.search(hash)
+}
+
+// SearchAll searches all nodes containing hash, and returns ids of at most limit nodes from offset in the order of
+// appending with the number of all nodes. A negative limit returns all of the rest.
+// SearchAll reads and may write to database.
+func (s *MerkleTreeStream) SearchAll(hash []byte, offset uint64, limit int) ([]uint64, uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count, err := s.occurrenceCount(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if count == 0 {
+		// hashes appended before occurrences are indexed only have their oldest nodes indexed
+		id, err := s.search(hash)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if offset > 1 {
+			return nil, 1, fmt.Errorf("%w: offset %d of 1 node", ErrOutOfRange, offset)
+		}
+
+		if offset == 1 || limit == 0 {
+			return []uint64{}, 1, nil
+		}
+
+		return []uint64{id}, 1, nil
+	}
+
+	if offset > count {
+		return nil, count, fmt.Errorf("%w: offset %d of %d nodes", ErrOutOfRange, offset, count)
+	}
+
+	end := count
+	if limit >= 0 && uint64(limit) < end-offset {
+		end = offset + uint64(limit)
+	}
+
+	ids := make([]uint64, 0, end-offset)
+	for n := offset; n < end; n++ {
+		value, err := s.db.Get(occurrenceKey(hash, n))
+		if err != nil {
+			return nil, count, err
+		}
+
+		ids = append(ids, FromPostorder(binary.BigEndian.Uint64(value)).LeafIndexOnLevel())
+	}
+
+	return ids, count, nil
+}
+
+// search returns id of the oldest node of hash, and deletes the index of hash if it is stale.
+// mutex should be used when a function calls search()
+func (s *MerkleTreeStream) search(hash []byte) (uint64, error) {
+	value, err := s.db.Get(leafKey(hash))
+	if err != nil {
+		return 0, err
+	}
+
+	order := binary.BigEndian.Uint64(value)
+	index := FromPostorder(order)
+	if !index.IsLeaf() {
+		return 0, fmt.Errorf("not leaf")
+	}
+
+	if index.Postorder() >= s.next {
+		return 0, ErrNotFound
+	}
+
+	leafHash, err := s.db.Get(merkleKey(order))
+	if err != nil {
+		return 0, nil
+	}
+
+	if bytes.Compare(hash, leafHash) != 0 {
+		err := s.db.Delete(leafKey(hash))
+		if err != nil {
+			return 0, err
+		}
+
+		return 0, ErrNotFound
+	}
+
+	return index.LeafIndexOnLevel(), nil
+}
+
+// occurrenceCount returns the number of indexed occurrences of hash, which is 0 without any.
+// mutex should be used when a function calls occurrenceCount()
+func (s *MerkleTreeStream) occurrenceCount(hash []byte) (uint64, error) {
+	value, err := s.db.Get(occurrenceCountKey(hash))
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// checkDuplicates returns ErrAlreadyExists with the id of the oldest node of the first hash which is appended or
+// repeated in hashes, where the id is only valid for an appended hash.
+// mutex should be used when a function calls checkDuplicates()
+func (s *MerkleTreeStream) checkDuplicates(hashes [][]byte) (uint64, error) {
+	seen := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		if _, ok := seen[string(hash)]; ok {
+			return 0, fmt.Errorf("%w: hash %x is repeated in batch", ErrAlreadyExists, hash)
+		}
+		seen[string(hash)] = struct{}{}
+
+		id, err := s.search(hash)
+		if err == nil {
+			return id, fmt.Errorf("%w: hash %x at id %d", ErrAlreadyExists, hash, id)
+		} else if !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+	}
+
+	return 0, nil
+}
+
+// Digest updates the root hash of Merkle tree and returns the root.
+// Digest reads and may write to database and states.
+func (s *MerkleTreeStream) Digest() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.digest(true)
+}
+
+// GetProof constructs a hash path who can proof the existence of data in certain id at the time of certain digest.
+// GetProof reads and may write to database and states.
+func (s *MerkleTreeStream) GetProof(id uint64, digest []byte) ([][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.getProof(id, digest)
+}
+
+// getProof constructs the hash path of id to digest, or to the latest digest which is indexed if digest is nil.
+// mutex should be used when a function calls getProof()
+func (s *MerkleTreeStream) getProof(id uint64, digest []byte) ([][]byte, error) {
+	index := FromLeafIndex(id)
+	if index.Postorder() >= s.next {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, id)
+	}
+
+	var err error
+	var lastFrozen uint64
+	var rootLevel int
+
+	rootHash := digest
+	if rootHash == nil {
+		lastFrozen = s.next - 1
+
+		// GetProof will return the latest digest, so the current root should be indexed
+		rootHash, err = s.digest(true)
+		if err != nil {
+			return nil, err
+		}
+
+		rootLevel = s.root.Level()
+	} else {
+		lastFrozen, err = s.lastFrozenOf(rootHash)
+		if err != nil {
+			return nil, err
+		}
+
+		lastIndex := FromPostorder(lastFrozen)
+		rootLevel = RootLevelFromLeafIndex(lastIndex.RightMostChild().LeafIndexOnLevel())
+	}
+
+	if lastFrozen < index.Postorder() {
+		return nil, ErrNotFound
+	}
+
+	hashPath, node, err := s.hashPath(index, lastFrozen, rootLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootLevel == 0 && !bytes.Equal(rootHash, node) {
+		return nil, ErrNotFound
+	}
+
+	// check the validity of digest when using old digest
+	if len(digest) == 0 && !bytes.Equal(rootHash, node) {
+		return nil, ErrInvalidDigest
+	}
+
+	return append(hashPath, rootHash), nil
+}
+
+// GetProofAt constructs a hash path who can proof the existence of data in certain id when the tree had certain size,
+// whose digest is not required to be indexed.
+// GetProofAt reads and may write to database.
+func (s *MerkleTreeStream) GetProofAt(id uint64, size uint64) ([][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if id >= size {
+		return nil, fmt.Errorf("%w: %d is not in tree size %d", ErrOutOfRange, id, size)
+	}
+
+	rootHash, err := s.digestAt(size)
+	if err != nil {
+		return nil, err
+	}
+
+	hashPath, _, err := s.hashPath(FromLeafIndex(id), lastFrozenAt(size), RootLevelFromLeafIndex(size-1))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(hashPath, rootHash), nil
+}
+
+// DigestAt reconstructs the root hash when the tree had certain size, and indexes it for proofs to the digest.
+// DigestAt reads and may write to database.
+func (s *MerkleTreeStream) DigestAt(size uint64) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.digestAt(size)
+}
+
+// TreeSizeOf returns the number of leaves of the tree at the time of an indexed digest.
+// TreeSizeOf only reads from database.
+func (s *MerkleTreeStream) TreeSizeOf(digest []byte) (uint64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	lastFrozen, err := s.lastFrozenOf(digest)
+	if err != nil {
+		return 0, err
+	}
+
+	return leafCount(lastFrozen), nil
+}
+
+// ListDigests returns at most limit checkpoints of indexed digests from certain offset in the order of indexing,
+// and the total number of checkpoints. Digests indexed before checkpoints were recorded are not listed.
+// ListDigests only reads from database.
+func (s *MerkleTreeStream) ListDigests(offset uint64, limit int) ([]*Checkpoint, uint64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if offset > s.checkpoints {
+		return nil, s.checkpoints, fmt.Errorf("%w: offset %d of %d checkpoints", ErrOutOfRange, offset, s.checkpoints)
+	}
+
+	end := s.checkpoints
+	if limit >= 0 && uint64(limit) < end-offset {
+		end = offset + uint64(limit)
+	}
+
+	checkpoints := make([]*Checkpoint, 0, end-offset)
+	for i := offset; i < end; i++ {
+		value, err := s.db.Get(checkpointKey(i))
+		if err != nil {
+			return nil, s.checkpoints, err
+		}
+
+		checkpoint, err := parseCheckpoint(i, value)
+		if err != nil {
+			return nil, s.checkpoints, err
+		}
+
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, s.checkpoints, nil
+}
+
+// LatestCheckpoint returns the last recorded checkpoint, which is kept in states without reading database.
+// ErrEmpty is returned if there is no checkpoint.
+func (s *MerkleTreeStream) LatestCheckpoint() (*Checkpoint, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.latest == nil {
+		return nil, ErrEmpty
+	}
+
+	latest := *s.latest
+	return &latest, nil
+}
+
+// AddAnchor records the anchor of an indexed digest, whose index and number of leaves are set by AddAnchor.
+// Digests should be anchored in the order of tree size, so that the earliest anchor including a leaf can be found.
+// AddAnchor reads and writes to database and states.
+func (s *MerkleTreeStream) AddAnchor(anchor *Anchor) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lastFrozen, err := s.lastFrozenOf(anchor.Digest)
+	if err != nil {
+		return err
+	}
+
+	leaves := leafCount(lastFrozen)
+	if s.lastAnchor != nil && leaves < s.lastAnchor.Leaves {
+		return fmt.Errorf("%w: anchor of %d leaves after %d leaves", ErrInvalidDigest, leaves, s.lastAnchor.Leaves)
+	}
+
+	recorded := *anchor
+	recorded.Index = s.anchors
+	recorded.Leaves = leaves
+	recorded.Time = recorded.Time.Round(0)
+
+	batch := s.db.NewBatch()
+	batch.Put(anchorKeyValue(&recorded))
+	batch.Put(anchorCountKeyValue(s.anchors + 1))
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	anchor.Index, anchor.Leaves = recorded.Index, recorded.Leaves
+	s.anchors++
+	s.lastAnchor = &recorded
+	return nil
+}
+
+// GetAnchor returns the earliest anchor whose digest includes the leaf of certain id, or ErrNotFound if the leaf is
+// not anchored yet.
+// GetAnchor only reads from database.
+func (s *MerkleTreeStream) GetAnchor(id uint64) (*Anchor, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.lastAnchor == nil || s.lastAnchor.Leaves <= id {
+		return nil, fmt.Errorf("%w: no anchor of %d", ErrNotFound, id)
+	}
+
+	// anchors are recorded in the order of tree size
+	var searchErr error
+	index := sort.Search(int(s.anchors), func(i int) bool {
+		anchor, err := s.readAnchor(uint64(i))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return anchor.Leaves > id
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	return s.readAnchor(uint64(index))
+}
+
+// LatestAnchor returns the last recorded anchor, which is kept in states without reading database.
+// ErrEmpty is returned if there is no anchor.
+func (s *MerkleTreeStream) LatestAnchor() (*Anchor, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.lastAnchor == nil {
+		return nil, ErrEmpty
+	}
+
+	latest := *s.lastAnchor
+	return &latest, nil
+}
+
+// GetConsistencyProof constructs hashes which can proof that the tree of old digest is a prefix of the tree of new digest.
+// If new digest is nil, the latest digest is used.
+// GetConsistencyProof reads and may write to database and states.
+func (s *MerkleTreeStream) GetConsistencyProof(oldDigest, newDigest []byte) (*ConsistencyProof, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	oldFrozen, err := s.lastFrozenOf(oldDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	var newFrozen uint64
+	if newDigest == nil {
+		// the latest digest should be indexed as the old one of later proofs
+		newDigest, err = s.digest(true)
+		if err != nil {
+			return nil, err
+		}
+
+		newFrozen = s.next - 1
+	} else {
+		newFrozen, err = s.lastFrozenOf(newDigest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if oldFrozen > newFrozen {
+		return nil, fmt.Errorf("%w: old digest is newer than new digest", ErrInvalidDigest)
+	}
+
+	oldSize := leafCount(oldFrozen)
+	newSize := leafCount(newFrozen)
+
+	// frozen subtrees of old tree are never changed, the rest are reconstructed at the time of new digest
+	frozen := subtreeIndexes(0, oldSize)
+	rest := subtreeIndexes(oldSize, 1<<RootLevelFromLeafIndex(newSize-1))
+
+	path := make([][]byte, 0, len(frozen)+len(rest))
+	for _, index := range frozen {
+		hash, err := s.readNode(index)
+		if err != nil {
+			return nil, err
+		}
+
+		path = append(path, hash)
+	}
+
+	for _, index := range rest {
+		hash, err := s.getHash(index, newFrozen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate consistency proof: %s", err.Error())
+		}
+
+		// omitted subtree is not a part of proof
+		if hash != nil {
+			path = append(path, hash)
+		}
+	}
+
+	return &ConsistencyProof{
+		OldDigest: oldDigest,
+		NewDigest: newDigest,
+		OldSize:   oldSize,
+		NewSize:   newSize,
+		Path:      path,
+	}, nil
+}
+
+// DuplicatePolicy returns how hashes appended again are handled
+func (s *MerkleTreeStream) DuplicatePolicy() DuplicatePolicy {
+	return s.duplicates
+}
+
+// TreeHasher returns the tree hasher recorded in database
+func (s *MerkleTreeStream) TreeHasher() *crypto.TreeHasher {
+	return s.hasher
+}
+
+// GetMultiProof constructs a proof of several leaves at the time of certain digest, which shares the siblings of
+// leaves. If digest is nil, the latest digest is used.
+// GetMultiProof reads and may write to database and states.
+func (s *MerkleTreeStream) GetMultiProof(ids []uint64, digest []byte) (*MultiProof, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no id to prove", ErrEmpty)
+	}
+
+	sorted := append([]uint64{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	unique := sorted[:1]
+	for _, id := range sorted[1:] {
+		if id != unique[len(unique)-1] {
+			unique = append(unique, id)
+		}
+	}
+
+	if last := unique[len(unique)-1]; FromLeafIndex(last).Postorder() >= s.next {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, last)
+	}
+
+	var err error
+	var lastFrozen uint64
+
+	if digest == nil {
+		// GetMultiProof will return the latest digest, so the current root should be indexed
+		digest, err = s.digest(true)
+		if err != nil {
+			return nil, err
+		}
+
+		lastFrozen = s.next - 1
+	} else {
+		lastFrozen, err = s.lastFrozenOf(digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := leafCount(lastFrozen)
+	if unique[len(unique)-1] >= size {
+		return nil, ErrNotFound
+	}
+
+	leaves := make([][]byte, 0, len(unique))
+	for _, id := range unique {
+		leaf, err := s.db.Get(merkleKey(FromLeafIndex(id).Postorder()))
+		if err != nil {
+			return nil, err
+		}
+
+		leaves = append(leaves, leaf)
+	}
+
+	// walk up level by level, a sibling is only needed if it is neither known nor empty
+	hashes := make([][]byte, 0, len(unique))
+	known := append([]uint64{}, unique...)
+	for level := 0; level < RootLevelFromLeafIndex(size-1); level++ {
+		parents := make([]uint64, 0, len(known))
+		for i := 0; i < len(known); i++ {
+			position := known[i]
+			sibling := position ^ 1
+
+			if position&1 == 0 && i+1 < len(known) && known[i+1] == sibling {
+				i++
+			} else if sibling<<level < size {
+				hash, err := s.getHash(FromIndexOnLevel(sibling, level), lastFrozen)
+				if err != nil {
+					return nil, fmt.Errorf("failed to generate multi proof: %s", err.Error())
+				}
+
+				hashes = append(hashes, hash)
+			}
+
+			parents = append(parents, position>>1)
+		}
+
+		known = parents
+	}
+
+	return &MultiProof{
+		Digest: digest,
+		Size:   size,
+		IDs:    unique,
+		Leaves: leaves,
+		Hashes: hashes,
+	}, nil
+}
+
+// GetRangeProof constructs a proof of all leaves in [start, end) at the time of certain digest. If digest is nil,
+// the latest digest is used.
+// GetRangeProof reads and may write to database and states.
+func (s *MerkleTreeStream) GetRangeProof(start, end uint64, digest []byte) (*RangeProof, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if start >= end {
+		return nil, fmt.Errorf("%w: invalid range [%d, %d)", ErrOutOfRange, start, end)
+	}
+
+	if FromLeafIndex(end-1).Postorder() >= s.next {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, end-1)
+	}
+
+	var err error
+	var lastFrozen uint64
+
+	if digest == nil {
+		// GetRangeProof will return the latest digest, so the current root should be indexed
+		digest, err = s.digest(true)
+		if err != nil {
+			return nil, err
+		}
+
+		lastFrozen = s.next - 1
+	} else {
+		lastFrozen, err = s.lastFrozenOf(digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := leafCount(lastFrozen)
+	if end > size {
+		return nil, ErrNotFound
+	}
+
+	leaves := make([][]byte, 0, end-start)
+	for id := start; id < end; id++ {
+		leaf, err := s.db.Get(merkleKey(FromLeafIndex(id).Postorder()))
+		if err != nil {
+			return nil, err
+		}
+
+		leaves = append(leaves, leaf)
+	}
+
+	// walk up with the first and last nodes covering the range, siblings inside the range are known
+	var left, right [][]byte
+	first, last := start, end-1
+	for level := 0; level < RootLevelFromLeafIndex(size-1); level++ {
+		if first&1 == 1 {
+			hash, err := s.readNode(FromIndexOnLevel(first^1, level))
+			if err != nil {
+				return nil, err
+			}
+
+			left = append(left, hash)
+		}
+
+		if last&1 == 0 && (last+1)<<level < size {
+			hash, err := s.getHash(FromIndexOnLevel(last+1, level), lastFrozen)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate range proof: %s", err.Error())
+			}
+
+			right = append(right, hash)
+		}
+
+		first, last = first>>1, last>>1
+	}
+
+	return &RangeProof{
+		Digest: digest,
+		Size:   size,
+		Start:  start,
+		Leaves: leaves,
+		Left:   left,
+		Right:  right,
+	}, nil
+}
+
+// Close closes merkle tree streaming and lower components
 func (s *MerkleTreeStream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.changed)
+	}
+
 	return s.db.Close()
 }
 
+// Changed returns a channel which is closed once leaves are appended or checkpoints are recorded after the call, so
+// that watchers read changes after the call and wait for the channel until next changes. ErrClosed is returned after
+// the stream is closed.
+func (s *MerkleTreeStream) Changed() (<-chan struct{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	return s.changed, nil
+}
+
 // digest updates the root hash, reads and may write to database and states.
 // mutex should be used when a function calls digest()
 func (s *MerkleTreeStream) digest(indexRoot bool) ([]byte, error) {
@@ -351,9 +1453,9 @@ func (s *MerkleTreeStream) digest(indexRoot bool) ([]byte, error) {
 
 		for index.LeftMostChild() != 0 {
 			if index.IsLeftChild() {
-				hash = crypto.HashNodes(hash, s.placeholderHash)
+				hash = s.hasher.HashChildren(hash, s.hasher.Empty())
 			} else {
-				hash = crypto.HashNodes(s.leftSiblings[index.Level()], hash)
+				hash = s.hasher.HashChildren(s.leftSiblings[index.Level()], hash)
 			}
 
 			index = index.Parent()
@@ -365,27 +1467,176 @@ func (s *MerkleTreeStream) digest(indexRoot bool) ([]byte, error) {
 	}
 
 	if indexRoot {
-		_, err := s.db.Get(rootKey(s.rootHash))
-		if errors.Is(err, ErrNotFound) {
-			order := FromPostorder(s.next - 1).Postorder()
-			err = s.db.Put(rootKeyValue(s.rootHash, order))
+		if err := s.indexRoot(s.rootHash, s.next-1); err != nil {
+			return nil, err
+		}
+	}
+	return s.rootHash, nil
+}
+
+// indexRoot indexes the digest of the current head with its last frozen postorder index, and records a checkpoint of
+// it unless it is the latest checkpoint. A digest may be indexed before by digestAt, which records no checkpoint.
+// mutex should be used when a function calls indexRoot()
+func (s *MerkleTreeStream) indexRoot(digest []byte, lastFrozen uint64) error {
+	if s.latest != nil && bytes.Equal(s.latest.Digest, digest) {
+		return nil
+	}
+
+	checkpoint := &Checkpoint{
+		Index:  s.checkpoints,
+		Digest: digest,
+		Size:   lastFrozen + 1,
+		Leaves: leafCount(lastFrozen),
+		Time:   time.Now(),
+	}
+
+	batch := s.db.NewBatch()
+	batch.Put(rootKeyValue(digest, lastFrozen))
+	batch.Put(checkpointKeyValue(checkpoint))
+	batch.Put(checkpointCountKeyValue(s.checkpoints + 1))
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	// the monotonic clock reading is not persisted, so it is not kept in states either
+	checkpoint.Time = checkpoint.Time.Round(0)
+
+	s.checkpoints++
+	s.latest = checkpoint
+	s.notify()
+	return nil
+}
+
+// leaves returns the number of leaves.
+// mutex should be used when a function calls leaves()
+func (s *MerkleTreeStream) leaves() uint64 {
+	if s.next == 0 {
+		return 0
+	}
+
+	return leafCount(s.next - 1)
+}
+
+// notify wakes up all watchers of changes.
+// mutex should be used when a function calls notify()
+func (s *MerkleTreeStream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// digestAt reconstructs and indexes the root hash when the tree had certain size. The digest of a past head is only
+// indexed for proofs to it, and not recorded as a checkpoint, which is recorded for the current head at its time.
+// mutex should be used when a function calls digestAt()
+func (s *MerkleTreeStream) digestAt(size uint64) ([]byte, error) {
+	if size == 0 {
+		return nil, fmt.Errorf("%w: no digest of empty tree", ErrOutOfRange)
+	}
+
+	lastFrozen := lastFrozenAt(size)
+	if lastFrozen >= s.next {
+		return nil, fmt.Errorf("%w: tree size %d", ErrOutOfRange, size)
+	}
+
+	hash, err := s.getHash(FromIndexOnLevel(0, RootLevelFromLeafIndex(size-1)), lastFrozen)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Get(rootKey(hash))
+	if errors.Is(err, ErrNotFound) {
+		err = s.db.Put(rootKeyValue(hash, lastFrozen))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+// hashPath constructs the hash path from a leaf to the root on certain level at the states with certain lastFrozen,
+// and returns the path without root and the recomputed root.
+func (s *MerkleTreeStream) hashPath(index InorderIndex, lastFrozen uint64, rootLevel int) ([][]byte, []byte, error) {
+	hash, err := s.db.Get(merkleKey(index.Postorder()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node := s.hasher.HashLeaf(hash)
+	if rootLevel == 0 {
+		// the root is the leaf itself in placeholder mode
+		if bytes.Equal(hash, node) {
+			return nil, node, nil
 		}
 
+		return [][]byte{hash}, node, nil
+	}
+
+	hashPath := make([][]byte, 0, rootLevel+2)
+	hashPath = append(hashPath, hash)
+
+	for index.Parent().Level() <= rootLevel {
+		sibling := index.Sibling()
+		siblingHash, err := s.getHash(sibling, lastFrozen)
 		if err != nil {
-			return nil, err
+			return nil, nil, fmt.Errorf("failed to generate hash path: %s", err.Error())
+		}
+
+		if index.IsLeftChild() {
+			node = s.hasher.HashChildren(node, siblingHash)
+		} else {
+			node = s.hasher.HashChildren(siblingHash, node)
+		}
+
+		// omitted subtree is not a part of hash path
+		if siblingHash != nil {
+			hashPath = append(hashPath, siblingHash)
 		}
+		index = index.Parent()
 	}
-	return s.rootHash, nil
+
+	return hashPath, node, nil
+}
+
+// readAnchor reads the anchor of certain index
+func (s *MerkleTreeStream) readAnchor(index uint64) (*Anchor, error) {
+	value, err := s.db.Get(anchorKey(index))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAnchor(index, value)
+}
+
+// lastFrozenOf searches the root index and returns the last frozen postorder index at the time of certain digest
+func (s *MerkleTreeStream) lastFrozenOf(digest []byte) (uint64, error) {
+	value, err := s.db.Get(rootKey(digest))
+	if errors.Is(err, ErrNotFound) {
+		return 0, ErrInvalidDigest
+	} else if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// lastFrozenAt returns the last frozen postorder index when the tree has certain number of leaves
+func lastFrozenAt(size uint64) uint64 {
+	return 2*size - uint64(bits.OnesCount64(size)) - 1
+}
+
+// leafCount returns the number of leaves when the last frozen node is certain postorder index
+func leafCount(lastFrozen uint64) uint64 {
+	return FromPostorder(lastFrozen).RightMostChild().LeafIndexOnLevel() + 1
 }
 
 // getHash reconstructs the node at the states with certain lastFrozen and returns the value.
 func (s *MerkleTreeStream) getHash(index InorderIndex, lastFrozen uint64) ([]byte, error) {
 	if index.Postorder() <= lastFrozen {
-		return s.db.Get(merkleKey(index.Postorder()))
+		return s.readNode(index)
 	}
 
 	if index.LeftMostChild().Postorder() > lastFrozen {
-		return s.placeholderHash, nil
+		return s.hasher.Empty(), nil
 	}
 
 	leftChild, err := index.LeftChild()
@@ -408,5 +1659,19 @@ func (s *MerkleTreeStream) getHash(index InorderIndex, lastFrozen uint64) ([]byt
 		return nil, err
 	}
 
-	return crypto.HashNodes(leftHash, rightHash), nil
+	return s.hasher.HashChildren(leftHash, rightHash), nil
+}
+
+// readNode reads the hash of a frozen node, leaves are hashed as nodes of tree
+func (s *MerkleTreeStream) readNode(index InorderIndex) ([]byte, error) {
+	hash, err := s.db.Get(merkleKey(index.Postorder()))
+	if err != nil {
+		return nil, err
+	}
+
+	if index.IsLeaf() {
+		return s.hasher.HashLeaf(hash), nil
+	}
+
+	return hash, nil
 }
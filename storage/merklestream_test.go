@@ -3,10 +3,11 @@ package storage
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"math/rand"
-	"os"
-	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -14,16 +15,23 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/frankonly/upchain/crypto"
+	"github.com/frankonly/upchain/crypto/verify"
 )
 
+// reopenMemDB closes an in-memory DB by closer, and returns a copy of it right before it is closed, which is used as if
+// a DB on disk is reopened
+func reopenMemDB(r *require.Assertions, db KvStore, closer io.Closer) KvStore {
+	snapshot, err := db.(*MemDB).Snapshot()
+	r.NoError(err)
+	r.NoError(closer.Close())
+
+	return snapshot
+}
+
 func TestMerkleTreeStreaming(t *testing.T) {
 	r := require.New(t)
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
-	r.NoError(err)
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -36,18 +44,13 @@ func TestMerkleTreeStreaming(t *testing.T) {
 	r.Error(err)
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
 func TestMerkleTreeStreamingRW(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
-	r.NoError(err)
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -75,18 +78,13 @@ func TestMerkleTreeStreamingRW(t *testing.T) {
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
 func TestMerkleTreeStreaming_Search(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
-	r.NoError(err)
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -122,18 +120,276 @@ func TestMerkleTreeStreaming_Search(t *testing.T) {
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
-func TestMerkleTreeStreamingIndexAutoDelete(t *testing.T) {
+func TestMerkleTreeStreaming_SearchAll(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	other := make([]byte, 32)
+	rand.Read(other)
+
+	_, _, err = merkle.SearchAll(hash, 0, -1)
+	r.True(errors.Is(err, ErrNotFound))
+
+	// the hash is at 0, 2, 3, 5 and 6
+	var expected []uint64
+	for _, batch := range [][][]byte{{hash}, {other}, {hash, hash}, {other}, {hash}, {hash}} {
+		first, err := merkle.AppendBatch(batch)
+		r.NoError(err)
+
+		for i := range batch {
+			if bytes.Equal(batch[i], hash) {
+				expected = append(expected, first+uint64(i))
+			}
+		}
+	}
+
+	ids, total, err := merkle.SearchAll(hash, 0, -1)
+	r.NoError(err)
+	r.EqualValues(5, total)
+	r.Equal(expected, ids)
+
+	ids, total, err = merkle.SearchAll(hash, 1, 2)
+	r.NoError(err)
+	r.EqualValues(5, total)
+	r.Equal(expected[1:3], ids)
+
+	ids, _, err = merkle.SearchAll(hash, 5, 2)
+	r.NoError(err)
+	r.Empty(ids)
+
+	_, _, err = merkle.SearchAll(hash, 6, 2)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	// the oldest one is still searched
+	id, err := merkle.Search(hash)
+	r.NoError(err)
+	r.EqualValues(0, id)
+
+	// hashes appended before occurrences are indexed only have their oldest leaves found
+	r.NoError(db.Delete(occurrenceCountKey(other)))
+	r.NoError(db.Delete(occurrenceKey(other, 0)))
+	r.NoError(db.Delete(occurrenceKey(other, 1)))
+
+	ids, total, err = merkle.SearchAll(other, 0, -1)
+	r.NoError(err)
+	r.EqualValues(1, total)
+	r.Equal([]uint64{1}, ids)
+
+	last, err := merkle.Append(other)
+	r.NoError(err)
+
+	ids, total, err = merkle.SearchAll(other, 0, -1)
+	r.NoError(err)
+	r.EqualValues(2, total)
+	r.Equal([]uint64{1, last}, ids)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingDuplicatePolicy(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+
+	merkle, err := NewMerkleTreeStreaming(db, WithDuplicatePolicy(RejectDuplicates))
+	r.NoError(err)
+	r.Equal(RejectDuplicates, merkle.DuplicatePolicy())
+
+	hashes := make([][]byte, 3)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.Append(hashes[0])
+	r.NoError(err)
+
+	_, err = merkle.Append(hashes[0])
+	r.True(errors.Is(err, ErrAlreadyExists))
+	_, err = merkle.AppendBatch([][]byte{hashes[1], hashes[0]})
+	r.True(errors.Is(err, ErrAlreadyExists))
+	_, err = merkle.AppendBatch([][]byte{hashes[1], hashes[1]})
+	r.True(errors.Is(err, ErrAlreadyExists))
+
+	// nothing of rejected batches is appended
+	_, err = merkle.Search(hashes[1])
+	r.True(errors.Is(err, ErrNotFound))
+	db = reopenMemDB(r, db, merkle)
+
+	// the policy is recorded
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+	r.Equal(RejectDuplicates, merkle.DuplicatePolicy())
+	db = reopenMemDB(r, db, merkle)
+
+	// the policy can be changed
+	merkle, err = NewMerkleTreeStreaming(db, WithDuplicatePolicy(ReturnExisting))
+	r.NoError(err)
+	r.Equal(ReturnExisting, merkle.DuplicatePolicy())
+
+	first, err := merkle.AppendBatch([][]byte{hashes[1], hashes[2]})
+	r.NoError(err)
+	r.EqualValues(1, first)
+
+	id, err := merkle.Append(hashes[2])
+	r.NoError(err)
+	r.EqualValues(2, id)
+
+	_, err = merkle.AppendBatch([][]byte{hashes[0], hashes[1]})
+	r.True(errors.Is(err, ErrAlreadyExists))
+
+	_, total, err := merkle.SearchAll(hashes[2], 0, -1)
+	r.NoError(err)
+	r.EqualValues(1, total)
+	r.NoError(merkle.Close())
+
+	for policy, name := range duplicatePolicyNames {
+		parsed, err := ParseDuplicatePolicy(name)
+		r.NoError(err)
+		r.Equal(policy, parsed)
+		r.Equal(name, policy.String())
+	}
+
+	_, err = ParseDuplicatePolicy("unknown")
+	r.Error(err)
+}
+
+func TestMerkleTreeStreaming_Changed(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+	r.EqualValues(0, merkle.Leaves())
+
+	changed, err := merkle.Changed()
+	r.NoError(err)
+
+	select {
+	case <-changed:
+		r.FailNow("changed without change")
+	default:
+	}
+
+	hashes := make([][]byte, 5)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendBatch(hashes)
+	r.NoError(err)
+	r.EqualValues(len(hashes), merkle.Leaves())
+	<-changed
+
+	// a recorded checkpoint is a change, while a digest indexed before is not
+	changed, err = merkle.Changed()
+	r.NoError(err)
+	_, err = merkle.Digest()
+	r.NoError(err)
+	<-changed
+
+	changed, err = merkle.Changed()
+	r.NoError(err)
+	_, err = merkle.Digest()
+	r.NoError(err)
+	select {
+	case <-changed:
+		r.FailNow("changed without change")
+	default:
+	}
+
+	// watchers are woken up once the stream is closed
+	r.NoError(merkle.Close())
+	<-changed
+
+	_, err = merkle.Changed()
+	r.True(errors.Is(err, ErrClosed))
+}
+
+func TestMerkleTreeStreaming_AppendBatch(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
+	db := NewMemDB()
+	r.NotNil(db)
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+	r.NotNil(merkle)
+
+	_, err = merkle.AppendBatch(nil)
+	r.True(errors.Is(err, ErrEmpty))
+
+	total := 1025
+	hashes := make([][]byte, 0, total)
+	for len(hashes) < total {
+		batch := make([][]byte, 1+rand.Intn(total-len(hashes)))
+		for i := range batch {
+			batch[i] = make([]byte, 32)
+			rand.Read(batch[i])
+		}
+
+		// duplicate hash in the same batch should be searched as the older one
+		if len(batch) > 1 {
+			batch[len(batch)-1] = batch[0]
+		}
+
+		id, err := merkle.AppendBatch(batch)
+		r.NoError(err)
+		r.EqualValues(len(hashes), id)
+
+		hashes = append(hashes, batch...)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		r.Equal(testDigest(hashes), digest)
+
+		id, err = merkle.Append(batch[0])
+		r.NoError(err)
+		r.EqualValues(len(hashes), id)
+
+		hashes = append(hashes, batch[0])
+	}
+
+	for i, hash := range hashes {
+		value, err := merkle.Get(uint64(i))
+		r.NoError(err)
+		r.Equal(hash, value)
+
+		id, err := merkle.Search(hash)
+		r.NoError(err)
+		r.Equal(hashes[id], hash)
+		r.LessOrEqual(id, uint64(i))
+	}
+
+	db = reopenMemDB(r, db, merkle)
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
 
-	db, err := NewLevelDB(path)
+	digest, err := merkle.Digest()
 	r.NoError(err)
+	r.Equal(testDigest(hashes), digest)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingIndexAutoDelete(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -161,11 +417,7 @@ func TestMerkleTreeStreamingIndexAutoDelete(t *testing.T) {
 	}
 
 	for k := 0; k < 32; k++ {
-		r.NoError(db.Close())
-
-		db, err = NewLevelDB(path)
-		r.NoError(err)
-		r.NotNil(db)
+		db = reopenMemDB(r, db, db)
 
 		cut := uint64(rand.Intn(int(lastLeaf)))
 		r.NoError(db.Put(sizeKeyValue(cut)))
@@ -220,18 +472,13 @@ func TestMerkleTreeStreamingIndexAutoDelete(t *testing.T) {
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
 func TestMerkleTreeStreaming_Digest(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
-	r.NoError(err)
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -259,18 +506,13 @@ func TestMerkleTreeStreaming_Digest(t *testing.T) {
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
 func TestMerkleTreeStreaming_GetProof(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
-	r.NoError(err)
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -305,165 +547,883 @@ func TestMerkleTreeStreaming_GetProof(t *testing.T) {
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
-func TestMerkleTreeStreamingGetProofFromOldDigest(t *testing.T) {
+func TestMerkleTreeStreaming_AppendWithReceipt(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
-	r.NoError(err)
-	r.NotNil(db)
-
-	merkle, err := NewMerkleTreeStreaming(db)
+	merkle, err := NewMerkleTreeStreaming(NewMemDB())
 	r.NoError(err)
-	r.NotNil(merkle)
 
-	hashes := make([][]byte, 65)
-	digests := make([][]byte, 0, 65)
+	for i := 0; i < 100; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
 
-	for i := range hashes {
-		hashes[i] = make([]byte, 32)
-		rand.Read(hashes[i])
+		var metadata *Metadata
+		if i%10 == 0 {
+			metadata = &Metadata{Value: []byte(`{"index":0}`)}
+		}
 
-		id, err := merkle.Append(hashes[i])
+		receipt, err := merkle.AppendWithReceipt(hash, metadata, nil)
 		r.NoError(err)
-		r.EqualValues(i, id)
+		r.EqualValues(i, receipt.ID)
+		r.EqualValues(i+1, receipt.Leaves)
+		r.Equal(hash, receipt.Path[0])
+		r.True(testVerify(receipt.Path[0], receipt.Path[1:]))
 
+		// the digest of receipt is indexed as the latest one
 		digest, err := merkle.Digest()
 		r.NoError(err)
-		r.NotEmpty(digest)
-
-		digests = append(digests, digest)
-
-		id = rand.Uint64() % uint64(i+1)
-		target, err := merkle.Get(id)
-		r.NoError(err)
+		r.Equal(digest, receipt.Path[len(receipt.Path)-1])
 
-		path, err := merkle.GetProof(id, nil)
+		size, err := merkle.TreeSizeOf(digest)
 		r.NoError(err)
-		r.NotEmpty(path)
-
-		r.Equal(target, path[0])
-		r.Equal(digest, path[len(path)-1])
-		r.True(testVerify(path[0], path[1:]))
-
-		for j := 0; j <= i; j++ {
-			target, err := merkle.Get(uint64(j))
-			r.NoError(err)
+		r.Equal(receipt.Leaves, size)
 
-			path, err := merkle.GetProof(uint64(j), digest)
+		if metadata != nil {
+			stored, err := merkle.GetMetadata(receipt.ID)
 			r.NoError(err)
-			r.NotEmpty(path)
-
-			r.Equal(target, path[0])
-			r.Equal(digest, path[len(path)-1])
-			r.True(testVerify(path[0], path[1:]))
-		}
-	}
-
-	for i, digest := range digests {
-		for j, target := range hashes {
-			path, err := merkle.GetProof(uint64(j), digest)
-			if i >= j {
-				r.NoError(err)
-				r.NotEmpty(path)
-
-				r.Equal(target, path[0])
-				r.Equal(digest, path[len(path)-1])
-				r.True(testVerify(path[0], path[1:]))
-			} else {
-				r.Error(err)
-				r.True(errors.Is(err, ErrNotFound))
-			}
+			r.Equal(metadata.Value, stored.Value)
 		}
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
-func TestMerkleTreeStreamingLoad(t *testing.T) {
+func TestMerkleTreeStreaming_AppendIf(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
-
-	db, err := NewLevelDB(path)
+	merkle, err := NewMerkleTreeStreaming(NewMemDB())
 	r.NoError(err)
-	r.NotNil(db)
-
-	merkle, err := NewMerkleTreeStreaming(db)
-	r.NoError(err)
-	r.NotNil(merkle)
-
-	hashes := make([][]byte, 33)
 
+	hashes := make([][]byte, 4)
 	for i := range hashes {
 		hashes[i] = make([]byte, 32)
 		rand.Read(hashes[i])
+	}
 
-		id, err := merkle.Append(hashes[i])
-		r.NoError(err)
-		r.EqualValues(i, id)
-
-		digest, err := merkle.Digest()
-		r.NoError(err)
-		r.NotEmpty(digest)
-
-		r.NoError(merkle.Close())
+	_, err = merkle.AppendIf(nil, nil, nil)
+	r.True(errors.Is(err, ErrEmpty))
 
-		db, err = NewLevelDB(path)
-		r.NoError(err)
-		r.NotNil(db)
+	// an empty tree has no leaves and no digest
+	_, err = merkle.AppendIf(hashes[:1], nil, &Precondition{Leaves: 1})
+	r.True(errors.Is(err, ErrPreconditionFailed))
+	_, err = merkle.AppendIf(hashes[:1], nil, &Precondition{Digest: hashes[0]})
+	r.True(errors.Is(err, ErrPreconditionFailed))
 
-		merkle, err = NewMerkleTreeStreaming(db)
-		r.NoError(err)
-		r.NotNil(merkle)
+	id, err := merkle.AppendIf(hashes[:2], nil, &Precondition{Leaves: 0})
+	r.NoError(err)
+	r.EqualValues(0, id)
 
-		target, err := merkle.Get(id)
-		r.NoError(err)
-		r.Equal(hashes[i], target)
+	digest, err := merkle.Digest()
+	r.NoError(err)
 
-		id, err = merkle.Search(hashes[i])
-		r.NoError(err)
-		r.EqualValues(i, id)
+	// only one of the writers who read the same tree appends
+	id, err = merkle.AppendIf(hashes[2:3], []*Metadata{{Value: []byte(`{}`)}}, &Precondition{Digest: digest})
+	r.NoError(err)
+	r.EqualValues(2, id)
 
-		digest, err = merkle.Digest()
-		r.NoError(err)
-		r.NotEmpty(digest)
+	_, err = merkle.AppendIf(hashes[3:], nil, &Precondition{Digest: digest})
+	r.True(errors.Is(err, ErrPreconditionFailed))
+	_, err = merkle.AppendWithReceipt(hashes[3], nil, &Precondition{Leaves: 2})
+	r.True(errors.Is(err, ErrPreconditionFailed))
+	r.EqualValues(3, merkle.Leaves())
 
-		path, err := merkle.GetProof(id, nil)
-		r.NoError(err)
-		r.NotEmpty(path)
+	metadata, err := merkle.GetMetadata(2)
+	r.NoError(err)
+	r.Equal(`{}`, string(metadata.Value))
 
-		r.Equal(target, path[0])
-		r.Equal(digest, path[len(path)-1])
-		r.True(testVerify(path[0], path[1:]))
-	}
+	receipt, err := merkle.AppendWithReceipt(hashes[3], nil, &Precondition{Leaves: 3})
+	r.NoError(err)
+	r.EqualValues(3, receipt.ID)
+	r.EqualValues(4, receipt.Leaves)
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
-func TestMerkleTreeStreamingRecover(t *testing.T) {
+func TestMerkleTreeStreaming_AppendOnce(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
+	db := NewMemDB()
 
-	db, err := NewLevelDB(path)
+	merkle, err := NewMerkleTreeStreaming(db, WithDuplicatePolicy(RejectDuplicates))
 	r.NoError(err)
-	r.NotNil(db)
 
-	merkle, err := NewMerkleTreeStreaming(db)
-	r.NoError(err)
+	hashes := make([][]byte, 2)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendOnce(nil, time.Hour, hashes[0], nil, nil)
+	r.True(errors.Is(err, ErrEmpty))
+
+	id, err := merkle.AppendOnce([]byte("request-1"), time.Hour, hashes[0], nil, &Precondition{Leaves: 0})
+	r.NoError(err)
+	r.EqualValues(0, id)
+
+	// a retried request returns the original id even if its hash is rejected and its precondition fails now
+	id, err = merkle.AppendOnce([]byte("request-1"), time.Hour, hashes[0], nil, &Precondition{Leaves: 0})
+	r.NoError(err)
+	r.EqualValues(0, id)
+	r.EqualValues(1, merkle.Leaves())
+
+	_, err = merkle.AppendOnce([]byte("request-1"), time.Hour, hashes[1], nil, nil)
+	r.True(errors.Is(err, ErrAlreadyExists))
+
+	_, err = merkle.AppendOnce([]byte("request-2"), time.Hour, hashes[0], nil, nil)
+	r.True(errors.Is(err, ErrAlreadyExists))
+	db = reopenMemDB(r, db, merkle)
+
+	// keys are kept after reopening
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	id, err = merkle.AppendOnce([]byte("request-1"), time.Hour, hashes[0], &Metadata{Value: []byte(`{}`)}, nil)
+	r.NoError(err)
+	r.EqualValues(0, id)
+
+	r.NoError(merkle.Close())
+
+	// expired keys are used again, and purged by later requests
+	db = NewMemDB()
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	for i := 0; i < idempotencyPurgeLimit+2; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		id, err = merkle.AppendOnce([]byte(fmt.Sprintf("expired-%d", i)), time.Nanosecond, hash, nil, nil)
+		r.NoError(err)
+		r.EqualValues(i, id)
+	}
+
+	for i := 0; i < 2; i++ {
+		id, err = merkle.AppendOnce([]byte("expired-0"), time.Hour, hashes[1], nil, nil)
+		r.NoError(err)
+		r.EqualValues(idempotencyPurgeLimit+2, id)
+	}
+
+	stream := merkle.(*MerkleTreeStream)
+	r.EqualValues(idempotencyPurgeLimit+2, stream.idempotencyFirst)
+	r.EqualValues(idempotencyPurgeLimit+3, stream.idempotencyNext)
+
+	_, err = db.Get(idempotencyKey([]byte("expired-1")))
+	r.True(errors.Is(err, ErrNotFound))
+	_, err = db.Get(idempotencyLogKey(0))
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_AppendOnceExisting(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := NewMerkleTreeStreaming(NewMemDB(), WithDuplicatePolicy(ReturnExisting))
+	r.NoError(err)
+
+	hashes := make([][]byte, 2)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	metadata := &Metadata{Value: []byte(`{"name":"a"}`)}
+	_, err = merkle.Append(hashes[0])
+	r.NoError(err)
+	_, err = merkle.AppendWithMetadata(hashes[1], metadata)
+	r.NoError(err)
+
+	// the key of an existing hash is recorded, so that it is still bound to the hash
+	id, err := merkle.AppendOnce([]byte("request-1"), time.Hour, hashes[0], nil, nil)
+	r.NoError(err)
+	r.EqualValues(0, id)
+	r.EqualValues(2, merkle.Leaves())
+
+	stream := merkle.(*MerkleTreeStream)
+	r.EqualValues(1, stream.idempotencyNext)
+
+	_, err = merkle.AppendOnce([]byte("request-1"), time.Hour, hashes[1], nil, nil)
+	r.True(errors.Is(err, ErrAlreadyExists))
+
+	// metadata of an existing hash is never discarded silently
+	_, err = merkle.AppendOnce([]byte("request-2"), time.Hour, hashes[0], metadata, nil)
+	r.True(errors.Is(err, ErrAlreadyExists))
+	_, err = merkle.AppendOnce([]byte("request-2"), time.Hour, hashes[1], &Metadata{Value: []byte(`{"name":"b"}`)}, nil)
+	r.True(errors.Is(err, ErrAlreadyExists))
+	r.EqualValues(1, stream.idempotencyNext)
+
+	id, err = merkle.AppendOnce([]byte("request-2"), time.Hour, hashes[1], metadata, nil)
+	r.NoError(err)
+	r.EqualValues(1, id)
+	r.EqualValues(2, stream.idempotencyNext)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingGetProofFromOldDigest(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+	r.NotNil(db)
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+	r.NotNil(merkle)
+
+	hashes := make([][]byte, 65)
+	digests := make([][]byte, 0, 65)
+
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+
+		id, err := merkle.Append(hashes[i])
+		r.NoError(err)
+		r.EqualValues(i, id)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		r.NotEmpty(digest)
+
+		digests = append(digests, digest)
+
+		id = rand.Uint64() % uint64(i+1)
+		target, err := merkle.Get(id)
+		r.NoError(err)
+
+		path, err := merkle.GetProof(id, nil)
+		r.NoError(err)
+		r.NotEmpty(path)
+
+		r.Equal(target, path[0])
+		r.Equal(digest, path[len(path)-1])
+		r.True(testVerify(path[0], path[1:]))
+
+		for j := 0; j <= i; j++ {
+			target, err := merkle.Get(uint64(j))
+			r.NoError(err)
+
+			path, err := merkle.GetProof(uint64(j), digest)
+			r.NoError(err)
+			r.NotEmpty(path)
+
+			r.Equal(target, path[0])
+			r.Equal(digest, path[len(path)-1])
+			r.True(testVerify(path[0], path[1:]))
+		}
+	}
+
+	for i, digest := range digests {
+		for j, target := range hashes {
+			path, err := merkle.GetProof(uint64(j), digest)
+			if i >= j {
+				r.NoError(err)
+				r.NotEmpty(path)
+
+				r.Equal(target, path[0])
+				r.Equal(digest, path[len(path)-1])
+				r.True(testVerify(path[0], path[1:]))
+			} else {
+				r.Error(err)
+				r.True(errors.Is(err, ErrNotFound))
+			}
+		}
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_DigestAt(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	for _, mode := range []crypto.TreeMode{crypto.PlaceholderMode, crypto.RFC6962Mode} {
+		merkle, err := NewMerkleTreeStreaming(NewMemDB(), WithTreeMode(mode))
+		r.NoError(err)
+
+		// the reference tree indexes the digest of each size when leaves are appended
+		reference, err := NewMerkleTreeStreaming(NewMemDB(), WithTreeMode(mode))
+		r.NoError(err)
+
+		_, err = merkle.DigestAt(0)
+		r.True(errors.Is(err, ErrOutOfRange))
+		_, err = merkle.DigestAt(1)
+		r.True(errors.Is(err, ErrOutOfRange))
+
+		hashes := make([][]byte, 67)
+		digests := make([][]byte, 0, len(hashes))
+		for i := range hashes {
+			hashes[i] = make([]byte, 32)
+			rand.Read(hashes[i])
+
+			_, err = reference.Append(hashes[i])
+			r.NoError(err)
+
+			digest, err := reference.Digest()
+			r.NoError(err)
+			digests = append(digests, digest)
+		}
+
+		// no digest is indexed but the latest one
+		_, err = merkle.AppendBatch(hashes)
+		r.NoError(err)
+
+		_, err = merkle.DigestAt(uint64(len(hashes) + 1))
+		r.True(errors.Is(err, ErrOutOfRange))
+		_, err = merkle.GetProofAt(3, 3)
+		r.True(errors.Is(err, ErrOutOfRange))
+		_, err = merkle.GetProofAt(0, uint64(len(hashes)+1))
+		r.True(errors.Is(err, ErrOutOfRange))
+
+		_, err = merkle.GetProof(0, digests[9])
+		r.True(errors.Is(err, ErrInvalidDigest))
+		_, err = merkle.TreeSizeOf(digests[9])
+		r.True(errors.Is(err, ErrInvalidDigest))
+
+		verifier := verify.New(merkle.TreeHasher())
+		for i, expect := range digests {
+			size := uint64(i + 1)
+
+			digest, err := merkle.DigestAt(size)
+			r.NoError(err)
+			r.Equal(expect, digest)
+
+			indexedSize, err := merkle.TreeSizeOf(digest)
+			r.NoError(err)
+			r.Equal(size, indexedSize)
+
+			for id := uint64(0); id < size; id++ {
+				path, err := merkle.GetProofAt(id, size)
+				r.NoError(err)
+				r.Equal(hashes[id], path[0])
+				r.Equal(digest, path[len(path)-1])
+				r.NoError(verifier.Path(path, id, size, digest))
+
+				// the reconstructed digest is indexed
+				indexed, err := merkle.GetProof(id, digest)
+				r.NoError(err)
+				r.Equal(path, indexed)
+			}
+		}
+
+		r.NoError(merkle.Close())
+		r.NoError(reference.Close())
+	}
+}
+
+func TestMerkleTreeStreaming_ListDigests(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	checkpoints, total, err := merkle.ListDigests(0, 10)
+	r.NoError(err)
+	r.Empty(checkpoints)
+	r.Zero(total)
+
+	_, err = merkle.LatestCheckpoint()
+	r.True(errors.Is(err, ErrEmpty))
+
+	start := time.Now()
+	digests := make([][]byte, 0, 10)
+	for i := 0; i < 10; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err = merkle.Append(hash)
+		r.NoError(err)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		digests = append(digests, digest)
+
+		// a digest is recorded only once
+		_, err = merkle.Digest()
+		r.NoError(err)
+	}
+
+	// digests reconstructed for past sizes are not recorded again
+	digest, err := merkle.DigestAt(2)
+	r.NoError(err)
+	r.Equal(digests[1], digest)
+
+	old, err := merkle.DigestAt(20)
+	r.True(errors.Is(err, ErrOutOfRange))
+	r.Nil(old)
+	db = reopenMemDB(r, db, merkle)
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	checkpoints, total, err = merkle.ListDigests(0, -1)
+	r.NoError(err)
+	r.EqualValues(10, total)
+	r.Len(checkpoints, 10)
+
+	for i, checkpoint := range checkpoints {
+		r.EqualValues(i, checkpoint.Index)
+		r.Equal(digests[i], checkpoint.Digest)
+		r.EqualValues(i+1, checkpoint.Leaves)
+		r.Equal(lastFrozenAt(uint64(i+1))+1, checkpoint.Size)
+		r.False(checkpoint.Time.Before(start.Truncate(time.Second)))
+		r.False(checkpoint.Time.After(time.Now()))
+
+		if i > 0 {
+			r.False(checkpoint.Time.Before(checkpoints[i-1].Time))
+		}
+	}
+
+	page, total, err := merkle.ListDigests(8, 5)
+	r.NoError(err)
+	r.EqualValues(10, total)
+	r.Equal(checkpoints[8:], page)
+
+	// the latest checkpoint is loaded after reopening
+	latest, err := merkle.LatestCheckpoint()
+	r.NoError(err)
+	r.Equal(checkpoints[9], latest)
+
+	page, _, err = merkle.ListDigests(10, 5)
+	r.NoError(err)
+	r.Empty(page)
+
+	_, _, err = merkle.ListDigests(11, 5)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	// new checkpoints continue after reopening
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	_, err = merkle.Append(hash)
+	r.NoError(err)
+
+	digest, err = merkle.Digest()
+	r.NoError(err)
+
+	page, total, err = merkle.ListDigests(10, 5)
+	r.NoError(err)
+	r.EqualValues(11, total)
+	r.Len(page, 1)
+	r.EqualValues(10, page[0].Index)
+	r.Equal(digest, page[0].Digest)
+
+	latest, err = merkle.LatestCheckpoint()
+	r.NoError(err)
+	r.Equal(page[0], latest)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_DigestAtCheckpoints(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+
+	hashes := make([][]byte, 10)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendBatch(hashes[:5])
+	r.NoError(err)
+	_, err = merkle.Digest()
+	r.NoError(err)
+	_, err = merkle.AppendBatch(hashes[5:])
+	r.NoError(err)
+	head, err := merkle.Digest()
+	r.NoError(err)
+
+	checkpoints, total, err := merkle.ListDigests(0, -1)
+	r.NoError(err)
+	r.EqualValues(2, total)
+
+	changed, err := merkle.Changed()
+	r.NoError(err)
+
+	// past digests are indexed for proofs to them, without checkpoints of old sizes or changes
+	for size := uint64(1); size < uint64(len(hashes)); size++ {
+		digest, err := merkle.DigestAt(size)
+		r.NoError(err)
+
+		proof, err := merkle.GetProofAt(size-1, size)
+		r.NoError(err)
+		r.Equal(digest, proof[len(proof)-1])
+
+		proof, err = merkle.GetProof(size-1, digest)
+		r.NoError(err)
+		r.Equal(digest, proof[len(proof)-1])
+	}
+
+	digest, err := merkle.DigestAt(uint64(len(hashes)))
+	r.NoError(err)
+	r.Equal(head, digest)
+
+	select {
+	case <-changed:
+		r.FailNow("changed by digests of past sizes")
+	default:
+	}
+
+	unchanged, total, err := merkle.ListDigests(0, -1)
+	r.NoError(err)
+	r.EqualValues(2, total)
+	r.Equal(checkpoints, unchanged)
+
+	// the current head indexed by DigestAt is still recorded once it is the digest
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	_, err = merkle.Append(hash)
+	r.NoError(err)
+
+	digest, err = merkle.DigestAt(merkle.Leaves())
+	r.NoError(err)
+	_, total, err = merkle.ListDigests(0, -1)
+	r.NoError(err)
+	r.EqualValues(2, total)
+
+	head, err = merkle.Digest()
+	r.NoError(err)
+	r.Equal(digest, head)
+
+	latest, err := merkle.LatestCheckpoint()
+	r.NoError(err)
+	r.EqualValues(2, latest.Index)
+	r.Equal(head, latest.Digest)
+	r.EqualValues(len(hashes)+1, latest.Leaves)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_Anchor(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	_, err = merkle.LatestAnchor()
+	r.True(errors.Is(err, ErrEmpty))
+	_, err = merkle.GetAnchor(0)
+	r.True(errors.Is(err, ErrNotFound))
+
+	// digests of 3, 5 and 9 leaves are anchored
+	digests := make(map[int][]byte)
+	for i := 1; i <= 10; i++ {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err = merkle.Append(hash)
+		r.NoError(err)
+
+		digests[i], err = merkle.Digest()
+		r.NoError(err)
+	}
+
+	fake := make([]byte, 32)
+	rand.Read(fake)
+	err = merkle.AddAnchor(&Anchor{Digest: fake, Ledger: "file", TxID: "tx"})
+	r.True(errors.Is(err, ErrInvalidDigest))
+
+	for i, size := range []int{3, 5, 9} {
+		anchor := &Anchor{Digest: digests[size], Ledger: "file", TxID: fmt.Sprintf("tx%d", i), Block: uint64(i), Time: time.Now()}
+		r.NoError(merkle.AddAnchor(anchor))
+		r.EqualValues(i, anchor.Index)
+		r.EqualValues(size, anchor.Leaves)
+	}
+
+	// anchors are recorded in the order of tree size
+	err = merkle.AddAnchor(&Anchor{Digest: digests[4], Ledger: "file", TxID: "old"})
+	r.True(errors.Is(err, ErrInvalidDigest))
+	db = reopenMemDB(r, db, merkle)
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	latest, err := merkle.LatestAnchor()
+	r.NoError(err)
+	r.EqualValues(2, latest.Index)
+	r.Equal(digests[9], latest.Digest)
+	r.Equal("file", latest.Ledger)
+	r.Equal("tx2", latest.TxID)
+	r.EqualValues(2, latest.Block)
+
+	for id, size := range []int{3, 3, 3, 5, 5, 9, 9, 9, 9} {
+		anchor, err := merkle.GetAnchor(uint64(id))
+		r.NoError(err)
+		r.Equal(digests[size], anchor.Digest)
+		r.EqualValues(size, anchor.Leaves)
+	}
+
+	_, err = merkle.GetAnchor(9)
+	r.True(errors.Is(err, ErrNotFound))
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_Metadata(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	_, err = merkle.GetMetadata(0)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	plain, err := merkle.Append(hash)
+	r.NoError(err)
+
+	_, err = merkle.GetMetadata(plain)
+	r.True(errors.Is(err, ErrNotFound))
+
+	described, err := merkle.AppendWithMetadata(hash, &Metadata{Value: []byte(`{"name":"a.txt"}`)})
+	r.NoError(err)
+
+	// a committed leaf differs from the hash it commits
+	value := []byte(`{"name":"b.txt"}`)
+	leaf := crypto.CommitMetadata(merkle.TreeHasher().Hasher(), hash, value)
+	committed, err := merkle.AppendWithMetadata(leaf, &Metadata{Value: value, Committed: hash})
+	r.NoError(err)
+	db = reopenMemDB(r, db, merkle)
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	metadata, err := merkle.GetMetadata(described)
+	r.NoError(err)
+	r.Equal(`{"name":"a.txt"}`, string(metadata.Value))
+	r.Nil(metadata.Committed)
+
+	metadata, err = merkle.GetMetadata(committed)
+	r.NoError(err)
+	r.Equal(value, metadata.Value)
+	r.Equal(hash, metadata.Committed)
+
+	stored, err := merkle.Get(committed)
+	r.NoError(err)
+	r.Equal(leaf, stored)
+
+	// the leaf with metadata is searched by the stored leaf
+	id, err := merkle.Search(leaf)
+	r.NoError(err)
+	r.Equal(committed, id)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_GetConsistencyProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+	r.NotNil(db)
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+	r.NotNil(merkle)
+
+	_, err = merkle.GetConsistencyProof(crypto.Hash(nil), nil)
+	r.True(errors.Is(err, ErrInvalidDigest))
+
+	hashes := make([][]byte, 65)
+	digests := make([][]byte, 0, 65)
+
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+
+		_, err := merkle.Append(hashes[i])
+		r.NoError(err)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		digests = append(digests, digest)
+
+		proof, err := merkle.GetConsistencyProof(digests[0], nil)
+		r.NoError(err)
+		r.Equal(digest, proof.NewDigest)
+		r.EqualValues(1, proof.OldSize)
+		r.EqualValues(i+1, proof.NewSize)
+		r.NoError(verify.Consistency(digests[0], digest, proof.OldSize, proof.NewSize, proof.Path))
+	}
+
+	for i, oldDigest := range digests {
+		for j, newDigest := range digests {
+			proof, err := merkle.GetConsistencyProof(oldDigest, newDigest)
+			if i > j {
+				r.Error(err)
+				r.True(errors.Is(err, ErrInvalidDigest))
+				continue
+			}
+
+			r.NoError(err)
+			r.EqualValues(i+1, proof.OldSize)
+			r.EqualValues(j+1, proof.NewSize)
+			r.NoError(verify.Consistency(oldDigest, newDigest, proof.OldSize, proof.NewSize, proof.Path))
+		}
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_GetMultiProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+
+	_, err = merkle.GetMultiProof([]uint64{0}, nil)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	hashes := make([][]byte, 33)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendBatch(hashes[:16])
+	r.NoError(err)
+
+	old, err := merkle.Digest()
+	r.NoError(err)
+
+	_, err = merkle.AppendBatch(hashes[16:])
+	r.NoError(err)
+
+	_, err = merkle.GetMultiProof(nil, nil)
+	r.True(errors.Is(err, ErrEmpty))
+
+	_, err = merkle.GetMultiProof([]uint64{0, 33}, nil)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	_, err = merkle.GetMultiProof([]uint64{0, 16}, old)
+	r.True(errors.Is(err, ErrNotFound))
+
+	_, err = merkle.GetMultiProof([]uint64{0}, crypto.Hash([]byte("invalid")))
+	r.True(errors.Is(err, ErrInvalidDigest))
+
+	// ids are sorted and deduplicated
+	proof, err := merkle.GetMultiProof([]uint64{5, 1, 5, 4}, old)
+	r.NoError(err)
+	r.Equal(old, proof.Digest)
+	r.EqualValues(16, proof.Size)
+	r.Equal([]uint64{1, 4, 5}, proof.IDs)
+	r.Equal([][]byte{hashes[1], hashes[4], hashes[5]}, proof.Leaves)
+
+	// siblings: leaf 0, subtree [2, 4), subtree [6, 8) and subtree [8, 16)
+	r.Len(proof.Hashes, 4)
+	r.NoError(verify.Multi(proof.Leaves, proof.IDs, proof.Size, proof.Hashes, old))
+
+	all := make([]uint64, len(hashes))
+	for i := range all {
+		all[i] = uint64(i)
+	}
+
+	proof, err = merkle.GetMultiProof(all, nil)
+	r.NoError(err)
+	r.Empty(proof.Hashes)
+	r.Equal(hashes, proof.Leaves)
+
+	latest, err := merkle.Digest()
+	r.NoError(err)
+	r.Equal(latest, proof.Digest)
+	r.NoError(verify.Multi(proof.Leaves, proof.IDs, proof.Size, proof.Hashes, latest))
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreaming_GetRangeProof(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	merkle, err := NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+
+	_, err = merkle.GetRangeProof(0, 1, nil)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	hashes := make([][]byte, 33)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	_, err = merkle.AppendBatch(hashes[:16])
+	r.NoError(err)
+
+	old, err := merkle.Digest()
+	r.NoError(err)
+
+	_, err = merkle.AppendBatch(hashes[16:])
+	r.NoError(err)
+
+	_, err = merkle.GetRangeProof(3, 3, nil)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	_, err = merkle.GetRangeProof(0, 34, nil)
+	r.True(errors.Is(err, ErrOutOfRange))
+
+	_, err = merkle.GetRangeProof(0, 17, old)
+	r.True(errors.Is(err, ErrNotFound))
+
+	_, err = merkle.GetRangeProof(0, 1, crypto.Hash([]byte("invalid")))
+	r.True(errors.Is(err, ErrInvalidDigest))
+
+	proof, err := merkle.GetRangeProof(3, 9, old)
+	r.NoError(err)
+	r.Equal(old, proof.Digest)
+	r.EqualValues(16, proof.Size)
+	r.EqualValues(3, proof.Start)
+	r.Equal(hashes[3:9], proof.Leaves)
+
+	// left siblings: leaf 2 and subtree [0, 2), right siblings: leaf 9, subtree [10, 12), subtree [12, 16)
+	r.Len(proof.Left, 2)
+	r.Len(proof.Right, 3)
+	r.NoError(verify.Range(proof.Leaves, proof.Start, proof.Size, proof.Left, proof.Right, old))
+
+	proof, err = merkle.GetRangeProof(0, 33, nil)
+	r.NoError(err)
+	r.Equal(hashes, proof.Leaves)
+	r.Empty(proof.Left)
+	r.Empty(proof.Right)
+
+	latest, err := merkle.Digest()
+	r.NoError(err)
+	r.Equal(latest, proof.Digest)
+	r.NoError(verify.Range(proof.Leaves, proof.Start, proof.Size, proof.Left, proof.Right, latest))
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingLoad(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+	r.NotNil(db)
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
 	r.NotNil(merkle)
 
 	hashes := make([][]byte, 33)
@@ -480,11 +1440,62 @@ func TestMerkleTreeStreamingRecover(t *testing.T) {
 		r.NoError(err)
 		r.NotEmpty(digest)
 
-		r.NoError(db.Close())
+		db = reopenMemDB(r, db, merkle)
 
-		db, err = NewLevelDB(path)
+		merkle, err = NewMerkleTreeStreaming(db)
 		r.NoError(err)
-		r.NotNil(db)
+		r.NotNil(merkle)
+
+		target, err := merkle.Get(id)
+		r.NoError(err)
+		r.Equal(hashes[i], target)
+
+		id, err = merkle.Search(hashes[i])
+		r.NoError(err)
+		r.EqualValues(i, id)
+
+		digest, err = merkle.Digest()
+		r.NoError(err)
+		r.NotEmpty(digest)
+
+		path, err := merkle.GetProof(id, nil)
+		r.NoError(err)
+		r.NotEmpty(path)
+
+		r.Equal(target, path[0])
+		r.Equal(digest, path[len(path)-1])
+		r.True(testVerify(path[0], path[1:]))
+	}
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingRecover(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+	r.NotNil(db)
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+	r.NotNil(merkle)
+
+	hashes := make([][]byte, 33)
+
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+
+		id, err := merkle.Append(hashes[i])
+		r.NoError(err)
+		r.EqualValues(i, id)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		r.NotEmpty(digest)
+
+		db = reopenMemDB(r, db, db)
 
 		distance := FromLeafIndex(id+1).Postorder() - FromLeafIndex(id).Postorder()
 		if distance > 1 {
@@ -518,18 +1529,271 @@ func TestMerkleTreeStreamingRecover(t *testing.T) {
 	}
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
-func TestMerkleTreeStreamingConcurrently(t *testing.T) {
+func TestMerkleTreeStreamingFaultInjection(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	hashes := make([][]byte, 33)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rand.Read(hashes[i])
+	}
+
+	// every append and new digest writes once, so the crash happens at every step by increasing the limit
+	for limit := 0; limit <= 2*len(hashes)+1; limit++ {
+		db := NewMemDB()
+		r.NotNil(db)
+
+		appended := 0
+		faulty := &faultyStore{KvStore: db, limit: limit}
+		merkle, err := NewMerkleTreeStreaming(faulty)
+		if err == nil {
+			for _, hash := range hashes {
+				if _, err := merkle.Append(hash); err != nil {
+					r.True(errors.Is(err, errFault))
+					break
+				}
+				appended++
+
+				if _, err := merkle.Digest(); err != nil {
+					r.True(errors.Is(err, errFault))
+					break
+				}
+			}
+		} else {
+			r.True(errors.Is(err, errFault))
+		}
+
+		// restart without fault
+		merkle, err = NewMerkleTreeStreaming(db)
+		r.NoError(err)
+		r.NotNil(merkle)
+
+		_, err = merkle.Get(uint64(appended))
+		r.True(errors.Is(err, ErrOutOfRange))
+
+		for i := appended; i < len(hashes); i++ {
+			id, err := merkle.Append(hashes[i])
+			r.NoError(err)
+			r.EqualValues(i, id)
+		}
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		r.Equal(testDigest(hashes), digest)
+
+		for i, hash := range hashes {
+			value, err := merkle.Get(uint64(i))
+			r.NoError(err)
+			r.Equal(hash, value)
+
+			id, err := merkle.Search(hash)
+			r.NoError(err)
+			r.EqualValues(i, id)
+
+			path, err := merkle.GetProof(id, nil)
+			r.NoError(err)
+			r.Equal(digest, path[len(path)-1])
+			r.True(testVerify(path[0], path[1:]))
+		}
+
+		r.NoError(merkle.Close())
+	}
+}
+
+func TestMerkleTreeStreamingRFC6962(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
+	r.NotNil(db)
+
+	merkle, err := NewMerkleTreeStreaming(db, WithTreeMode(crypto.RFC6962Mode))
+	r.NoError(err)
+	r.NotNil(merkle)
+
+	hasher, err := crypto.NewTreeHasher(crypto.DefaultHasher(), crypto.RFC6962Mode)
+	r.NoError(err)
+	verifier := verify.New(hasher)
+
+	// test vectors of RFC 6962 from Certificate Transparency
+	inputs := []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"}
+	expects := []string{"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328"}
+
+	hashes := make([][]byte, 0, 129)
+	digests := make([][]byte, 0, 129)
+
+	for i, input := range inputs {
+		leaf, err := hex.DecodeString(input)
+		r.NoError(err)
+
+		id, err := merkle.Append(leaf)
+		r.NoError(err)
+		r.EqualValues(i, id)
+		hashes = append(hashes, leaf)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		r.Equal(expects[i], hex.EncodeToString(digest))
+		digests = append(digests, digest)
+	}
+
+	for len(hashes) < cap(hashes) {
+		hash := make([]byte, 32)
+		rand.Read(hash)
+
+		_, err := merkle.Append(hash)
+		r.NoError(err)
+		hashes = append(hashes, hash)
+
+		digest, err := merkle.Digest()
+		r.NoError(err)
+		r.Equal(testRFC6962Digest(hashes), digest)
+		digests = append(digests, digest)
+
+		id := rand.Uint64() % uint64(len(hashes))
+		path, err := merkle.GetProof(id, nil)
+		r.NoError(err)
+		r.Equal(hashes[id], path[0])
+		r.NoError(verifier.Path(path, id, uint64(len(hashes)), digest))
+	}
+
+	for i, digest := range digests {
+		for id := 0; id <= i; id++ {
+			path, err := merkle.GetProof(uint64(id), digest)
+			r.NoError(err)
+			r.NoError(verifier.Path(path, uint64(id), uint64(i+1), digest))
+		}
+
+		proof, err := merkle.GetConsistencyProof(digest, nil)
+		r.NoError(err)
+		r.NoError(verifier.Consistency(digest, digests[len(digests)-1], proof.OldSize, proof.NewSize, proof.Path))
+	}
+
+	db = reopenMemDB(r, db, merkle)
+
+	// tree mode is fixed once the database is created
+	_, err = NewMerkleTreeStreaming(db, WithTreeMode(crypto.PlaceholderMode))
+	r.True(errors.Is(err, ErrIncompatible))
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	digest, err := merkle.Digest()
+	r.NoError(err)
+	r.Equal(digests[len(digests)-1], digest)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingLegacyTreeMode(t *testing.T) {
+	r := require.New(t)
+
+	db := NewMemDB()
+
+	merkle, err := NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	_, err = merkle.Append(crypto.Hash([]byte("legacy")))
+	r.NoError(err)
+
+	// databases created before tree mode is recorded are in placeholder mode
+	r.NoError(db.Delete(treeModeKey()))
+
+	_, err = NewMerkleTreeStreaming(db, WithTreeMode(crypto.RFC6962Mode))
+	r.True(errors.Is(err, ErrIncompatible))
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+
+	value, err := db.Get(treeModeKey())
+	r.NoError(err)
+	r.Equal([]byte{byte(crypto.PlaceholderMode)}, value)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingHasher(t *testing.T) {
 	r := require.New(t)
 	rand.Seed(time.Now().UnixNano())
 
-	path := filepath.Join(os.TempDir(), testDB)
-	r.NoError(os.RemoveAll(path))
+	db := NewMemDB()
+
+	hasher, err := crypto.NewHasher(crypto.SHA3_256)
+	r.NoError(err)
+
+	merkle, err := NewMerkleTreeStreaming(db, WithHasher(hasher))
+	r.NoError(err)
+	r.Equal(crypto.SHA3_256, merkle.TreeHasher().Hasher().Name())
+
+	for i := 0; i < 33; i++ {
+		hash := make([]byte, hasher.Size())
+		rand.Read(hash)
+
+		_, err := merkle.Append(hash)
+		r.NoError(err)
+	}
+
+	digest, err := merkle.Digest()
+	r.NoError(err)
+
+	treeHasher, err := crypto.NewTreeHasher(hasher, crypto.PlaceholderMode)
+	r.NoError(err)
+	verifier := verify.New(treeHasher)
+
+	for id := uint64(0); id < 33; id++ {
+		hashPath, err := merkle.GetProof(id, digest)
+		r.NoError(err)
+		r.NoError(verifier.Path(hashPath, id, 33, digest))
+		r.Error(verify.Path(hashPath, id, 33, digest))
+	}
+
+	// the recorded hash algorithm can't be switched
+	other, err := crypto.NewHasher(crypto.BLAKE2b256)
+	r.NoError(err)
+
+	_, err = NewMerkleTreeStreaming(db, WithHasher(other))
+	r.True(errors.Is(err, ErrIncompatible))
+
+	merkle, err = NewMerkleTreeStreaming(db)
+	r.NoError(err)
+	r.Equal(crypto.SHA3_256, merkle.TreeHasher().Hasher().Name())
+
+	reopened, err := merkle.Digest()
+	r.NoError(err)
+	r.Equal(digest, reopened)
+
+	// databases created before hash algorithm is recorded use SHA256
+	r.NoError(db.Delete(hasherKey()))
+
+	_, err = NewMerkleTreeStreaming(db, WithHasher(hasher))
+	r.True(errors.Is(err, ErrIncompatible))
 
-	db, err := NewLevelDB(path)
+	merkle, err = NewMerkleTreeStreaming(db)
 	r.NoError(err)
+	r.Equal(crypto.SHA256, merkle.TreeHasher().Hasher().Name())
+
+	value, err := db.Get(hasherKey())
+	r.NoError(err)
+	r.Equal([]byte(crypto.SHA256), value)
+
+	r.NoError(merkle.Close())
+}
+
+func TestMerkleTreeStreamingConcurrently(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	db := NewMemDB()
 	r.NotNil(db)
 
 	merkle, err := NewMerkleTreeStreaming(db)
@@ -621,7 +1885,6 @@ func TestMerkleTreeStreamingConcurrently(t *testing.T) {
 	wg.Wait()
 
 	r.NoError(merkle.Close())
-	r.NoError(os.RemoveAll(path))
 }
 
 // testDigest works in a very slow way with O(n^2) complexity, only used for verifying the correctness
@@ -642,6 +1905,21 @@ func testDigest(leaves [][]byte) []byte {
 	return testDigest(parents)
 }
 
+// testRFC6962Digest calculates the merkle tree hash defined in RFC 6962 recursively, only used for verifying the correctness
+func testRFC6962Digest(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return crypto.Hash(append([]byte{0x00}, leaves[0]...))
+	}
+
+	split := 1
+	for split<<1 < len(leaves) {
+		split <<= 1
+	}
+
+	node := append([]byte{0x01}, testRFC6962Digest(leaves[:split])...)
+	return crypto.Hash(append(node, testRFC6962Digest(leaves[split:])...))
+}
+
 // testVerify works in an extreme slow way with O(2^n) complexity, only used for verifying the correctness
 func testVerify(target []byte, path [][]byte) bool {
 	if len(path) == 0 {
@@ -658,3 +1936,54 @@ func testVerify(target []byte, path [][]byte) bool {
 
 	return testVerify(crypto.HashNodes(path[0], target), path[1:])
 }
+
+var errFault = fmt.Errorf("fault injection")
+
+// faultyStore fails all writes after the limit of writes is reached, just like the process crashes
+type faultyStore struct {
+	KvStore
+	writes int
+	limit  int
+}
+
+func (f *faultyStore) write() error {
+	if f.writes >= f.limit {
+		return errFault
+	}
+
+	f.writes++
+	return nil
+}
+
+func (f *faultyStore) Put(key, value []byte) error {
+	if err := f.write(); err != nil {
+		return err
+	}
+
+	return f.KvStore.Put(key, value)
+}
+
+func (f *faultyStore) Delete(key []byte) error {
+	if err := f.write(); err != nil {
+		return err
+	}
+
+	return f.KvStore.Delete(key)
+}
+
+func (f *faultyStore) NewBatch() Batch {
+	return &faultyBatch{Batch: f.KvStore.NewBatch(), store: f}
+}
+
+type faultyBatch struct {
+	Batch
+	store *faultyStore
+}
+
+func (b *faultyBatch) Write() error {
+	if err := b.store.write(); err != nil {
+		return err
+	}
+
+	return b.Batch.Write()
+}
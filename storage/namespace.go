@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// DefaultNamespace is the name of the accumulator used when no namespace is specified
+const DefaultNamespace = ""
+
+// namePattern limits names of namespaces, which are also used as directory names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// DBProvider creates, opens and removes databases of namespaces
+type DBProvider interface {
+	// Open opens the database of a namespace, which is created if it does not exist
+	Open(name string) (KvStore, error)
+	// Remove removes the closed database of a namespace
+	Remove(name string) error
+	// List returns the names of existing databases
+	List() ([]string, error)
+}
+
+// dirProvider keeps the database of each namespace in a subdirectory
+type dirProvider struct {
+	dir  string
+	open func(path string) (KvStore, error)
+}
+
+// NewDirProvider returns a provider of databases in subdirectories of dir, which are opened by open
+func NewDirProvider(dir string, open func(path string) (KvStore, error)) (DBProvider, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &dirProvider{dir: dir, open: open}, nil
+}
+
+func (p *dirProvider) Open(name string) (KvStore, error) {
+	return p.open(filepath.Join(p.dir, name))
+}
+
+func (p *dirProvider) Remove(name string) error {
+	return os.RemoveAll(filepath.Join(p.dir, name))
+}
+
+func (p *dirProvider) List() ([]string, error) {
+	infos, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() && namePattern.MatchString(info.Name()) {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// memProvider keeps databases of namespaces in memory, which are lost after the process exits
+type memProvider struct {
+	mutex sync.Mutex
+	dbs   map[string]KvStore
+}
+
+// NewMemProvider returns a provider of in-memory databases
+func NewMemProvider() DBProvider {
+	return &memProvider{dbs: make(map[string]KvStore)}
+}
+
+func (p *memProvider) Open(name string) (KvStore, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if db, ok := p.dbs[name]; ok {
+		return db, nil
+	}
+
+	db := NewMemDB()
+	p.dbs[name] = db
+	return db, nil
+}
+
+func (p *memProvider) Remove(name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.dbs, name)
+	return nil
+}
+
+func (p *memProvider) List() ([]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := make([]string, 0, len(p.dbs))
+	for name := range p.dbs {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Namespaces manages named accumulators in one server, each of which has its own database. The default accumulator
+// is named DefaultNamespace and can't be deleted.
+type Namespaces struct {
+	mutex        sync.RWMutex
+	provider     DBProvider
+	accumulators map[string]MerkleAccumulator
+}
+
+// NewNamespaces opens all existing namespaces of provider besides the default accumulator
+func NewNamespaces(defaultAccumulator MerkleAccumulator, provider DBProvider) (*Namespaces, error) {
+	n := &Namespaces{
+		provider:     provider,
+		accumulators: map[string]MerkleAccumulator{DefaultNamespace: defaultAccumulator},
+	}
+
+	names, err := provider.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		db, err := provider.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open namespace %s: %w", name, err)
+		}
+
+		// tree mode and hash algorithm are recorded in the database
+		accumulator, err := NewMerkleTreeStreaming(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open namespace %s: %w", name, err)
+		}
+
+		n.accumulators[name] = accumulator
+	}
+
+	return n, nil
+}
+
+// Get returns the accumulator of a namespace, or the default accumulator if name is DefaultNamespace
+func (n *Namespaces) Get(name string) (MerkleAccumulator, error) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	accumulator, ok := n.accumulators[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: namespace %s", ErrNotFound, name)
+	}
+
+	return accumulator, nil
+}
+
+// Create creates a namespace with a new accumulator configured by options
+func (n *Namespaces) Create(name string, opts ...Option) (MerkleAccumulator, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: namespace %q", ErrInvalidName, name)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if _, ok := n.accumulators[name]; ok {
+		return nil, fmt.Errorf("%w: namespace %s", ErrAlreadyExists, name)
+	}
+
+	db, err := n.provider.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	accumulator, err := NewMerkleTreeStreaming(db, opts...)
+	if err != nil {
+		_ = db.Close()
+		_ = n.provider.Remove(name)
+		return nil, err
+	}
+
+	n.accumulators[name] = accumulator
+	return accumulator, nil
+}
+
+// Delete closes the accumulator of a namespace and removes its database
+func (n *Namespaces) Delete(name string) error {
+	if name == DefaultNamespace {
+		return fmt.Errorf("%w: default namespace can't be deleted", ErrInvalidName)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	accumulator, ok := n.accumulators[name]
+	if !ok {
+		return fmt.Errorf("%w: namespace %s", ErrNotFound, name)
+	}
+
+	delete(n.accumulators, name)
+	if err := accumulator.Close(); err != nil {
+		return err
+	}
+
+	return n.provider.Remove(name)
+}
+
+// List returns the sorted names of namespaces without the default one
+func (n *Namespaces) List() []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	names := make([]string, 0, len(n.accumulators)-1)
+	for name := range n.accumulators {
+		if name != DefaultNamespace {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Close closes accumulators of all namespaces including the default one
+func (n *Namespaces) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var firstErr error
+	for name, accumulator := range n.accumulators {
+		if err := accumulator.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(n.accumulators, name)
+	}
+
+	return firstErr
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/frankonly/upchain/crypto"
+)
+
+func TestNamespaces(t *testing.T) {
+	r := require.New(t)
+	rand.Seed(time.Now().UnixNano())
+
+	dir := filepath.Join(os.TempDir(), "upchain_namespaces")
+	r.NoError(os.RemoveAll(dir))
+
+	defaultMerkle, err := NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+
+	provider, err := NewDirProvider(dir, func(path string) (KvStore, error) { return NewLevelDB(path) })
+	r.NoError(err)
+
+	namespaces, err := NewNamespaces(defaultMerkle, provider)
+	r.NoError(err)
+	r.Empty(namespaces.List())
+
+	merkle, err := namespaces.Get(DefaultNamespace)
+	r.NoError(err)
+	r.Equal(defaultMerkle, merkle)
+
+	_, err = namespaces.Get("team")
+	r.True(errors.Is(err, ErrNotFound))
+
+	for _, name := range []string{"", ".hidden", "a/b", "../up"} {
+		_, err = namespaces.Create(name)
+		r.True(errors.Is(err, ErrInvalidName))
+	}
+
+	team, err := namespaces.Create("team", WithTreeMode(crypto.RFC6962Mode))
+	r.NoError(err)
+	product, err := namespaces.Create("product-1")
+	r.NoError(err)
+	r.Equal([]string{"product-1", "team"}, namespaces.List())
+
+	_, err = namespaces.Create("team")
+	r.True(errors.Is(err, ErrAlreadyExists))
+
+	// namespaces are independent of each other
+	hash := make([]byte, 32)
+	rand.Read(hash)
+	_, err = team.Append(hash)
+	r.NoError(err)
+
+	_, err = product.Search(hash)
+	r.True(errors.Is(err, ErrNotFound))
+	_, err = defaultMerkle.Search(hash)
+	r.True(errors.Is(err, ErrNotFound))
+
+	teamDigest, err := team.Digest()
+	r.NoError(err)
+	r.NoError(namespaces.Delete("product-1"))
+	r.True(errors.Is(namespaces.Delete("product-1"), ErrNotFound))
+	r.True(errors.Is(namespaces.Delete(DefaultNamespace), ErrInvalidName))
+	r.NoError(namespaces.Close())
+
+	// namespaces are reopened with recorded tree modes
+	defaultMerkle, err = NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+
+	namespaces, err = NewNamespaces(defaultMerkle, provider)
+	r.NoError(err)
+	r.Equal([]string{"team"}, namespaces.List())
+
+	team, err = namespaces.Get("team")
+	r.NoError(err)
+	r.Equal(crypto.RFC6962Mode, team.TreeHasher().Mode())
+
+	digest, err := team.Digest()
+	r.NoError(err)
+	r.Equal(teamDigest, digest)
+
+	r.NoError(namespaces.Close())
+	r.NoError(os.RemoveAll(dir))
+}
+
+func TestNamespacesMemProvider(t *testing.T) {
+	r := require.New(t)
+
+	defaultMerkle, err := NewMerkleTreeStreaming(NewMemDB())
+	r.NoError(err)
+
+	namespaces, err := NewNamespaces(defaultMerkle, NewMemProvider())
+	r.NoError(err)
+
+	_, err = namespaces.Create("team", WithHasher(crypto.DefaultHasher()))
+	r.NoError(err)
+	r.Equal([]string{"team"}, namespaces.List())
+
+	r.NoError(namespaces.Delete("team"))
+	r.Empty(namespaces.List())
+
+	// a deleted namespace can be created again from scratch
+	team, err := namespaces.Create("team")
+	r.NoError(err)
+	_, err = team.Digest()
+	r.True(errors.Is(err, ErrEmpty))
+
+	r.NoError(namespaces.Close())
+}
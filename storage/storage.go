@@ -1,6 +1,11 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/frankonly/upchain/crypto"
+)
 
 var (
 	// ErrOutOfRange indicates that request is out of range
@@ -11,22 +16,186 @@ var (
 	ErrEmpty = fmt.Errorf("empty")
 	// ErrInvalidDigest indicates that digest is invalid
 	ErrInvalidDigest = fmt.Errorf("invliad digest")
+	// ErrIncompatible indicates that database is incompatible with the options
+	ErrIncompatible = fmt.Errorf("incompatible database")
+	// ErrCorrupted indicates that database is corrupted
+	ErrCorrupted = fmt.Errorf("corrupted database")
+	// ErrClosed indicates that database is closed
+	ErrClosed = fmt.Errorf("database closed")
+	// ErrAlreadyExists indicates that the target to create already exists
+	ErrAlreadyExists = fmt.Errorf("already exists")
+	// ErrInvalidName indicates that the name is not allowed
+	ErrInvalidName = fmt.Errorf("invalid name")
+	// ErrPreconditionFailed indicates that the tree is not the expected one to append to
+	ErrPreconditionFailed = fmt.Errorf("precondition failed")
 )
 
 // MerkleAccumulator defines core operations of merkle accumulator
 type MerkleAccumulator interface {
 	Append([]byte) (uint64, error)
+	AppendWithMetadata([]byte, *Metadata) (uint64, error)
+	AppendBatch([][]byte) (uint64, error)
+	AppendIf([][]byte, []*Metadata, *Precondition) (uint64, error)
+	AppendOnce([]byte, time.Duration, []byte, *Metadata, *Precondition) (uint64, error)
+	AppendWithReceipt([]byte, *Metadata, *Precondition) (*Receipt, error)
 	Get(uint64) ([]byte, error)
+	Leaves() uint64
+	GetMetadata(uint64) (*Metadata, error)
 	Search([]byte) (uint64, error)
+	SearchAll([]byte, uint64, int) ([]uint64, uint64, error)
 	Digest() ([]byte, error)
+	DigestAt(uint64) ([]byte, error)
+	TreeSizeOf([]byte) (uint64, error)
 	GetProof(uint64, []byte) ([][]byte, error)
+	GetProofAt(uint64, uint64) ([][]byte, error)
+	ListDigests(uint64, int) ([]*Checkpoint, uint64, error)
+	LatestCheckpoint() (*Checkpoint, error)
+	AddAnchor(*Anchor) error
+	GetAnchor(uint64) (*Anchor, error)
+	LatestAnchor() (*Anchor, error)
+	GetConsistencyProof([]byte, []byte) (*ConsistencyProof, error)
+	GetMultiProof([]uint64, []byte) (*MultiProof, error)
+	GetRangeProof(uint64, uint64, []byte) (*RangeProof, error)
+	TreeHasher() *crypto.TreeHasher
+	DuplicatePolicy() DuplicatePolicy
+	Changed() (<-chan struct{}, error)
 	Close() error
 }
 
+// DuplicatePolicy decides how an accumulator appends a hash which is already appended
+type DuplicatePolicy byte
+
+const (
+	// AllowDuplicates appends a hash again as a new leaf
+	AllowDuplicates DuplicatePolicy = iota
+	// RejectDuplicates fails to append a hash again with ErrAlreadyExists
+	RejectDuplicates
+	// ReturnExisting returns the id of the oldest leaf of a hash instead of appending it again, and fails batches
+	// with appended hashes with ErrAlreadyExists, because ids of a batch should be contiguous
+	ReturnExisting
+)
+
+var duplicatePolicyNames = map[DuplicatePolicy]string{
+	AllowDuplicates:  "allow",
+	RejectDuplicates: "reject",
+	ReturnExisting:   "existing",
+}
+
+// ParseDuplicatePolicy parses duplicate policy from its name
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	for policy, policyName := range duplicatePolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown duplicate policy %s", name)
+}
+
+// String returns the name of duplicate policy
+func (p DuplicatePolicy) String() string {
+	if name, ok := duplicatePolicyNames[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown(%d)", byte(p))
+}
+
+// Metadata describes a leaf, such as the file or submitter of it, and is stored next to the leaf
+type Metadata struct {
+	// Value is the metadata blob, which is usually JSON
+	Value []byte
+	// Committed is the hash committed with Value into the leaf by crypto.CommitMetadata, or nil if the leaf is
+	// appended as it is
+	Committed []byte
+}
+
+// Precondition is checked with the tree right before hashes are appended, so that nothing else is appended after the
+// caller reads the tree. Digest is compared with the latest digest if it is not empty, otherwise Leaves is compared
+// with the number of leaves, which is 0 for an empty tree.
+type Precondition struct {
+	Leaves uint64
+	Digest []byte
+}
+
+// Receipt proves that a leaf is included in the tree right after it is appended. Path is the hash path from the leaf
+// to the digest as returned by GetProof, and Leaves is the number of leaves of the tree of the digest.
+type Receipt struct {
+	ID     uint64
+	Leaves uint64
+	Path   [][]byte
+}
+
+// ConsistencyProof proves that the tree of old digest is a prefix of the tree of new digest.
+// Path contains the frozen subtrees of the old tree followed by the subtrees of the new tree covering the rest leaves,
+// both from left to right.
+type ConsistencyProof struct {
+	OldDigest []byte
+	NewDigest []byte
+	OldSize   uint64
+	NewSize   uint64
+	Path      [][]byte
+}
+
+// MultiProof proves that several leaves are included in the tree of digest together.
+// IDs are sorted without duplicates, and Leaves are the hashes of them in the same order. Hashes contains the minimal
+// siblings to reconstruct the root, ordered level by level from bottom to top and from left to right on each level.
+// Siblings which are empty subtrees are not a part of Hashes.
+type MultiProof struct {
+	Digest []byte
+	Size   uint64
+	IDs    []uint64
+	Leaves [][]byte
+	Hashes [][]byte
+}
+
+// RangeProof proves that Leaves are exactly the leaves in [Start, Start+len(Leaves)) of the tree of digest.
+// Left and Right are the siblings on the left and right boundaries of the range, both from bottom to top.
+// Siblings which are empty subtrees are not a part of Right.
+type RangeProof struct {
+	Digest []byte
+	Size   uint64
+	Start  uint64
+	Leaves [][]byte
+	Left   [][]byte
+	Right  [][]byte
+}
+
+// Checkpoint records an indexed digest with the tree size, which is the number of nodes, and the number of leaves at
+// the time of digest. Index is the order in which the digest was indexed.
+type Checkpoint struct {
+	Index  uint64
+	Digest []byte
+	Size   uint64
+	Leaves uint64
+	Time   time.Time
+}
+
+// Anchor records the transaction which puts an indexed digest on an external ledger. Index is the order of anchoring,
+// and Leaves is the number of leaves at the time of digest. Block and Time are decided by the ledger.
+type Anchor struct {
+	Index  uint64
+	Digest []byte
+	Leaves uint64
+	Ledger string
+	TxID   string
+	Block  uint64
+	Time   time.Time
+}
+
 // KvStore supports basic functions of kv store
 type KvStore interface {
 	Get(key []byte) ([]byte, error)
 	Put(key, value []byte) error
 	Delete(key []byte) error
+	NewBatch() Batch
 	Close() error
 }
+
+// Batch collects writes of KvStore and commits them atomically
+type Batch interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+	Len() int
+	Write() error
+}